@@ -36,13 +36,40 @@ const stateCF = "stateCF"
 const stateDeltaCF = "stateDeltaCF"
 const indexesCF = "indexesCF"
 const persistCF = "persistCF"
+const addressIndexesCF = "addressIndexesCF"
+const addressIndexesAltCF = "addressIndexesAltCF"
+
+// the index entries in indexesCF are mostly read by point lookups (block hash, tx uuid), so a whole key bloom filter
+// lets a lookup skip the files that do not have the key. No prefix extractor is set on the index column families:
+// the queries for the last key of a key type and the descending address scans seek to the upper bound of a key
+// prefix and step back with Prev, which crosses into another prefix and is undefined in prefix mode, and the
+// vendored gorocksdb does not expose the total_order_seek read option to opt out of it. A fixed length extractor
+// would also have to follow the configured index key namespace, whose header length is not known to this package.
+// The composite keys already start with the key type and the address, so the block based table prefix compression
+// shares their common bytes without an extractor. The address index entries, if split into
+// addressIndexesCF, are read by range scans, for which larger blocks mean fewer block reads per scan
+const indexesCFBloomFilterBitsPerKey = 10
+const addressIndexesCFBlockSize = 64 * 1024
+
+// indexesCompactionFilter, if set, is called when the db is opened and the filter it returns, if any, is installed
+// as the compaction filter of indexesCF and of the address index column families
+var indexesCompactionFilter func() gorocksdb.CompactionFilter
+
+// SetIndexesCompactionFilter sets the function that returns the compaction filter of the index column families
+// (see core/ledger/blockchain_indexes_expiry.go). The function is called each time the db is opened, so that the
+// filter is only installed if it is configured at that time. A nil filter leaves the compactions unfiltered
+func SetIndexesCompactionFilter(filter func() gorocksdb.CompactionFilter) {
+	indexesCompactionFilter = filter
+}
 
 var columnfamilies = []string{
-	blockchainCF, // blocks of the block chain
-	stateCF,      // world state
-	stateDeltaCF, // open transaction state
-	indexesCF,    // tx uuid -> blockno
-	persistCF,    // persistent per-peer state (consensus)
+	blockchainCF,        // blocks of the block chain
+	stateCF,             // world state
+	stateDeltaCF,        // open transaction state
+	indexesCF,           // tx uuid -> blockno
+	persistCF,           // persistent per-peer state (consensus)
+	addressIndexesCF,    // address index entries, if split from indexesCF (see core/ledger/blockchain_indexes_cf.go)
+	addressIndexesAltCF, // address index entries rebuilt while addressIndexesCF keeps serving the queries
 }
 
 type dbState int32
@@ -60,8 +87,13 @@ type OpenchainDB struct {
 	StateDeltaCF *gorocksdb.ColumnFamilyHandle
 	IndexesCF    *gorocksdb.ColumnFamilyHandle
 	PersistCF    *gorocksdb.ColumnFamilyHandle
-	dbState      dbState
-	mux          sync.Mutex
+	// AddressIndexesCF holds the address index entries if they are split from IndexesCF
+	AddressIndexesCF *gorocksdb.ColumnFamilyHandle
+	// AddressIndexesAltCF takes turns with AddressIndexesCF in holding the split address index entries,
+	// so that one can be rebuilt while the other serves the queries
+	AddressIndexesAltCF *gorocksdb.ColumnFamilyHandle
+	dbState             dbState
+	mux                 sync.Mutex
 }
 
 var openchainDB = Create()
@@ -102,11 +134,31 @@ func (openchainDB *OpenchainDB) GetFromIndexesCF(key []byte) ([]byte, error) {
 	return openchainDB.Get(openchainDB.IndexesCF, key)
 }
 
+// GetFromIndexesCFSnapshot get value for given key from column family in a DB snapshot - indexCF
+func (openchainDB *OpenchainDB) GetFromIndexesCFSnapshot(snapshot *gorocksdb.Snapshot, key []byte) ([]byte, error) {
+	return openchainDB.getFromSnapshot(snapshot, openchainDB.IndexesCF, key)
+}
+
 // GetBlockchainCFIterator get iterator for column family - blockchainCF
 func (openchainDB *OpenchainDB) GetBlockchainCFIterator() *gorocksdb.Iterator {
 	return openchainDB.GetIterator(openchainDB.BlockchainCF)
 }
 
+// GetIndexesCFIterator get iterator for column family - indexCF
+func (openchainDB *OpenchainDB) GetIndexesCFIterator() *gorocksdb.Iterator {
+	return openchainDB.GetIterator(openchainDB.IndexesCF)
+}
+
+// GetAddressIndexesCFIterator get iterator for column family - addressIndexesCF
+func (openchainDB *OpenchainDB) GetAddressIndexesCFIterator() *gorocksdb.Iterator {
+	return openchainDB.GetIterator(openchainDB.AddressIndexesCF)
+}
+
+// GetAddressIndexesAltCFIterator get iterator for column family - addressIndexesAltCF
+func (openchainDB *OpenchainDB) GetAddressIndexesAltCFIterator() *gorocksdb.Iterator {
+	return openchainDB.GetIterator(openchainDB.AddressIndexesAltCF)
+}
+
 // GetStateCFIterator get iterator for column family - stateCF
 func (openchainDB *OpenchainDB) GetStateCFIterator() *gorocksdb.Iterator {
 	return openchainDB.GetIterator(openchainDB.StateCF)
@@ -171,11 +223,39 @@ func (openchainDB *OpenchainDB) Open() {
 	opts.SetCreateIfMissing(missing)
 	opts.SetCreateIfMissingColumnFamilies(true)
 
+	indexesOpts := gorocksdb.NewDefaultOptions()
+	defer indexesOpts.Destroy()
+	indexesTableOpts := gorocksdb.NewDefaultBlockBasedTableOptions()
+	defer indexesTableOpts.Destroy()
+	indexesTableOpts.SetFilterPolicy(gorocksdb.NewBloomFilter(indexesCFBloomFilterBitsPerKey))
+	indexesOpts.SetBlockBasedTableFactory(indexesTableOpts)
+
+	addressIndexesOpts := gorocksdb.NewDefaultOptions()
+	defer addressIndexesOpts.Destroy()
+	addressIndexesTableOpts := gorocksdb.NewDefaultBlockBasedTableOptions()
+	defer addressIndexesTableOpts.Destroy()
+	addressIndexesTableOpts.SetBlockSize(addressIndexesCFBlockSize)
+	addressIndexesOpts.SetBlockBasedTableFactory(addressIndexesTableOpts)
+
+	if indexesCompactionFilter != nil {
+		if filter := indexesCompactionFilter(); filter != nil {
+			indexesOpts.SetCompactionFilter(filter)
+			addressIndexesOpts.SetCompactionFilter(filter)
+		}
+	}
+
 	cfNames := []string{"default"}
 	cfNames = append(cfNames, columnfamilies...)
 	var cfOpts []*gorocksdb.Options
-	for range cfNames {
-		cfOpts = append(cfOpts, opts)
+	for _, cfName := range cfNames {
+		switch cfName {
+		case indexesCF:
+			cfOpts = append(cfOpts, indexesOpts)
+		case addressIndexesCF, addressIndexesAltCF:
+			cfOpts = append(cfOpts, addressIndexesOpts)
+		default:
+			cfOpts = append(cfOpts, opts)
+		}
 	}
 
 	db, cfHandlers, err := gorocksdb.OpenDbColumnFamilies(opts, dbPath, cfNames, cfOpts)
@@ -190,6 +270,8 @@ func (openchainDB *OpenchainDB) Open() {
 	openchainDB.StateDeltaCF = cfHandlers[3]
 	openchainDB.IndexesCF = cfHandlers[4]
 	openchainDB.PersistCF = cfHandlers[5]
+	openchainDB.AddressIndexesCF = cfHandlers[6]
+	openchainDB.AddressIndexesAltCF = cfHandlers[7]
 	openchainDB.dbState = opened
 }
 
@@ -207,6 +289,8 @@ func (openchainDB *OpenchainDB) Close() {
 	openchainDB.StateDeltaCF.Destroy()
 	openchainDB.IndexesCF.Destroy()
 	openchainDB.PersistCF.Destroy()
+	openchainDB.AddressIndexesCF.Destroy()
+	openchainDB.AddressIndexesAltCF.Destroy()
 	openchainDB.DB.Close()
 	openchainDB.dbState = closed
 }
@@ -240,7 +324,8 @@ func (openchainDB *OpenchainDB) DeleteState() error {
 	return nil
 }
 
-// Get returns the valud for the given column family and key
+// Get returns the value for the given column family and key. The value is copied out of the rocksdb slice,
+// which is freed before returning, so the caller can keep and modify it
 func (openchainDB *OpenchainDB) Get(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
 	opt := gorocksdb.NewDefaultReadOptions()
 	defer opt.Destroy()
@@ -291,6 +376,7 @@ func (openchainDB *OpenchainDB) getFromSnapshot(snapshot *gorocksdb.Snapshot, cf
 		return nil, err
 	}
 	defer slice.Free()
+	// copied, as the slice is freed on return
 	data := append([]byte(nil), slice.Data()...)
 	return data, nil
 }
@@ -303,6 +389,12 @@ func (openchainDB *OpenchainDB) GetIterator(cfHandler *gorocksdb.ColumnFamilyHan
 	return openchainDB.DB.NewIteratorCF(opt, cfHandler)
 }
 
+// GetSnapshotIterator returns an iterator for the given column family that reads from the given snapshot.
+// Remember to call iterator.Close() when you are done.
+func (openchainDB *OpenchainDB) GetSnapshotIterator(snapshot *gorocksdb.Snapshot, cfHandler *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
+	return openchainDB.getSnapshotIterator(snapshot, cfHandler)
+}
+
 func (openchainDB *OpenchainDB) getSnapshotIterator(snapshot *gorocksdb.Snapshot, cfHandler *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
 	opt := gorocksdb.NewDefaultReadOptions()
 	defer opt.Destroy()
@@ -228,6 +228,51 @@ func TestDBIteratorAndSnapshotIterator(t *testing.T) {
 	testIterator(t, itr, map[string][]byte{"key6": []byte("value6"), "key7": []byte("value7")})
 }
 
+func TestIndexesCFPrefixSeek(t *testing.T) {
+	testDBWrapper := NewTestDBWrapper()
+	testDBWrapper.CleanDB(t)
+	openchainDB := GetDBHandle()
+	defer testDBWrapper.cleanup()
+
+	// keys of different key types, including composite keys that share a long common prefix
+	openchainDB.Put(openchainDB.IndexesCF, []byte{1, 'h', 'a', 's', 'h'}, []byte("value1"))
+	openchainDB.Put(openchainDB.IndexesCF, []byte{3, 8, 'a', 'd', 'd', 'r', 'e', 's', 's', '1', 0}, []byte("value2"))
+	openchainDB.Put(openchainDB.IndexesCF, []byte{3, 8, 'a', 'd', 'd', 'r', 'e', 's', 's', '1', 1}, []byte("value3"))
+	openchainDB.Put(openchainDB.IndexesCF, []byte{3, 8, 'a', 'd', 'd', 'r', 'e', 's', 's', '2', 0}, []byte("value4"))
+	openchainDB.Put(openchainDB.IndexesCF, []byte{4, 'c', 'c'}, []byte("value5"))
+
+	testPrefixSeek := func(prefix []byte, expectedValues []string) {
+		itr := openchainDB.GetIndexesCFIterator()
+		defer itr.Close()
+		var values []string
+		for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+			values = append(values, string(makeCopy(itr.Value().Data())))
+		}
+		if len(values) != len(expectedValues) {
+			t.Fatalf("Expected [%d] results for prefix [%x], found [%d]", len(expectedValues), prefix, len(values))
+		}
+		for i := range values {
+			if values[i] != expectedValues[i] {
+				t.Fatalf("Wrong value for prefix [%x] at position [%d]. Expected [%s], found [%s]", prefix, i, expectedValues[i], values[i])
+			}
+		}
+	}
+	testPrefixSeek([]byte{1}, []string{"value1"})
+	testPrefixSeek([]byte{3}, []string{"value2", "value3", "value4"})
+	testPrefixSeek([]byte{3, 8, 'a', 'd', 'd', 'r', 'e', 's', 's', '1'}, []string{"value2", "value3"})
+	testPrefixSeek([]byte{4}, []string{"value5"})
+	testPrefixSeek([]byte{2}, nil)
+
+	// a seek past the keys of a key type followed by Prev lands on the last key of that type
+	itr := openchainDB.GetIndexesCFIterator()
+	defer itr.Close()
+	itr.Seek([]byte{4})
+	itr.Prev()
+	if !itr.Valid() || string(makeCopy(itr.Value().Data())) != "value4" {
+		t.Fatalf("Expected the last key of key type [3] before key type [4]")
+	}
+}
+
 // db helper functions
 func testIterator(t *testing.T, itr *gorocksdb.Iterator, expectedValues map[string][]byte) {
 	itrResults := make(map[string][]byte)
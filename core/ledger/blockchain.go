@@ -19,6 +19,7 @@ package ledger
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"strconv"
 
 	"github.com/hyperledger/fabric/core/db"
@@ -41,10 +42,22 @@ type lastProcessedBlock struct {
 	block       *protos.Block
 	blockNumber uint64
 	blockHash   []byte
+	// addressCFAlternate is the address column family that the synchronously indexed entries of the block were
+	// added to (see indexSplitAddressCF)
+	addressCFAlternate bool
 }
 
 var indexBlockDataSynchronously = true
 
+// indexBlockDataInMemory makes the blockchain keep the indexes in memory (see blockchainIndexerMem) instead of the db.
+// When set, indexBlockDataSynchronously is not applicable
+var indexBlockDataInMemory = false
+
+// indexWritesDurably makes the async indexer commit each index batch with a synced write (fsync).
+// This protects the index against loss on power failure at the cost of higher latency per indexed block.
+// The sync indexer writes as part of the block's own batch and is not affected by this setting.
+var indexWritesDurably = false
+
 func newBlockchain() (*blockchain, error) {
 	size, err := fetchBlockchainSizeFromDB()
 	if err != nil {
@@ -72,11 +85,16 @@ func newBlockchain() (*blockchain, error) {
 }
 
 func (blockchain *blockchain) startIndexer() (err error) {
-	if indexBlockDataSynchronously {
+	if indexBlockDataInMemory {
+		blockchain.indexer = newBlockchainIndexerMem()
+	} else if indexBlockDataSynchronously {
 		blockchain.indexer = newBlockchainIndexerSync()
 	} else {
 		blockchain.indexer = newBlockchainIndexerAsync()
 	}
+	if err = loadIndexExpiryThreshold(); err != nil {
+		return
+	}
 	err = blockchain.indexer.start(blockchain)
 	return
 }
@@ -102,23 +120,50 @@ func (blockchain *blockchain) getBlock(blockNumber uint64) (*protos.Block, error
 // getBlockByHash get block by block hash
 func (blockchain *blockchain) getBlockByHash(blockHash []byte) (*protos.Block, error) {
 	blockNumber, err := blockchain.indexer.fetchBlockNumberByBlockHash(blockHash)
+	indexMetrics.lookupDone(err)
 	if err != nil {
 		return nil, err
 	}
 	return blockchain.getBlock(blockNumber)
 }
 
+// getTransactionByUUID returns the transaction with the given uuid. The error tells apart the failure modes:
+// ErrResourceNotFound if the uuid is not indexed, an ErrorTypeBlockLoadFailed error if the indexed block
+// could not be loaded (which may be retried), an ErrorTypeOutOfBounds error if the indexed transaction
+// index is not within the block and, if indexVerifyFetchedTransactions is set, an ErrorTypeIndexMismatch error
+// if the indexed transaction has another uuid
 func (blockchain *blockchain) getTransactionByUUID(txUUID string) (*protos.Transaction, error) {
-	blockNumber, txIndex, err := blockchain.indexer.fetchTransactionIndexByUUID(txUUID)
+	txLocation, err := blockchain.indexer.fetchTransactionLocationByUUID(txUUID)
+	indexMetrics.lookupDone(err)
 	if err != nil {
 		return nil, err
 	}
-	block, err := blockchain.getBlock(blockNumber)
+	block, err := blockchain.getBlock(txLocation.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, newLedgerError(ErrorTypeBlockLoadFailed,
+			fmt.Sprintf("Could not load block [%d] of transaction [%s]: %s", txLocation.BlockNumber, txUUID, err))
+	}
+	if block == nil {
+		return nil, newLedgerError(ErrorTypeBlockLoadFailed,
+			fmt.Sprintf("Block [%d] of transaction [%s] is not present", txLocation.BlockNumber, txUUID))
+	}
+	transactions := block.GetTransactions()
+	if txLocation.TxIndex >= uint64(len(transactions)) {
+		return nil, newLedgerError(ErrorTypeOutOfBounds, fmt.Sprintf("Transaction [%s] is indexed at position [%d] of block [%d], which has [%d] transactions",
+			txUUID, txLocation.TxIndex, txLocation.BlockNumber, len(transactions)))
+	}
+	tx := transactions[txLocation.TxIndex]
+	if indexVerifyFetchedTransactions {
+		loadedTxUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return nil, err
+		}
+		if loadedTxUUID != txUUID {
+			return nil, newLedgerError(ErrorTypeIndexMismatch, fmt.Sprintf("Transaction [%s] is indexed at position [%d] of block [%d], which holds transaction [%s]",
+				txUUID, txLocation.TxIndex, txLocation.BlockNumber, loadedTxUUID))
+		}
 	}
-	transaction := block.GetTransactions()[txIndex]
-	return transaction, nil
+	return tx, nil
 }
 
 // getTransactions get all transactions in a block identified by block number
@@ -206,21 +251,59 @@ func (blockchain *blockchain) addPersistenceChangesForNewBlock(ctx context.Conte
 	}
 	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
 	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, blockCountKey, encodeUint64(blockNumber+1))
+	var addressCFAlternate bool
 	if blockchain.indexer.isSynchronous() {
-		blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch)
+		if err := verifyBlockNumberNotIndexedWithDifferentHash(blockNumber, blockHash); err != nil {
+			return 0, err
+		}
+		if addressCFAlternate, err = blockchain.addIndexesToBatch(block, blockNumber, blockHash, writeBatch); err != nil {
+			return 0, err
+		}
 	}
-	blockchain.lastProcessedBlock = &lastProcessedBlock{block, blockNumber, blockHash}
+	blockchain.lastProcessedBlock = &lastProcessedBlock{block, blockNumber, blockHash, addressCFAlternate}
 	return blockNumber, nil
 }
 
+// addIndexesToBatch adds the index entries of the block to the writeBatch under the read lock of indexWriteLock and
+// returns the address column family that the entries were added to. The lock is not held until the writeBatch is
+// committed by the caller, so a swap of the address column family may come in between (see blockPersistenceStatus)
+func (blockchain *blockchain) addIndexesToBatch(block *protos.Block, blockNumber uint64, blockHash []byte,
+	writeBatch *gorocksdb.WriteBatch) (bool, error) {
+	indexWriteLock.RLock()
+	defer indexWriteLock.RUnlock()
+	addressCFAlternate := indexSplitAddressCF && isAlternateAddressCFActive()
+	return addressCFAlternate, blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch)
+}
+
 func (blockchain *blockchain) blockPersistenceStatus(success bool) {
+	if listener, ok := blockchain.indexer.(indexPersistenceListener); ok {
+		listener.indexesPersisted(success)
+	}
 	if success {
 		blockchain.size++
 		blockchain.previousBlockHash = blockchain.lastProcessedBlock.blockHash
 		if !blockchain.indexer.isSynchronous() {
-			blockchain.indexer.createIndexesAsync(blockchain.lastProcessedBlock.block,
-				blockchain.lastProcessedBlock.blockNumber, blockchain.lastProcessedBlock.blockHash)
+			if err := blockchain.indexer.createIndexesAsync(blockchain.lastProcessedBlock.block,
+				blockchain.lastProcessedBlock.blockNumber, blockchain.lastProcessedBlock.blockHash); err != nil {
+				indexLogger.Warningf("Block number [%d] is not queued for indexing: %s",
+					blockchain.lastProcessedBlock.blockNumber, err)
+			}
+		} else {
+			// the index entries were committed along with the block
+			indexWALCommitted(blockchain.lastProcessedBlock.blockNumber)
+			indexExpiryCommitted(blockchain.lastProcessedBlock.blockNumber)
+			if indexSplitAddressCF && isAlternateAddressCFActive() != blockchain.lastProcessedBlock.addressCFAlternate {
+				// the address entries were committed to the column family swapped out since they were added
+				if err := addAddressIndexesAfterSwap(blockchain.lastProcessedBlock.blockNumber); err != nil {
+					indexLogger.Errorf("Error adding the address entries of block number [%d] to the swapped in "+
+						"column family: %s", blockchain.lastProcessedBlock.blockNumber, err)
+				}
+			}
+			indexEvents.publish(blockchain.lastProcessedBlock.blockNumber, blockchain.lastProcessedBlock.blockHash)
 		}
+	} else if blockchain.lastProcessedBlock != nil && blockchain.indexer.isSynchronous() {
+		// the index entries were dropped along with the block
+		indexWALDiscarded(blockchain.lastProcessedBlock.blockNumber)
 	}
 	blockchain.lastProcessedBlock = nil
 }
@@ -249,15 +332,29 @@ func (blockchain *blockchain) persistRawBlock(block *protos.Block, blockNumber u
 	}
 
 	if blockchain.indexer.isSynchronous() {
-		blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch)
+		indexWriteLock.RLock()
+		defer indexWriteLock.RUnlock()
+		if err := blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch); err != nil {
+			return err
+		}
 	}
 
 	opt := gorocksdb.NewDefaultWriteOptions()
 	defer opt.Destroy()
 	err = db.GetDBHandle().DB.Write(opt, writeBatch)
+	if listener, ok := blockchain.indexer.(indexPersistenceListener); ok {
+		listener.indexesPersisted(err == nil)
+	}
 	if err != nil {
+		if blockchain.indexer.isSynchronous() {
+			indexWALDiscarded(blockNumber)
+		}
 		return err
 	}
+	if blockchain.indexer.isSynchronous() {
+		indexWALCommitted(blockNumber)
+		indexExpiryCommitted(blockNumber)
+	}
 	return nil
 }
 
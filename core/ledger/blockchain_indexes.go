@@ -17,10 +17,23 @@ limitations under the License.
 package ledger
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/op/go-logging"
 	"github.com/tecbot/gorocksdb"
@@ -30,23 +43,138 @@ var indexLogger = logging.MustGetLogger("indexes")
 var prefixBlockHashKey = byte(1)
 var prefixTxUUIDKey = byte(2)
 var prefixAddressBlockNumCompositeKey = byte(3)
+var prefixAddressChaincodeIDCompositeKey = byte(4)
+var prefixTxSizeKey = byte(5)
+var prefixTxReferenceCompositeKey = byte(6)
+var prefixPruneCursorKey = byte(7)
+var prefixTxTypeCompositeKey = byte(8)
+var prefixBlockNumberKey = byte(9)
+var prefixProposerBlockNumCompositeKey = byte(10)
+var prefixTxExecutingAddressesKey = byte(11)
+var prefixTxCountBlockNumCompositeKey = byte(12)
+var prefixTxMetadataCompositeKey = byte(13)
+var prefixAddressDigestKey = byte(14)
+var prefixBlockTxCountKey = byte(15)
+var prefixBlockNumAddressCompositeKey = byte(16)
+var prefixChaincodeHistoryCompositeKey = byte(17)
+var prefixAddressLatestBlockKey = byte(18)
+var prefixIndexTombstoneKey = byte(19)
+var prefixChaincodeTxCompositeKey = byte(20)
+var prefixIndexSchemaVersionKey = byte(21)
+var prefixPreviousBlockHashKey = byte(22)
+var prefixAddressTxIndexesContinuationKey = byte(23)
+var prefixTxTagCompositeKey = byte(24)
+var prefixActiveAddressCFKey = byte(25)
+var prefixTxSignatureHashCompositeKey = byte(26)
+var prefixBlockTotalFeeKey = byte(27)
+var prefixAddressBlockFeeCompositeKey = byte(28)
+var prefixIndexVerifyCursorKey = byte(29)
+var prefixBlockTimestampKey = byte(30)
+var prefixTimestampBlockNumCompositeKey = byte(31)
+var prefixAddressInternIDKey = byte(32)
+var prefixInternIDAddressKey = byte(33)
+var prefixBlockAddressIDsKey = byte(34)
+var prefixIndexExpiryThresholdKey = byte(35)
 
+// indexKeyNamespace, when non-zero, is prepended to every index key (before the key type prefix)
+// so that the index key space can share a db with other subsystems. Zero means no namespace,
+// which keeps the keys compatible with the ones written before namespaces were introduced.
+// A non-zero namespace should not be one of the key type prefixes above (e.g., use a value >= 0x80)
+var indexKeyNamespace = byte(0)
+
+// indexValueChecksums, when true, stores the block hash, blockNumTxIndex and tx indexes list values
+// in a checksummed format (see encodeIndexValue) and verifies the checksum on every read.
+// This detects silent disk corruption at the cost of extra bytes per value and a crc computation per read/write.
+// The setting should not be changed for an existing db, as the values written earlier are not converted
+var indexValueChecksums = false
+
+// indexKeysLittleEndian, when true, encodes the fixed-width numbers in the index keys (and the tombstones) in
+// little-endian order instead of big-endian. Big-endian keeps the keys of an index in numeric order, which the range
+// scans and the seeks to the last key rely on. Little-endian matches the expectation of some external tools that
+// read the db, but the ordered queries (e.g., by size range, by block range, the highest indexed block) then return
+// wrong results. The byte order is stored along with the schema version, and an indexer does not start on a db
+// whose index was written with the other byte order, as the keys written earlier are not converted
+var indexKeysLittleEndian = false
+
+// indexByteOrder is the byte order in effect for the index keys. It is set from indexKeysLittleEndian when an
+// indexer is created (see setIndexByteOrderFromConfig)
+var indexByteOrder binary.ByteOrder = binary.BigEndian
+
+// indexVerifyUniqueTxUUIDs, when true, makes the indexer verify that the uuid of each transaction being indexed
+// is not already indexed at a different location, instead of silently overwriting the existing entry.
+// This costs a db read per transaction
+var indexVerifyUniqueTxUUIDs = false
+
+// indexVerifyFetchedTransactions, when true, makes a lookup of a transaction by uuid verify that the uuid of the
+// transaction loaded from the block matches the requested uuid, which detects an index that has drifted from the blocks.
+// This costs a marshalling and a hash of the transaction if the uuid has to be derived from its content
+var indexVerifyFetchedTransactions = false
+
+// indexAllowBlockNumberOverwrite, when false, makes the indexer refuse to index a new block at a block number
+// that is already indexed with a different block hash, which would otherwise silently corrupt the index (e.g., on a fork).
+// Raw blocks persisted at a given block number (e.g., by state transfer) deliberately replace the existing block and are not checked
+var indexAllowBlockNumberOverwrite = false
+
+// indexMaxAddressLength, when non-zero, is the maximum length of an address that is used as is in the address keys.
+// A longer address (e.g., a full certificate) is replaced by its digest (see indexHasher) so that it does not bloat every key
+var indexMaxAddressLength = 0
+
+// indexStoreFullAddresses, when true, stores the digest -> full address mapping of the addresses that are
+// replaced by their digest in the keys, so that the full address can be recovered from a key
+var indexStoreFullAddresses = true
+
+// indexAddressLatestBlockOnly, when true, switches the address index to a lightweight mode that keeps only the
+// latest block in which each address transacted (see fetchLatestActivityBlock), instead of the tx indexes of every
+// block. This trades the transaction history of the addresses for space. The setting should not be changed for an existing db
+var indexAddressLatestBlockOnly = false
+
+// codec tag of the checksummed value format
+const indexValueCodecCRC32 = byte(1)
+
+// hasher computes the hashes that the indexer derives on its own, such as the hash of a block loaded from the db.
+// It should match the hash algorithm used for the block hashes that are passed to the indexer
+type hasher interface {
+	Hash(data []byte) []byte
+}
+
+// cryptoHasher is the default hasher and uses the same hash function as protos.Block.GetHash
+type cryptoHasher struct {
+}
+
+func (cryptoHasher) Hash(data []byte) []byte {
+	return util.ComputeCryptoHash(data)
+}
+
+var indexHasher hasher = cryptoHasher{}
+
+// blockchainIndexer is implemented by the sync, async and in-memory indexers. The implementations get the db handle
+// and the column family handles from db.GetDBHandle() for each operation and do not cache them, as the handles
+// are recreated when the db is reopened
 type blockchainIndexer interface {
 	isSynchronous() bool
 	start(blockchain *blockchain) error
 	createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error
 	createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error
 	fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error)
-	fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error)
+	fetchTransactionLocationByUUID(txUUID string) (*TransactionLocation, error)
 	stop()
 }
 
+// indexPersistenceListener is implemented by the indexers that keep the entries of createIndexesSync outside the
+// writeBatch, to apply them once the writeBatch is committed or to drop them if it is not
+type indexPersistenceListener interface {
+	indexesPersisted(success bool)
+}
+
 // Implementation for sync indexer
 type blockchainIndexerSync struct {
+	compactionScheduler *indexCompactionScheduler
+	statsSampler        *indexStatsSampler
 }
 
 func newBlockchainIndexerSync() *blockchainIndexerSync {
-	return &blockchainIndexerSync{}
+	setIndexByteOrderFromConfig()
+	return &blockchainIndexerSync{newIndexCompactionSchedulerFromConfig(), newIndexStatsSamplerFromConfig()}
 }
 
 func (indexer *blockchainIndexerSync) isSynchronous() bool {
@@ -54,11 +182,24 @@ func (indexer *blockchainIndexerSync) isSynchronous() bool {
 }
 
 func (indexer *blockchainIndexerSync) start(blockchain *blockchain) error {
+	if err := checkIndexSchemaVersion(); err != nil {
+		return err
+	}
+	// each block is indexed in the batch that adds it to the chain, so all the blocks of the chain are indexed
+	if size := blockchain.getSize(); size > 0 {
+		if err := backfillTxCounts(size - 1); err != nil {
+			return err
+		}
+	}
+	warmUpIndexesFromConfig()
+	indexer.compactionScheduler.start()
+	indexer.statsSampler.start(blockchain.indexLag)
 	return nil
 }
 
 func (indexer *blockchainIndexerSync) createIndexesSync(
 	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+	indexer.compactionScheduler.recordActivity()
 	return addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
 }
 
@@ -70,33 +211,148 @@ func (indexer *blockchainIndexerSync) fetchBlockNumberByBlockHash(blockHash []by
 	return fetchBlockNumberByBlockHashFromDB(blockHash)
 }
 
-func (indexer *blockchainIndexerSync) fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error) {
-	return fetchTransactionIndexByUUIDFromDB(txUUID)
+func (indexer *blockchainIndexerSync) fetchTransactionLocationByUUID(txUUID string) (*TransactionLocation, error) {
+	return fetchTransactionLocationByUUIDFromDB(txUUID)
+}
+
+func (indexer *blockchainIndexerSync) statsHistory() []indexStatsSample {
+	return indexer.statsSampler.history()
 }
 
 func (indexer *blockchainIndexerSync) stop() {
-	return
+	indexer.compactionScheduler.stop()
+	indexer.statsSampler.stop()
 }
 
 // Functions for persisting and retrieving index data
 func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+	return addIndexDataForBatch(block, blockNumber, blockHash, writeBatch, nil)
+}
+
+// addIndexDataForBatch is addIndexDataForPersistence for a writeBatch that holds several blocks, whose new interned
+// addresses are tracked by batchIDs
+func addIndexDataForBatch(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch,
+	batchIDs batchInternIDs) error {
+	var started time.Time
+	if indexTrackBuildTime {
+		started = time.Now()
+	}
 	openchainDB := db.GetDBHandle()
 	cf := openchainDB.IndexesCF
+	if err := validateIndexingInputs(block, blockNumber, blockHash, writeBatch, cf); err != nil {
+		return err
+	}
+
+	// the index entries of a block are written in a single batch, so a block whose hash is already indexed
+	// at the same block number is fully indexed (e.g., on a replay or a retry) and is not indexed again
+	alreadyIndexed, err := isBlockIndexed(blockNumber, blockHash)
+	if err != nil {
+		return err
+	}
+	if alreadyIndexed {
+		indexLogger.Debugf("Block number [%d] with hash [%x] is already indexed. Skipping", blockNumber, blockHash)
+		return nil
+	}
+
+	numKeys, numBytes := 0, 0
+	var walEntries []indexWALEntry
+	putIndex := func(key []byte, value []byte) {
+		writeBatch.PutCF(indexCFForKey(key), key, value)
+		if indexWALPath != "" {
+			walEntries = append(walEntries, indexWALEntry{key, value, false})
+		}
+		if indexSoftDeletes {
+			// indexing the block again undeletes the entry
+			tombstoneKey := encodeIndexTombstoneKey(key)
+			writeBatch.DeleteCF(cf, tombstoneKey)
+			if indexWALPath != "" {
+				walEntries = append(walEntries, indexWALEntry{tombstoneKey, nil, true})
+			}
+		}
+		numKeys++
+		numBytes += len(key) + len(value)
+	}
 
 	// add blockhash -> blockNumber
 	indexLogger.Debugf("Indexing block number [%d] by hash = [%x]", blockNumber, blockHash)
-	writeBatch.PutCF(cf, encodeBlockHashKey(blockHash), encodeBlockNumber(blockNumber))
+	putIndex(encodeBlockHashKey(blockHash), encodeIndexValue(encodeBlockNumber(blockNumber)))
+	// add blockNumber -> blockhash
+	putIndex(encodeBlockNumberKey(blockNumber), encodeIndexValue(blockHash))
+	// add blockNumber -> number of transactions in the block
+	putIndex(encodeBlockTxCountKey(blockNumber), encodeBlockNumber(uint64(len(block.GetTransactions()))))
+	// add blockNumber -> previous block hash. The genesis block has no parent
+	if blockNumber > 0 && len(block.PreviousBlockHash) > 0 {
+		putIndex(encodePreviousBlockHashKey(blockNumber), encodeIndexValue(block.PreviousBlockHash))
+	}
+
+	// add (cumulativeTxCount,blockNumber) - the prefix sum of the number of transactions in the blocks up to this block
+	txCountBeforeBlock, found, err := fetchTxCountBeforeBlock(blockNumber)
+	if err != nil {
+		return err
+	}
+	if found {
+		putIndex(encodeTxCountBlockNumCompositeKey(txCountBeforeBlock+uint64(len(block.GetTransactions())), blockNumber), []byte{})
+	} else {
+		indexLogger.Debugf("Not indexing the cumulative transaction count for block number [%d] as the count for the previous block is not indexed. It is backfilled when the indexer is started", blockNumber)
+	}
+
+	// add blockNumber -> timestamp and (timestamp,blockNumber)
+	if err := putBlockTimestampIndexes(block, blockNumber, putIndex); err != nil {
+		return err
+	}
+
+	// add (proposer,blockNumber)
+	if proposer := getBlockProposer(block); proposer != "" {
+		putIndex(encodeProposerBlockNumCompositeKey(proposer, blockNumber), []byte{})
+	}
 
 	addressToTxIndexesMap := make(map[string][]uint64)
 	addressToChaincodeIDsMap := make(map[string][]*protos.ChaincodeID)
 
+	var blockTxUUIDs map[string]uint64
+	if indexVerifyUniqueTxUUIDs {
+		blockTxUUIDs = make(map[string]uint64)
+	}
+
 	transactions := block.GetTransactions()
 	for txIndex, tx := range transactions {
+		txUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return err
+		}
+		if indexVerifyUniqueTxUUIDs {
+			if err := verifyTxUUIDNotIndexed(txUUID, blockNumber, uint64(txIndex), blockTxUUIDs); err != nil {
+				return err
+			}
+		}
 		// add TxUUID -> (blockNumber,indexWithinBlock)
-		writeBatch.PutCF(cf, encodeTxUUIDKey(tx.Uuid), encodeBlockNumTxIndex(blockNumber, uint64(txIndex)))
+		putIndex(encodeTxUUIDKey(txUUID), encodeIndexValue(encodeBlockNumTxIndex(blockNumber, uint64(txIndex))))
+
+		// add (txSize,blockNumber,indexWithinBlock) -> (blockNumber,indexWithinBlock)
+		putIndex(encodeTxSizeKey(uint64(proto.Size(tx)), blockNumber, uint64(txIndex)),
+			encodeIndexValue(encodeBlockNumTxIndex(blockNumber, uint64(txIndex))))
+
+		// add (txType,blockNumber,indexWithinBlock)
+		putIndex(encodeTxTypeCompositeKey(tx.Type, blockNumber, uint64(txIndex)), []byte{})
+
+		// add (metadataKey,metadataValue,blockNumber,indexWithinBlock) -> (blockNumber,indexWithinBlock)
+		for metadataKey, metadataValue := range getTxMetadataEntries(tx) {
+			putIndex(encodeTxMetadataCompositeKey(metadataKey, metadataValue, blockNumber, uint64(txIndex)),
+				encodeIndexValue(encodeBlockNumTxIndex(blockNumber, uint64(txIndex))))
+		}
+
+		// add (referencedTxUUID,TxUUID) for each prior transaction that this transaction refers to
+		for _, referencedTxUUID := range getTxReferencedUUIDs(tx) {
+			putIndex(encodeTxReferenceCompositeKey(referencedTxUUID, txUUID), []byte{})
+		}
+
+		txExecutingAddresses := getTxExecutingAddresses(tx)
+		for _, txExecutingAddress := range txExecutingAddresses {
+			addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
+		}
 
-		txExecutingAddress := getTxExecutingAddress(tx)
-		addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
+		// add TxUUID -> executing addresses
+		putIndex(encodeTxExecutingAddressesKey(txUUID), encodeIndexValue(encodeAddressList(txExecutingAddresses)))
 
 		switch tx.Type {
 		case protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE:
@@ -105,13 +361,416 @@ func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHa
 				addressToChaincodeIDsMap[authroizedAddress] = append(addressToChaincodeIDsMap[authroizedAddress], chaincodeID)
 			}
 		}
+
+		// add (chaincodePath,blockNumber,indexWithinBlock) -> chaincodeName for each deployment
+		if chaincodeID := getDeployedChaincodeID(tx); chaincodeID != nil {
+			putIndex(encodeChaincodeHistoryCompositeKey(chaincodeID.Path, blockNumber, uint64(txIndex)), []byte(chaincodeID.Name))
+		}
+
+		// add (chaincodeName,blockNumber,indexWithinBlock) for each transaction on a chaincode
+		if chaincodeName := getTxChaincodeName(tx); chaincodeName != "" {
+			putIndex(encodeChaincodeTxCompositeKey(chaincodeName, blockNumber, uint64(txIndex)), []byte{})
+		}
+
+		// add (tag,blockNumber,indexWithinBlock) for each application defined tag of the transaction
+		for _, tag := range getTxTags(tx) {
+			putIndex(encodeTxTagCompositeKey(tag, blockNumber, uint64(txIndex)), []byte{})
+		}
+
+		// add (signatureHash,blockNumber,indexWithinBlock) for each signed transaction
+		if indexTxSignatureHashes {
+			if sigHash := txSignatureHash(tx); sigHash != nil {
+				putIndex(encodeTxSignatureHashCompositeKey(sigHash, blockNumber, uint64(txIndex)), []byte{})
+			}
+		}
 	}
+	blockAddresses := make([]string, 0, len(addressToTxIndexesMap))
 	for address, txsIndexes := range addressToTxIndexesMap {
-		writeBatch.PutCF(cf, encodeAddressBlockNumCompositeKey(address, blockNumber), encodeListTxIndexes(txsIndexes))
+		if err := putAddressIndexes(address, blockNumber, txsIndexes, putIndex); err != nil {
+			return err
+		}
+		blockAddresses = append(blockAddresses, address)
+	}
+	// add blockNumber -> address ids, if the addresses are interned
+	if err := putBlockAddressIDs(blockNumber, blockAddresses, batchIDs, putIndex); err != nil {
+		return err
+	}
+	// add blockNumber -> total fee and (address,blockNumber) -> fee
+	putFeeIndexes(block, blockNumber, putIndex)
+	for address, chaincodeIDs := range addressToChaincodeIDsMap {
+		putAddressDigestIfNeeded(address, putIndex)
+		for _, chaincodeID := range chaincodeIDs {
+			chaincodeIDBytes, err := proto.Marshal(chaincodeID)
+			if err != nil {
+				return err
+			}
+			putIndex(encodeAddressChaincodeIDCompositeKey(address, chaincodeIDBytes), []byte{})
+		}
+	}
+	indexLogger.Debugf("Index data for block number [%d]: keys written = [%d], bytes written = [%d]",
+		blockNumber, numKeys, numBytes)
+	if err := appendToIndexWAL(blockNumber, walEntries); err != nil {
+		return err
+	}
+	indexMetrics.blockIndexed(len(transactions))
+	if indexTrackBuildTime {
+		indexMetrics.blockBuildTimed(time.Since(started))
+	}
+	advanceIndexExpiryThreshold(blockNumber, writeBatch)
+	return nil
+}
+
+// putAddressIndexes adds the entries that record the transactions executed by the address in the block:
+// either the (address,blockNumber) -> txIndexes and (blockNumber,address) entries or, if indexAddressLatestBlockOnly
+// is set, the address -> latest block entry. The address digest mapping is added if needed.
+// If indexInternBlockAddresses is set, the (blockNumber,address) entry is replaced by the blockNumber -> address ids
+// entry, which the caller adds for all the addresses of the block (see putBlockAddressIDs)
+func putAddressIndexes(address string, blockNumber uint64, txIndexes []uint64, putIndex func(key []byte, value []byte)) error {
+	if indexAddressLatestBlockOnly {
+		latestBlockNumber, found, err := fetchLatestActivityBlockFromDB(address)
+		if err != nil {
+			return err
+		}
+		// a block indexed again (e.g., a replaced raw block) should not move the latest block backwards
+		if !found || latestBlockNumber <= blockNumber {
+			putIndex(encodeAddressLatestBlockKey(address), encodeBlockNumber(blockNumber))
+		}
+	} else {
+		putAddressTxIndexes(address, blockNumber, txIndexes, putIndex)
+		if !indexInternBlockAddresses {
+			putIndex(encodeBlockNumAddressCompositeKey(blockNumber, address), []byte{})
+		}
+	}
+	putAddressDigestIfNeeded(address, putIndex)
+	return nil
+}
+
+// validateIndexingInputs returns an error if any of the inputs for indexing a block is missing,
+// so that the caller gets a descriptive error instead of a panic while the index entries are being written.
+// The checks are done before any entry is added to the writeBatch. The paths that index a block hash it first, so a
+// block with a nil transaction normally fails to marshal before this point. It is still checked for here, as the
+// blockHash is provided by the caller
+func validateIndexingInputs(block *protos.Block, blockNumber uint64, blockHash []byte,
+	writeBatch *gorocksdb.WriteBatch, cf *gorocksdb.ColumnFamilyHandle) error {
+	switch {
+	case block == nil:
+		return fmt.Errorf("Cannot index block number [%d]. The block is nil", blockNumber)
+	case len(blockHash) == 0:
+		return fmt.Errorf("Cannot index block number [%d]. The block hash is empty", blockNumber)
+	case writeBatch == nil:
+		return fmt.Errorf("Cannot index block number [%d]. The write batch is nil", blockNumber)
+	case cf == nil:
+		return fmt.Errorf("Cannot index block number [%d]. The indexes column family handle is nil", blockNumber)
+	}
+	for txIndex, tx := range block.GetTransactions() {
+		if tx == nil {
+			return fmt.Errorf("Cannot index block number [%d]. The transaction at index [%d] is nil", blockNumber, txIndex)
+		}
+	}
+	return nil
+}
+
+// isBlockIndexed returns true if the block hash is indexed at the given block number
+func isBlockIndexed(blockNumber uint64, blockHash []byte) (bool, error) {
+	blockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockHashKey(blockHash))
+	if err != nil || blockNumberBytes == nil {
+		return false, err
+	}
+	if blockNumberBytes, err = decodeIndexValue(blockNumberBytes); err != nil {
+		return false, err
+	}
+	indexedBlockNumber, err := decodeBlockNumber(blockNumberBytes)
+	if err != nil {
+		return false, err
+	}
+	return indexedBlockNumber == blockNumber, nil
+}
+
+// verifyBlockNumberNotIndexedWithDifferentHash returns an error if the blockNumber -> blockhash index
+// records a hash other than the given one for the block number, unless indexAllowBlockNumberOverwrite is set
+func verifyBlockNumberNotIndexedWithDifferentHash(blockNumber uint64, blockHash []byte) error {
+	if indexAllowBlockNumberOverwrite {
+		return nil
+	}
+	indexedBlockHash, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockNumberKey(blockNumber))
+	if err != nil {
+		return err
+	}
+	if indexedBlockHash == nil {
+		return nil
+	}
+	if indexedBlockHash, err = decodeIndexValue(indexedBlockHash); err != nil {
+		return err
+	}
+	if !bytes.Equal(indexedBlockHash, blockHash) {
+		return fmt.Errorf("Block number [%d] is already indexed with block hash [%x]. Cannot index it with block hash [%x]",
+			blockNumber, indexedBlockHash, blockHash)
+	}
+	return nil
+}
+
+// verifyTxUUIDNotIndexed returns an error if the uuid is already indexed at a location other than the given one,
+// either in the db or within the block being indexed (blockTxUUIDs, which is updated with the given location)
+func verifyTxUUIDNotIndexed(txUUID string, blockNumber uint64, txIndex uint64, blockTxUUIDs map[string]uint64) error {
+	if existingTxIndex, ok := blockTxUUIDs[txUUID]; ok {
+		return fmt.Errorf("Duplicate transaction uuid [%s] at block [%d] index [%d]. Already present at block [%d] index [%d]",
+			txUUID, blockNumber, txIndex, blockNumber, existingTxIndex)
+	}
+	blockTxUUIDs[txUUID] = txIndex
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
+	if err == ErrResourceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if txLocation.BlockNumber != blockNumber || txLocation.TxIndex != txIndex {
+		return fmt.Errorf("Duplicate transaction uuid [%s] at block [%d] index [%d]. Already indexed at block [%d] index [%d]",
+			txUUID, blockNumber, txIndex, txLocation.BlockNumber, txLocation.TxIndex)
+	}
+	return nil
+}
+
+// pruneIndexesBelow removes the index entries of all the blocks below the given block number.
+// Blocks are pruned in batches of batchSize blocks, each committed along with a persisted prune cursor,
+// so that an interrupted prune resumes from the last committed batch instead of rescanning pruned blocks.
+// At most maxBatches batches are committed per call (zero means no limit), which allows a large prune to be
+// spread over multiple calls. The returned bool is true when all the blocks below blockNumber have been pruned
+func pruneIndexesBelow(blockNumber uint64, batchSize uint64, maxBatches int) (bool, error) {
+	if batchSize == 0 {
+		return false, fmt.Errorf("Prune batch size should be greater than zero")
+	}
+	indexMaintenanceLock.Lock()
+	defer indexMaintenanceLock.Unlock()
+	prunedBelow, _, err := pruneStatus()
+	if err != nil {
+		return false, err
+	}
+	openchainDB := db.GetDBHandle()
+	for batches := 0; prunedBelow < blockNumber; batches++ {
+		if maxBatches > 0 && batches == maxBatches {
+			return false, nil
+		}
+		batchEnd := prunedBelow + batchSize
+		if batchEnd > blockNumber || batchEnd < prunedBelow {
+			batchEnd = blockNumber
+		}
+		writeBatch := gorocksdb.NewWriteBatch()
+		for num := prunedBelow; num < batchEnd; num++ {
+			if err := addIndexDeletionsForBlock(num, writeBatch); err != nil {
+				writeBatch.Destroy()
+				return false, err
+			}
+		}
+		writeBatch.PutCF(openchainDB.IndexesCF, encodePruneCursorKey(), encodePruneCursor(batchEnd, blockNumber))
+		opt := gorocksdb.NewDefaultWriteOptions()
+		err := openchainDB.DB.Write(opt, writeBatch)
+		opt.Destroy()
+		writeBatch.Destroy()
+		if err != nil {
+			return false, err
+		}
+		indexLogger.Debugf("Pruned indexes of blocks [%d] to [%d]", prunedBelow, batchEnd-1)
+		prunedBelow = batchEnd
+	}
+	return true, nil
+}
+
+// pruneStatus returns the block number below which the indexes have been pruned
+// and the target block number of the latest prune
+func pruneStatus() (prunedBelow uint64, targetBlockNumber uint64, err error) {
+	cursorBytes, err := db.GetDBHandle().GetFromIndexesCF(encodePruneCursorKey())
+	if err != nil || cursorBytes == nil {
+		return
+	}
+	return decodePruneCursor(cursorBytes)
+}
+
+// addIndexDeletionsForBlock adds to the writeBatch the deletion of the index entries that belong to the given block.
+// Entries shared by multiple blocks (address -> chaincodeID) and the cumulative transaction counts, which later
+// blocks build upon, are retained. A tombstone is written for each deleted entry if indexSoftDeletes is set
+func addIndexDeletionsForBlock(blockNumber uint64, writeBatch *gorocksdb.WriteBatch) error {
+	block, err := fetchBlockFromDB(blockNumber)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return nil
+	}
+	return forEachBlockIndexKey(block, blockNumber, func(key []byte) {
+		deleteIndexEntry(writeBatch, key)
+	})
+}
+
+// forEachBlockIndexKey invokes fn with the key of each index entry that belongs to the given block
+// (see addIndexDeletionsForBlock). The keys are reconstructed from the block, so some of them may not be present in the index
+func forEachBlockIndexKey(block *protos.Block, blockNumber uint64, fn func(key []byte)) error {
+	blockHash, err := computeBlockHash(block)
+	if err != nil {
+		return err
+	}
+	fn(encodeBlockHashKey(blockHash))
+	fn(encodeBlockNumberKey(blockNumber))
+	fn(encodeBlockTxCountKey(blockNumber))
+	fn(encodeBlockTotalFeeKey(blockNumber))
+	_, addressFees := blockFees(block)
+	for address := range addressFees {
+		fn(encodeAddressBlockFeeCompositeKey(address, blockNumber))
+	}
+	if timestamp := block.GetTimestamp(); timestamp != nil {
+		fn(encodeBlockTimestampKey(blockNumber))
+		fn(encodeTimestampBlockNumCompositeKey(timestamp.Seconds, blockNumber))
+	}
+	if blockNumber > 0 {
+		fn(encodePreviousBlockHashKey(blockNumber))
+	}
+	if proposer := getBlockProposer(block); proposer != "" {
+		fn(encodeProposerBlockNumCompositeKey(proposer, blockNumber))
+	}
+	addressTxCounts := make(map[string]int)
+	for txIndex, tx := range block.GetTransactions() {
+		txUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return err
+		}
+		// the uuid may have been indexed again by a later block
+		txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
+		if err == nil && txLocation.BlockNumber == blockNumber {
+			fn(encodeTxUUIDKey(txUUID))
+			fn(encodeTxExecutingAddressesKey(txUUID))
+		}
+		fn(encodeTxSizeKey(uint64(proto.Size(tx)), blockNumber, uint64(txIndex)))
+		fn(encodeTxTypeCompositeKey(tx.Type, blockNumber, uint64(txIndex)))
+		for _, referencedTxUUID := range getTxReferencedUUIDs(tx) {
+			fn(encodeTxReferenceCompositeKey(referencedTxUUID, txUUID))
+		}
+		for metadataKey, metadataValue := range getTxMetadataEntries(tx) {
+			fn(encodeTxMetadataCompositeKey(metadataKey, metadataValue, blockNumber, uint64(txIndex)))
+		}
+		if chaincodeID := getDeployedChaincodeID(tx); chaincodeID != nil {
+			fn(encodeChaincodeHistoryCompositeKey(chaincodeID.Path, blockNumber, uint64(txIndex)))
+		}
+		if chaincodeName := getTxChaincodeName(tx); chaincodeName != "" {
+			fn(encodeChaincodeTxCompositeKey(chaincodeName, blockNumber, uint64(txIndex)))
+		}
+		for _, tag := range getTxTags(tx) {
+			fn(encodeTxTagCompositeKey(tag, blockNumber, uint64(txIndex)))
+		}
+		if indexTxSignatureHashes {
+			if sigHash := txSignatureHash(tx); sigHash != nil {
+				fn(encodeTxSignatureHashCompositeKey(sigHash, blockNumber, uint64(txIndex)))
+			}
+		}
+		for _, address := range getTxExecutingAddresses(tx) {
+			addressTxCounts[address]++
+		}
+	}
+	for address, txCount := range addressTxCounts {
+		key := encodeAddressBlockNumCompositeKey(address, blockNumber)
+		fn(key)
+		for i := 0; i < numAddressTxIndexesContinuations(txCount); i++ {
+			fn(encodeAddressTxIndexesContinuationKey(key, uint64(i)))
+		}
+		if !indexInternBlockAddresses {
+			fn(encodeBlockNumAddressCompositeKey(blockNumber, address))
+		}
+	}
+	if indexInternBlockAddresses && len(addressTxCounts) > 0 {
+		fn(encodeBlockAddressIDsKey(blockNumber))
 	}
 	return nil
 }
 
+// repairOrphanedAddressEntries deletes the address composite entries (and their continuation entries) that refer to a block
+// which is not present in the blockNumber -> blockhash index and returns the number of entries deleted
+func repairOrphanedAddressEntries() (uint64, error) {
+	openchainDB := db.GetDBHandle()
+	itr := newIndexIterator(prefixAddressBlockNumCompositeKey)
+	defer itr.Close()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+
+	// the block numbers of the entries of an address are ascending, so the blockNumber keys are looked up
+	// with a forward cursor rather than with random reads
+	blockNumberCursor := newIndexKeyCursor()
+	defer blockNumberCursor.close()
+	continuationItr := newIndexIterator(prefixAddressTxIndexesContinuationKey)
+	defer continuationItr.Close()
+
+	var repaired uint64
+	prefix := newIndexKey(prefixAddressBlockNumCompositeKey)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		key := statemgmt.Copy(itr.Key().Data())
+		address, blockNumber, err := decodeAddressBlockNumCompositeKey(key)
+		if err != nil {
+			return 0, err
+		}
+		if !blockNumberCursor.exists(encodeBlockNumberKey(blockNumber)) {
+			indexLogger.Debugf("Deleting orphaned entry for address [%s] and block number [%d]", address, blockNumber)
+			writeBatch.DeleteCF(indexCFForKey(key), key)
+			repaired++
+			continuationPrefix := encodeAddressTxIndexesContinuationKeyPrefix(key)
+			for continuationItr.Seek(continuationPrefix); continuationItr.ValidForPrefix(continuationPrefix); continuationItr.Next() {
+				continuationKey := statemgmt.Copy(continuationItr.Key().Data())
+				writeBatch.DeleteCF(indexCFForKey(continuationKey), continuationKey)
+				repaired++
+			}
+		}
+	}
+	if repaired == 0 {
+		return 0, nil
+	}
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+		return 0, err
+	}
+	return repaired, nil
+}
+
+// computeBlockHash computes the hash of the block, excluding the non-hash data, using the indexHasher
+func computeBlockHash(block *protos.Block) ([]byte, error) {
+	blockCopy := *block
+	blockCopy.NonHashData = nil
+	blockBytes, err := proto.Marshal(&blockCopy)
+	if err != nil {
+		return nil, fmt.Errorf("Could not calculate hash of block: %s", err)
+	}
+	return indexHasher.Hash(blockBytes), nil
+}
+
+// getTxUUIDForIndex returns the uuid under which the transaction is indexed. This is the uuid of the transaction
+// if it is set. Otherwise, the uuid is derived from the content of the transaction as the hex encoded indexHasher hash
+// of the canonically marshalled transaction, so that the derived uuid is the same every time (and on every peer)
+// the transaction is indexed. Two transactions without a uuid and with identical content get the same derived uuid.
+// An error is returned for a nil transaction
+func getTxUUIDForIndex(tx *protos.Transaction) (string, error) {
+	if tx == nil {
+		return "", fmt.Errorf("Could not derive uuid of transaction. The transaction is nil")
+	}
+	if tx.Uuid != "" {
+		return tx.Uuid, nil
+	}
+	txBytes, err := canonicalMarshalTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("Could not derive uuid of transaction: %s", err)
+	}
+	return fmt.Sprintf("%x", indexHasher.Hash(txBytes)), nil
+}
+
+// canonicalMarshalTransaction returns the serialization of the transaction to be hashed. The fields are written in
+// field number order and Transaction has no map fields (whose order proto.Marshal does not fix), so the serialization
+// is deterministic as long as equal transactions have equal fields. The only field for which that does not hold is the
+// timestamp: a set but zero timestamp is marshalled as an empty message while a nil one is omitted, so a zero
+// timestamp is dropped before marshalling. The transaction itself is not modified
+func canonicalMarshalTransaction(tx *protos.Transaction) ([]byte, error) {
+	txCopy := *tx
+	if timestamp := txCopy.Timestamp; timestamp != nil && timestamp.Seconds == 0 && timestamp.Nanos == 0 {
+		txCopy.Timestamp = nil
+	}
+	return proto.Marshal(&txCopy)
+}
+
 func fetchBlockNumberByBlockHashFromDB(blockHash []byte) (uint64, error) {
 	indexLogger.Debugf("fetchBlockNumberByBlockHashFromDB() for blockhash [%x]", blockHash)
 	blockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockHashKey(blockHash))
@@ -122,98 +781,2008 @@ func fetchBlockNumberByBlockHashFromDB(blockHash []byte) (uint64, error) {
 	if len(blockNumberBytes) == 0 {
 		return 0, newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No block indexed with block hash [%x]", blockHash))
 	}
-	blockNumber := decodeBlockNumber(blockNumberBytes)
-	return blockNumber, nil
+	if blockNumberBytes, err = decodeIndexValue(blockNumberBytes); err != nil {
+		return 0, err
+	}
+	return decodeBlockNumber(blockNumberBytes)
 }
 
-func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
+// fetchPreviousBlockHash returns the hash of the parent of the given block as recorded in the block, without loading
+// the block. It returns nil for the genesis block, which has no parent
+func fetchPreviousBlockHash(blockNumber uint64) ([]byte, error) {
+	if blockNumber == 0 {
+		return nil, nil
+	}
+	previousBlockHash, err := db.GetDBHandle().GetFromIndexesCF(encodePreviousBlockHashKey(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+	if len(previousBlockHash) == 0 {
+		return nil, newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No previous block hash indexed for block number [%d]", blockNumber))
+	}
+	return decodeIndexValue(previousBlockHash)
+}
+
+func fetchTransactionLocationByUUIDFromDB(txUUID string) (*TransactionLocation, error) {
 	blockNumTxIndexBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeTxUUIDKey(txUUID))
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 	if blockNumTxIndexBytes == nil {
-		return 0, 0, ErrResourceNotFound
+		return nil, ErrResourceNotFound
+	}
+	if blockNumTxIndexBytes, err = decodeIndexValue(blockNumTxIndexBytes); err != nil {
+		return nil, err
+	}
+	blockNumber, txIndex, err := decodeBlockNumTxIndex(blockNumTxIndexBytes)
+	if err != nil {
+		return nil, err
 	}
-	return decodeBlockNumTxIndex(blockNumTxIndexBytes)
+	return &TransactionLocation{blockNumber, txIndex}, nil
 }
 
-func getTxExecutingAddress(tx *protos.Transaction) string {
-	// TODO Fetch address form tx
-	return "address1"
+// fetchExecutingAddresses returns the addresses that executed the given transaction, without loading the transaction
+func fetchExecutingAddresses(txUUID string) ([]string, error) {
+	addressesBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeTxExecutingAddressesKey(txUUID))
+	if err != nil {
+		return nil, err
+	}
+	if addressesBytes == nil {
+		return nil, ErrResourceNotFound
+	}
+	if addressesBytes, err = decodeIndexValue(addressesBytes); err != nil {
+		return nil, err
+	}
+	return decodeAddressList(addressesBytes)
 }
 
-func getAuthorisedAddresses(tx *protos.Transaction) ([]string, *protos.ChaincodeID) {
-	// TODO fetch address from chaincode deployment tx
-	// TODO this method should also return error
-	data := tx.ChaincodeID
-	cID := &protos.ChaincodeID{}
-	err := proto.Unmarshal(data, cID)
+// fetchTransactionIndexByUUIDFromDB returns the block number and the index within the block of the transaction.
+// Deprecated: use fetchTransactionLocationByUUIDFromDB, whose result cannot be confused for (txIndex, blockNumber)
+func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
 	if err != nil {
-		return nil, nil
+		return 0, 0, err
 	}
-	return []string{"address1", "address2"}, cID
+	return txLocation.BlockNumber, txLocation.TxIndex, nil
 }
 
-// functions for encoding/decoding db keys/values for index data
-// encode / decode BlockNumber
-func encodeBlockNumber(blockNumber uint64) []byte {
-	return proto.EncodeVarint(blockNumber)
+// TransactionLocation identifies a transaction by its block number and index within the block
+type TransactionLocation struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	TxIndex     uint64 `json:"txIndex"`
 }
 
-func decodeBlockNumber(blockNumberBytes []byte) (blockNumber uint64) {
-	blockNumber, _ = proto.DecodeVarint(blockNumberBytes)
-	return
+// txLocationsByBlock is the result of fetchTransactionLocationsByUUIDs
+type txLocationsByBlock struct {
+	// Locations maps each uuid that is found to its location
+	Locations map[string]*TransactionLocation
+	// BlockNumbers are the distinct blocks of the found uuids, in ascending order
+	BlockNumbers []uint64
+	// TxUUIDsByBlock are the found uuids of each block, ordered by their index within the block
+	TxUUIDsByBlock map[uint64][]string
+	// NotFound are the uuids that are not indexed, in the order requested
+	NotFound []string
 }
 
-// encode / decode BlockNumTxIndex
-func encodeBlockNumTxIndex(blockNumber uint64, txIndexInBlock uint64) []byte {
-	b := proto.NewBuffer([]byte{})
-	b.EncodeVarint(blockNumber)
-	b.EncodeVarint(txIndexInBlock)
-	return b.Bytes()
-}
+// fetchTransactionLocationsByUUIDs looks up the locations of many transactions at once, e.g., for a batch receipt,
+// and groups them by block so that the caller can load each block once. The gorocksdb binding has no MultiGet,
+// so the uuids are read one by one from a single snapshot, which gives all the lookups the same view of the index.
+// A uuid requested more than once is looked up once
+func fetchTransactionLocationsByUUIDs(txUUIDs []string) (*txLocationsByBlock, error) {
+	openchainDB := db.GetDBHandle()
+	snapshot := openchainDB.GetSnapshot()
+	defer snapshot.Release()
 
-func decodeBlockNumTxIndex(bytes []byte) (blockNum uint64, txIndex uint64, err error) {
-	b := proto.NewBuffer(bytes)
-	blockNum, err = b.DecodeVarint()
-	if err != nil {
-		return
+	result := &txLocationsByBlock{
+		Locations:      make(map[string]*TransactionLocation),
+		TxUUIDsByBlock: make(map[uint64][]string),
 	}
-	txIndex, err = b.DecodeVarint()
-	if err != nil {
-		return
+	var found []string
+	requested := make(map[string]bool)
+	for _, txUUID := range txUUIDs {
+		if requested[txUUID] {
+			continue
+		}
+		requested[txUUID] = true
+		blockNumTxIndexBytes, err := openchainDB.GetFromIndexesCFSnapshot(snapshot, encodeTxUUIDKey(txUUID))
+		if err != nil {
+			return nil, err
+		}
+		if blockNumTxIndexBytes == nil {
+			result.NotFound = append(result.NotFound, txUUID)
+			continue
+		}
+		if blockNumTxIndexBytes, err = decodeIndexValue(blockNumTxIndexBytes); err != nil {
+			return nil, err
+		}
+		blockNumber, txIndex, err := decodeBlockNumTxIndex(blockNumTxIndexBytes)
+		if err != nil {
+			return nil, err
+		}
+		result.Locations[txUUID] = &TransactionLocation{blockNumber, txIndex}
+		found = append(found, txUUID)
 	}
-	return
+	sort.Sort(txUUIDsByLocation{found, result.Locations})
+	for _, txUUID := range found {
+		blockNumber := result.Locations[txUUID].BlockNumber
+		if _, ok := result.TxUUIDsByBlock[blockNumber]; !ok {
+			result.BlockNumbers = append(result.BlockNumbers, blockNumber)
+		}
+		result.TxUUIDsByBlock[blockNumber] = append(result.TxUUIDsByBlock[blockNumber], txUUID)
+	}
+	return result, nil
 }
 
-// encode BlockHashKey
-func encodeBlockHashKey(blockHash []byte) []byte {
-	return prependKeyPrefix(prefixBlockHashKey, blockHash)
+// txUUIDsByLocation sorts uuids by the block number and then by the index within the block of their locations
+type txUUIDsByLocation struct {
+	txUUIDs   []string
+	locations map[string]*TransactionLocation
 }
 
-// encode TxUUIDKey
-func encodeTxUUIDKey(txUUID string) []byte {
-	return prependKeyPrefix(prefixTxUUIDKey, []byte(txUUID))
+func (s txUUIDsByLocation) Len() int {
+	return len(s.txUUIDs)
 }
 
-func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byte {
-	b := proto.NewBuffer([]byte{prefixAddressBlockNumCompositeKey})
-	b.EncodeRawBytes([]byte(address))
-	b.EncodeVarint(blockNumber)
-	return b.Bytes()
+func (s txUUIDsByLocation) Less(i, j int) bool {
+	li, lj := s.locations[s.txUUIDs[i]], s.locations[s.txUUIDs[j]]
+	if li.BlockNumber != lj.BlockNumber {
+		return li.BlockNumber < lj.BlockNumber
+	}
+	return li.TxIndex < lj.TxIndex
 }
 
-func encodeListTxIndexes(listTx []uint64) []byte {
-	b := proto.NewBuffer([]byte{})
-	for i := range listTx {
-		b.EncodeVarint(listTx[i])
-	}
-	return b.Bytes()
+func (s txUUIDsByLocation) Swap(i, j int) {
+	s.txUUIDs[i], s.txUUIDs[j] = s.txUUIDs[j], s.txUUIDs[i]
 }
 
-func prependKeyPrefix(prefix byte, key []byte) []byte {
-	modifiedKey := []byte{}
-	modifiedKey = append(modifiedKey, prefix)
-	modifiedKey = append(modifiedKey, key...)
-	return modifiedKey
+// fetchTransactionsBySizeRange returns the transactions whose serialized size in bytes
+// lies within [minBytes, maxBytes], ordered by size
+func fetchTransactionsBySizeRange(minBytes uint64, maxBytes uint64, limits scanLimits) ([]*TransactionLocation, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []*TransactionLocation
+	prefix := newIndexKey(prefixTxSizeKey)
+	for itr.Seek(encodeTxSizeKeyPrefix(minBytes)); itr.ValidForPrefix(prefix); itr.Next() {
+		txSize, err := decodeTxSizeKey(itr.Key().Data())
+		if err != nil {
+			return nil, false, err
+		}
+		if txSize > maxBytes {
+			break
+		}
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		value, err := decodeIndexValue(statemgmt.Copy(itr.Value().Data()))
+		if err != nil {
+			return nil, false, err
+		}
+		blockNumber, txIndex, err := decodeBlockNumTxIndex(value)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, &TransactionLocation{blockNumber, txIndex})
+	}
+	return result, false, nil
+}
+
+// fetchTransactionsByMetadata returns, in chain order, the transactions that carry the given metadata key with the given value
+func fetchTransactionsByMetadata(key string, value string, limits scanLimits) ([]*TransactionLocation, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []*TransactionLocation
+	truncated := false
+	prefix := encodeTxMetadataKeyPrefix(key, value)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.deadlineExceeded() {
+			truncated = true
+			break
+		}
+		indexValue, err := decodeIndexValue(statemgmt.Copy(itr.Value().Data()))
+		if err != nil {
+			return nil, false, err
+		}
+		blockNumber, txIndex, err := decodeBlockNumTxIndex(indexValue)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, &TransactionLocation{blockNumber, txIndex})
+	}
+	// the varint encoded (blockNumber,indexWithinBlock) in the keys do not iterate in numeric order, so all the
+	// entries are collected and sorted before trimming to maxResults, which keeps the earliest transactions
+	sort.Sort(transactionLocations(result))
+	if len(result) > limits.maxResults {
+		result = result[:limits.maxResults]
+		truncated = true
+	}
+	return result, truncated, nil
+}
+
+// fetchTypeBlockRange returns the first and the last block in which a transaction of the given type appears.
+// ErrResourceNotFound is returned if no transaction of the given type has been indexed
+func fetchTypeBlockRange(txType protos.Transaction_Type) (firstBlock uint64, lastBlock uint64, err error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	prefix := encodeTxTypeKeyPrefix(txType)
+	itr.Seek(prefix)
+	if !itr.ValidForPrefix(prefix) {
+		return 0, 0, ErrResourceNotFound
+	}
+	if _, firstBlock, _, err = decodeTxTypeCompositeKey(itr.Key().Data()); err != nil {
+		return 0, 0, err
+	}
+
+	seekToLastWithKeyPrefix(itr, prefix)
+	if _, lastBlock, _, err = decodeTxTypeCompositeKey(itr.Key().Data()); err != nil {
+		return 0, 0, err
+	}
+	return firstBlock, lastBlock, nil
+}
+
+// fetchTransactionIndexesByTypeInBlock returns the indexes within the block of the transactions of the given type, in ascending order.
+// The (txType,blockNumber,txIndex) keys of a block are contiguous, so this is a prefix scan on (txType,blockNumber)
+// and the block itself is not loaded
+func fetchTransactionIndexesByTypeInBlock(blockNumber uint64, txType protos.Transaction_Type, limits scanLimits) ([]uint64, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var txIndexes []uint64
+	prefix := append(encodeTxTypeKeyPrefix(txType), encodeIndexUint64(blockNumber)...)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(txIndexes)) {
+			return txIndexes, true, nil
+		}
+		_, _, txIndex, err := decodeTxTypeCompositeKey(itr.Key().Data())
+		if err != nil {
+			return nil, false, err
+		}
+		txIndexes = append(txIndexes, txIndex)
+	}
+	return txIndexes, false, nil
+}
+
+// fetchTransactionIndexesByTypeInRange returns, in chain order, the (blockNumber, txIndex) of the transactions of the given type
+// in the blocks [startBlock, endBlock]. The scan starts at the (txType,startBlock) key and stops at the (txType,endBlock+1) key,
+// so the entries of the blocks outside the range are not read
+func fetchTransactionIndexesByTypeInRange(txType protos.Transaction_Type, startBlock uint64, endBlock uint64,
+	limits scanLimits) ([]*TransactionLocation, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	if startBlock > endBlock {
+		return nil, false, fmt.Errorf("Invalid block range [%d, %d]", startBlock, endBlock)
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []*TransactionLocation
+	prefix := encodeTxTypeKeyPrefix(txType)
+	var upperBound []byte
+	if endBlock < math.MaxUint64 {
+		upperBound = append(encodeTxTypeKeyPrefix(txType), encodeIndexUint64(endBlock+1)...)
+	}
+	for itr.Seek(append(encodeTxTypeKeyPrefix(txType), encodeIndexUint64(startBlock)...)); itr.ValidForPrefix(prefix); itr.Next() {
+		if upperBound != nil && bytes.Compare(itr.Key().Data(), upperBound) >= 0 {
+			break
+		}
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		_, blockNumber, txIndex, err := decodeTxTypeCompositeKey(itr.Key().Data())
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, &TransactionLocation{blockNumber, txIndex})
+	}
+	return result, false, nil
+}
+
+// fetchTransactionIndexesByAddress returns the (blockNumber, txIndex) of the transactions executed by the given address, in chain order.
+// The results are sorted explicitly, as the varint encoded block numbers in the keys do not iterate in numeric order
+func fetchTransactionIndexesByAddress(address string, limits scanLimits) ([]*TransactionLocation, bool, error) {
+	var result []*TransactionLocation
+	truncated, err := forEachAddressTxIndexes(address, limits, func(blockNumber uint64, txIndexes []uint64) (bool, error) {
+		for _, txIndex := range txIndexes {
+			result = append(result, &TransactionLocation{blockNumber, txIndex})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	// all the entries are collected before trimming to maxResults, so that the earliest transactions are kept
+	sort.Sort(transactionLocations(result))
+	if len(result) > limits.maxResults {
+		result = result[:limits.maxResults]
+		truncated = true
+	}
+	return result, truncated, nil
+}
+
+// forEachAddressTxIndexes calls fn with the tx indexes of each (address,blockNumber) entry of the given address,
+// including the continuation entries, in the key order. The scan stops when fn returns false or when the deadline
+// of the limits is exceeded, in both cases truncated is returned true. maxResults is left to fn, that knows what
+// it counts as a result
+func forEachAddressTxIndexes(address string, limits scanLimits,
+	fn func(blockNumber uint64, txIndexes []uint64) (bool, error)) (truncated bool, err error) {
+	if err := limits.validate(); err != nil {
+		return false, err
+	}
+	indexAddressRebuildLock.RLock()
+	defer indexAddressRebuildLock.RUnlock()
+	itr := newIndexIterator(prefixAddressBlockNumCompositeKey)
+	defer itr.Close()
+	var continuationItr *gorocksdb.Iterator
+	defer func() {
+		if continuationItr != nil {
+			continuationItr.Close()
+		}
+	}()
+
+	prefix := encodeAddressKeyPrefix(address)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.deadlineExceeded() {
+			return true, nil
+		}
+		key := statemgmt.Copy(itr.Key().Data())
+		_, blockNumber, err := decodeAddressBlockNumCompositeKey(key)
+		if err != nil {
+			return false, err
+		}
+		value, err := decodeIndexValue(statemgmt.Copy(itr.Value().Data()))
+		if err != nil {
+			return false, err
+		}
+		txIndexes, err := decodeListTxIndexes(value)
+		if err != nil {
+			return false, err
+		}
+		if hasAddressTxIndexesContinuations(txIndexes) {
+			if continuationItr == nil {
+				continuationItr = newIndexIterator(prefixAddressTxIndexesContinuationKey)
+			}
+			continuationTxIndexes, err := fetchAddressTxIndexesContinuations(continuationItr, key)
+			if err != nil {
+				return false, err
+			}
+			txIndexes = append(txIndexes, continuationTxIndexes...)
+		}
+		next, err := fn(blockNumber, txIndexes)
+		if err != nil {
+			return false, err
+		}
+		if !next {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// countBlocksForAddress returns the number of blocks in which the given address executed transactions. It counts
+// the (address,blockNumber) keys without reading their values, which is cheaper than fetchTransactionIndexesByAddress
+// when only the number of blocks is needed
+func countBlocksForAddress(address string) (uint64, error) {
+	indexAddressRebuildLock.RLock()
+	defer indexAddressRebuildLock.RUnlock()
+	itr := newIndexIterator(prefixAddressBlockNumCompositeKey)
+	defer itr.Close()
+	return countKeysWithPrefix(itr, encodeAddressKeyPrefix(address))
+}
+
+// countKeysWithPrefix returns the number of keys with the given prefix that the iterator sees
+func countKeysWithPrefix(itr *gorocksdb.Iterator, prefix []byte) (uint64, error) {
+	var count uint64
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		count++
+	}
+	return count, itr.Err()
+}
+
+// transactionLocations sorts transaction locations in chain order - by block number and then by tx index
+type transactionLocations []*TransactionLocation
+
+func (locations transactionLocations) Len() int {
+	return len(locations)
+}
+
+func (locations transactionLocations) Swap(i, j int) {
+	locations[i], locations[j] = locations[j], locations[i]
+}
+
+func (locations transactionLocations) Less(i, j int) bool {
+	if locations[i].BlockNumber != locations[j].BlockNumber {
+		return locations[i].BlockNumber < locations[j].BlockNumber
+	}
+	return locations[i].TxIndex < locations[j].TxIndex
+}
+
+// listValueLockStripes is the number of locks that the keys of the list values are striped across
+const listValueLockStripes = 64
+
+// listValueLocks serializes the read-modify-write of the list values (see appendToListValue).
+// Keys are mapped to a fixed set of locks, so unrelated keys may occasionally share a lock
+var listValueLocks [listValueLockStripes]sync.Mutex
+
+func listValueLock(key []byte) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write(key)
+	return &listValueLocks[h.Sum32()%listValueLockStripes]
+}
+
+// appendToListValue adds the given tx indexes to the list of tx indexes stored at key and writes the merged list,
+// deduplicated and in ascending order, directly to the db. Unlike addIndexDataForPersistence, which writes the
+// complete lists built for a block in a single batch, this reads the persisted list first and hence holds the lock
+// of the key until the merged list is written, so that concurrent appends to the same key do not lose updates.
+// The continuation entries of an (address,blockNumber) list are read and rewritten along with it.
+// putRelated, if not nil, adds entries to be written in the same batch as the list
+func appendToListValue(key []byte, newIndexes []uint64, putRelated func(putIndex func(key []byte, value []byte)) error) error {
+	indexWriteLock.RLock()
+	defer indexWriteLock.RUnlock()
+	lock := listValueLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	existingBytes, err := getIndexValue(key)
+	if err != nil {
+		return err
+	}
+	if existingBytes, err = decodeIndexValue(existingBytes); err != nil {
+		return err
+	}
+	existingIndexes, err := decodeListTxIndexes(existingBytes)
+	if err != nil {
+		return err
+	}
+	hasContinuations := key[indexKeyHeaderLength()-1] == prefixAddressBlockNumCompositeKey
+	if hasContinuations && hasAddressTxIndexesContinuations(existingIndexes) {
+		continuationItr := newIndexIterator(prefixAddressTxIndexesContinuationKey)
+		continuationIndexes, err := fetchAddressTxIndexesContinuations(continuationItr, key)
+		continuationItr.Close()
+		if err != nil {
+			return err
+		}
+		existingIndexes = append(existingIndexes, continuationIndexes...)
+	}
+	present := make(map[uint64]bool)
+	var mergedIndexes []uint64
+	for _, indexes := range [][]uint64{existingIndexes, newIndexes} {
+		for _, index := range indexes {
+			if !present[index] {
+				mergedIndexes = append(mergedIndexes, index)
+				present[index] = true
+			}
+		}
+	}
+	sort.Sort(ascendingTxIndexes(mergedIndexes))
+
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	putIndex := func(key []byte, value []byte) {
+		writeBatch.PutCF(indexCFForKey(key), key, value)
+	}
+	if hasContinuations {
+		// the merged list only grows, so rewriting it overwrites all the existing continuation entries
+		putListTxIndexes(key, mergedIndexes, putIndex)
+	} else {
+		putIndex(key, encodeIndexValue(encodeListTxIndexes(mergedIndexes)))
+	}
+	if putRelated != nil {
+		if err := putRelated(putIndex); err != nil {
+			return err
+		}
+	}
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return db.GetDBHandle().DB.Write(opt, writeBatch)
+}
+
+// appendAddressTxIndexes adds the given tx indexes to the list of tx indexes of the address within the block
+// (see appendToListValue), along with the entries that record the address for the block
+func appendAddressTxIndexes(address string, blockNumber uint64, txIndexes []uint64) error {
+	if indexInternBlockAddresses {
+		// the address ids entry of the block is also read and rewritten, in the batch of the list
+		blockAddressIDsLock.Lock()
+		defer blockAddressIDsLock.Unlock()
+	}
+	key := encodeAddressBlockNumCompositeKey(address, blockNumber)
+	return appendToListValue(key, txIndexes, func(putIndex func(key []byte, value []byte)) error {
+		if indexInternBlockAddresses {
+			if err := appendBlockAddressID(blockNumber, address, putIndex); err != nil {
+				return err
+			}
+		} else {
+			putIndex(encodeBlockNumAddressCompositeKey(blockNumber, address), []byte{})
+		}
+		putAddressDigestIfNeeded(address, putIndex)
+		return nil
+	})
+}
+
+// fetchAddressesInBlock returns the addresses that executed transactions in the given block.
+// The address -> blockNumber composite keys are ordered by address and would require a scan of all of them,
+// so this scans the (blockNumber, address) entries of the block instead, which are written along with them.
+// The addresses that are replaced by their digest in the keys are resolved to the full address, if stored.
+// If indexInternBlockAddresses is set, the addresses are read from the address ids entry of the block instead
+func fetchAddressesInBlock(blockNumber uint64, limits scanLimits) ([]string, bool, error) {
+	indexAddressRebuildLock.RLock()
+	defer indexAddressRebuildLock.RUnlock()
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	if indexInternBlockAddresses {
+		return fetchInternedAddressesInBlock(blockNumber, limits)
+	}
+	itr := newIndexIterator(prefixBlockNumAddressCompositeKey)
+	defer itr.Close()
+
+	var addresses []string
+	prefix := encodeBlockNumAddressKeyPrefix(blockNumber)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(addresses)) {
+			return addresses, true, nil
+		}
+		keyAddress, err := proto.NewBuffer(statemgmt.Copy(itr.Key().Data()[len(prefix):])).DecodeRawBytes(false)
+		if err != nil {
+			return nil, false, err
+		}
+		address, err := resolveKeyAddress(string(keyAddress))
+		if err != nil {
+			return nil, false, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, false, nil
+}
+
+// isAddressHashedInKeys returns true if the address is longer than indexMaxAddressLength
+func isAddressHashedInKeys(address string) bool {
+	return indexMaxAddressLength > 0 && len(address) > indexMaxAddressLength
+}
+
+// addressKeyForm returns the form of the address that is used in the address keys, i.e., the address itself
+// or, if the address is longer than indexMaxAddressLength, its digest
+func addressKeyForm(address string) string {
+	if !isAddressHashedInKeys(address) {
+		return address
+	}
+	return string(indexHasher.Hash([]byte(address)))
+}
+
+// putAddressDigestIfNeeded adds the digest -> full address entry if the address is replaced by its digest in the keys.
+// These entries are not tied to a block and hence are retained when the indexes of a block are pruned
+func putAddressDigestIfNeeded(address string, putIndex func(key []byte, value []byte)) {
+	if indexStoreFullAddresses && isAddressHashedInKeys(address) {
+		putIndex(encodeAddressDigestKey(addressKeyForm(address)), []byte(address))
+	}
+}
+
+// resolveKeyAddress returns the full address for an address decoded from an address key.
+// The address is returned as is if it is not a digest with a stored mapping
+func resolveKeyAddress(keyAddress string) (string, error) {
+	fullAddress, err := db.GetDBHandle().GetFromIndexesCF(encodeAddressDigestKey(keyAddress))
+	if err != nil {
+		return "", err
+	}
+	if fullAddress == nil {
+		return keyAddress, nil
+	}
+	return string(fullAddress), nil
+}
+
+// fetchLatestActivityBlock returns the latest block in which the given address executed a transaction.
+// This is maintained only if indexAddressLatestBlockOnly is set. ErrResourceNotFound is returned if the address has not transacted
+func fetchLatestActivityBlock(address string) (uint64, error) {
+	indexAddressRebuildLock.RLock()
+	defer indexAddressRebuildLock.RUnlock()
+	blockNumber, found, err := fetchLatestActivityBlockFromDB(address)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, ErrResourceNotFound
+	}
+	return blockNumber, nil
+}
+
+func fetchLatestActivityBlockFromDB(address string) (blockNumber uint64, found bool, err error) {
+	blockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeAddressLatestBlockKey(address))
+	if err != nil || blockNumberBytes == nil {
+		return 0, false, err
+	}
+	if blockNumber, err = decodeBlockNumber(blockNumberBytes); err != nil {
+		return 0, false, err
+	}
+	return blockNumber, true, nil
+}
+
+// fetchBlocksByProposer returns, in ascending order, the numbers of the blocks proposed by the given address
+func fetchBlocksByProposer(address string, limits scanLimits) ([]uint64, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var blockNumbers []uint64
+	prefix := encodeProposerKeyPrefix(address)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(blockNumbers)) {
+			return blockNumbers, true, nil
+		}
+		blockNumber, err := decodeUint64At(itr.Key().Data(), len(prefix))
+		if err != nil {
+			return nil, false, err
+		}
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	return blockNumbers, false, nil
+}
+
+// fetchTransactionIndexesByAddressAndTimeRange returns the transactions executed by the given address
+// with a timestamp (in seconds) within [start, end). Transaction timestamps are not indexed, so every
+// block in which the address transacted is loaded to read the timestamps. The cost is hence proportional
+// to the number of blocks the address appears in, irrespective of the width of the time range. maxResults
+// applies to the transactions within the time range, so only the deadline of the limits bounds the cost
+func fetchTransactionIndexesByAddressAndTimeRange(address string, start int64, end int64,
+	limits scanLimits) ([]*TransactionLocation, bool, error) {
+	var result []*TransactionLocation
+	truncated, err := forEachAddressTxIndexes(address, limits, func(blockNumber uint64, txIndexes []uint64) (bool, error) {
+		block, err := fetchBlockFromDB(blockNumber)
+		if err != nil {
+			return false, err
+		}
+		if block == nil {
+			return false, fmt.Errorf("Block [%d] referred by the index is not found", blockNumber)
+		}
+		transactions := block.GetTransactions()
+		for _, txIndex := range txIndexes {
+			if txIndex >= uint64(len(transactions)) {
+				return false, fmt.Errorf("Transaction index [%d] referred by the index is out of range for block [%d]", txIndex, blockNumber)
+			}
+			timestamp := transactions[txIndex].GetTimestamp()
+			if timestamp != nil && timestamp.Seconds >= start && timestamp.Seconds < end {
+				result = append(result, &TransactionLocation{blockNumber, txIndex})
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Sort(transactionLocations(result))
+	if len(result) > limits.maxResults {
+		result = result[:limits.maxResults]
+		truncated = true
+	}
+	return result, truncated, nil
+}
+
+// fetchHighestIndexedBlockNumber returns the highest block number present in the blockNumber -> blockhash index.
+// found is false if no block has been indexed
+func fetchHighestIndexedBlockNumber() (blockNumber uint64, found bool, err error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	prefix := newIndexKey(prefixBlockNumberKey)
+	seekToLastForPrefix(itr, prefixBlockNumberKey)
+	if !itr.ValidForPrefix(prefix) {
+		return 0, false, nil
+	}
+	if blockNumber, err = decodeBlockNumberKey(itr.Key().Data()); err != nil {
+		return 0, false, err
+	}
+	return blockNumber, true, nil
+}
+
+// errIndexEmpty is returned by indexedBlockRange when no block is present in the index
+var errIndexEmpty = errors.New("No block is indexed")
+
+// indexedBlockRange returns the lowest and the highest block numbers present in the blockNumber -> blockhash index,
+// i.e., the window of the history that can be looked up in the index. The lowest block number advances as the
+// index is pruned. errIndexEmpty is returned if no block is indexed
+func indexedBlockRange() (minBlock uint64, maxBlock uint64, err error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	prefix := newIndexKey(prefixBlockNumberKey)
+	itr.Seek(prefix)
+	if !itr.ValidForPrefix(prefix) {
+		return 0, 0, errIndexEmpty
+	}
+	if minBlock, err = decodeBlockNumberKey(itr.Key().Data()); err != nil {
+		return 0, 0, err
+	}
+	seekToLastForPrefix(itr, prefixBlockNumberKey)
+	if !itr.ValidForPrefix(prefix) {
+		return 0, 0, errIndexEmpty
+	}
+	if maxBlock, err = decodeBlockNumberKey(itr.Key().Data()); err != nil {
+		return 0, 0, err
+	}
+	return minBlock, maxBlock, nil
+}
+
+// seekToLastForPrefix positions the iterator on the last key of the given key type
+func seekToLastForPrefix(itr *gorocksdb.Iterator, prefix byte) {
+	seekToLastWithKeyPrefix(itr, newIndexKey(prefix))
+}
+
+// seekToLastWithKeyPrefix positions the iterator on the last key that starts with the given bytes
+// (or before them, if there is no such key) by seeking to the upper bound of the prefix and stepping back
+func seekToLastWithKeyPrefix(itr *gorocksdb.Iterator, keyPrefix []byte) {
+	upperBound := computePrefixUpperBound(keyPrefix)
+	if upperBound == nil {
+		itr.SeekToLast()
+		return
+	}
+	itr.Seek(upperBound)
+	if itr.Valid() {
+		itr.Prev()
+	} else {
+		itr.SeekToLast()
+	}
+}
+
+// computePrefixUpperBound returns the smallest key that is greater than all the keys that start with the prefix,
+// i.e., the exclusive upper bound of a scan over the prefix. nil is returned if there is no such key (the prefix
+// is empty or all 0xFF bytes), which means that the scan extends to the last key. The vendored gorocksdb does not
+// expose the iterate_upper_bound read option, so the bound is used for seeking and the scans check ValidForPrefix
+func computePrefixUpperBound(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			upperBound := make([]byte, i+1)
+			copy(upperBound, prefix)
+			upperBound[i]++
+			return upperBound
+		}
+	}
+	return nil
+}
+
+// fetchTxCountBeforeBlock returns the total number of transactions in the blocks before the given block.
+// found is false if the cumulative transaction count of the previous block is not the latest one indexed
+func fetchTxCountBeforeBlock(blockNumber uint64) (txCount uint64, found bool, err error) {
+	if blockNumber == 0 {
+		return 0, true, nil
+	}
+	cumulativeTxCount, lastBlockNumber, found, err := fetchLatestTxCount()
+	if err != nil || !found || lastBlockNumber != blockNumber-1 {
+		return 0, false, err
+	}
+	return cumulativeTxCount, true, nil
+}
+
+// fetchLatestTxCount returns the highest cumulative transaction count indexed and the number of its block.
+// found is false if no cumulative transaction count is indexed
+func fetchLatestTxCount() (cumulativeTxCount uint64, blockNumber uint64, found bool, err error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	seekToLastForPrefix(itr, prefixTxCountBlockNumCompositeKey)
+	if !itr.ValidForPrefix(newIndexKey(prefixTxCountBlockNumCompositeKey)) {
+		return 0, 0, false, nil
+	}
+	if cumulativeTxCount, blockNumber, err = decodeTxCountBlockNumCompositeKey(itr.Key().Data()); err != nil {
+		return 0, 0, false, err
+	}
+	return cumulativeTxCount, blockNumber, true, nil
+}
+
+// backfillTxCounts adds the (cumulativeTxCount,blockNumber) entries missing for the blocks up to lastBlockNumber.
+// As the entry of a block is derived from the entry of the previous block, none is added while indexing for the
+// blocks indexed before the cumulative counts were introduced, nor for any block after them. The backfill continues
+// from the latest cumulative count, or from the first block if there is none, and counts the transactions of the
+// stored blocks. The entries are committed in chunks of indexRebuildChunkBlocks blocks
+func backfillTxCounts(lastBlockNumber uint64) error {
+	if indexRebuildChunkBlocks == 0 {
+		return fmt.Errorf("Rebuild chunk size should be greater than zero")
+	}
+	txCount, latestBlockNumber, found, err := fetchLatestTxCount()
+	if err != nil {
+		return err
+	}
+	startBlock := uint64(0)
+	if found {
+		if latestBlockNumber >= lastBlockNumber {
+			return nil
+		}
+		startBlock = latestBlockNumber + 1
+	}
+	indexLogger.Infof("Backfilling the cumulative transaction counts of blocks [%d] to [%d]", startBlock, lastBlockNumber)
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	for chunkStart := startBlock; chunkStart <= lastBlockNumber; chunkStart += indexRebuildChunkBlocks {
+		chunkEnd := chunkStart + indexRebuildChunkBlocks - 1
+		if chunkEnd > lastBlockNumber || chunkEnd < chunkStart {
+			chunkEnd = lastBlockNumber
+		}
+		writeBatch := gorocksdb.NewWriteBatch()
+		for blockNumber := chunkStart; blockNumber <= chunkEnd && err == nil; blockNumber++ {
+			var block *protos.Block
+			if block, err = fetchBlockFromDB(blockNumber); err == nil && block == nil {
+				err = fmt.Errorf("Cannot backfill the cumulative transaction count of block number [%d]. The block is not found", blockNumber)
+			}
+			if err == nil {
+				txCount += uint64(len(block.GetTransactions()))
+				writeBatch.PutCF(openchainDB.IndexesCF, encodeTxCountBlockNumCompositeKey(txCount, blockNumber), []byte{})
+			}
+		}
+		if err == nil {
+			err = openchainDB.DB.Write(opt, writeBatch)
+		}
+		writeBatch.Destroy()
+		if err != nil {
+			return err
+		}
+		if chunkEnd == lastBlockNumber {
+			break
+		}
+	}
+	return nil
+}
+
+// fetchBlockByGlobalTxOrdinal returns the number of the block that contains the transaction with the given chain-wide
+// ordinal. Ordinals start at zero with the first transaction of the first block.
+// The cumulative transaction counts are in ascending order in the index, so the block is the first one
+// whose cumulative count exceeds the ordinal. ErrResourceNotFound is returned if the ordinal is beyond the indexed transactions
+func fetchBlockByGlobalTxOrdinal(n uint64) (uint64, error) {
+	if n == math.MaxUint64 {
+		return 0, ErrResourceNotFound
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	itr.Seek(encodeTxCountKeyPrefix(n + 1))
+	if !itr.ValidForPrefix(newIndexKey(prefixTxCountBlockNumCompositeKey)) {
+		return 0, ErrResourceNotFound
+	}
+	_, blockNumber, err := decodeTxCountBlockNumCompositeKey(itr.Key().Data())
+	return blockNumber, err
+}
+
+// fetchRecentTransactions returns the latest n transactions across the chain, newest first.
+// Fewer than n transactions are returned if the indexed blocks do not contain as many
+func fetchRecentTransactions(n int) ([]*protos.Transaction, error) {
+	var result []*protos.Transaction
+	err := forEachRecentTransaction(n, func(tx *protos.Transaction) error {
+		result = append(result, tx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fetchRecentTransactionUUIDs returns the uuids of the latest n transactions across the chain, newest first.
+// This is fetchRecentTransactions for the callers that only need the uuids (e.g., a feed of new transactions).
+// There is no per-block list of uuids in the index, hence the uuids are read from the blocks, and are the ones
+// the transactions are indexed under (see getTxUUIDForIndex).
+// Fewer than n uuids are returned if the indexed blocks do not contain as many transactions
+func fetchRecentTransactionUUIDs(n int) ([]string, error) {
+	var result []string
+	err := forEachRecentTransaction(n, func(tx *protos.Transaction) error {
+		txUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return err
+		}
+		result = append(result, txUUID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// forEachRecentTransaction calls fn with the latest n transactions across the chain, newest first.
+// The indexed blocks are walked from the highest block number downwards via the blockNumber -> blockhash index,
+// so only the blocks needed to collect n transactions are loaded, and the blocks that the blockNumber ->
+// transaction count index records as empty are skipped without being loaded
+func forEachRecentTransaction(n int, fn func(tx *protos.Transaction) error) error {
+	if n <= 0 {
+		return nil
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	count := 0
+	prefix := newIndexKey(prefixBlockNumberKey)
+	for seekToLastForPrefix(itr, prefixBlockNumberKey); itr.ValidForPrefix(prefix) && count < n; itr.Prev() {
+		blockNumber, err := decodeBlockNumberKey(itr.Key().Data())
+		if err != nil {
+			return err
+		}
+		txCount, found, err := fetchBlockTxCount(blockNumber)
+		if err != nil {
+			return err
+		}
+		if found && txCount == 0 {
+			continue
+		}
+		block, err := fetchBlockFromDB(blockNumber)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("Block [%d] referred by the index is not found", blockNumber)
+		}
+		txs := block.GetTransactions()
+		for i := len(txs) - 1; i >= 0 && count < n; i-- {
+			if err := fn(txs[i]); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	return nil
+}
+
+// indexLag returns the number of blocks in the blockchain that are above the highest indexed block.
+// Zero means that the index has caught up with the blockchain
+func (blockchain *blockchain) indexLag() (uint64, error) {
+	height := blockchain.getSize()
+	highestIndexedBlockNumber, found, err := fetchHighestIndexedBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return height, nil
+	}
+	if highestIndexedBlockNumber+1 >= height {
+		return 0, nil
+	}
+	return height - (highestIndexedBlockNumber + 1), nil
+}
+
+// isCaughtUp returns true if every block in the blockchain has been indexed, e.g., for a readiness probe.
+// An empty blockchain is caught up
+func (blockchain *blockchain) isCaughtUp() (bool, error) {
+	lag, err := blockchain.indexLag()
+	if err != nil {
+		return false, err
+	}
+	return lag == 0, nil
+}
+
+// findUnindexedBlocks returns, in ascending order, the numbers of the blocks present in the blockchain that are
+// missing from the blockNumber -> blockhash index, e.g., the blocks skipped by a failed async indexing, so that they
+// can be indexed again. Unlike indexLag, this also finds the blocks missing below the highest indexed block.
+// The blocks below the prune point or the expiry threshold are not reported, and neither are the block numbers
+// with no block stored (e.g., the gaps left by out of order blocks)
+func (blockchain *blockchain) findUnindexedBlocks(limits scanLimits) ([]uint64, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	height := blockchain.getSize()
+	prunedBelow, _, err := pruneStatus()
+	if err != nil {
+		return nil, false, err
+	}
+	if expiryThreshold := atomic.LoadUint64(&indexExpiryThreshold); expiryThreshold > prunedBelow {
+		prunedBelow = expiryThreshold
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	// the iterator is kept on the lowest indexed block number that is not below blockNumber
+	var result []uint64
+	prefix := newIndexKey(prefixBlockNumberKey)
+	itr.Seek(encodeBlockNumberKey(prunedBelow))
+	for blockNumber := prunedBelow; blockNumber < height; blockNumber++ {
+		if itr.ValidForPrefix(prefix) {
+			indexedBlockNumber, err := decodeBlockNumberKey(itr.Key().Data())
+			if err != nil {
+				return nil, false, err
+			}
+			if indexedBlockNumber == blockNumber {
+				itr.Next()
+				continue
+			}
+		}
+		block, err := fetchBlockFromDB(blockNumber)
+		if err != nil {
+			return nil, false, err
+		}
+		if block == nil {
+			continue
+		}
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		result = append(result, blockNumber)
+	}
+	return result, false, nil
+}
+
+// blockHashCursor enumerates the indexed block hashes in key order. Entries are decoded lazily,
+// one per call to Next, so that callers can stream through the index without loading it in memory.
+// Close must be called to release the underlying iterator
+type blockHashCursor struct {
+	itr     *gorocksdb.Iterator
+	prefix  []byte
+	started bool
+	err     error
+}
+
+func newBlockHashCursor() *blockHashCursor {
+	return &blockHashCursor{db.GetDBHandle().GetIndexesCFIterator(), newIndexKey(prefixBlockHashKey), false, nil}
+}
+
+// Next returns the next block hash and the corresponding block number. ok is false when there are no more entries
+// or when an entry could not be decoded, in which case Err returns the error
+func (cursor *blockHashCursor) Next() (blockHash []byte, blockNumber uint64, ok bool) {
+	if cursor.itr == nil || cursor.err != nil {
+		return nil, 0, false
+	}
+	defer recoverIndexPanic(&cursor.err)
+	if cursor.started {
+		cursor.itr.Next()
+	} else {
+		cursor.itr.Seek(cursor.prefix)
+		cursor.started = true
+	}
+	if !cursor.itr.ValidForPrefix(cursor.prefix) {
+		return nil, 0, false
+	}
+	blockNumberBytes, err := decodeIndexValue(cursor.itr.Value().Data())
+	if err != nil {
+		cursor.err = err
+		return nil, 0, false
+	}
+	blockHash = decodeBlockHashKey(statemgmt.Copy(cursor.itr.Key().Data()))
+	if blockNumber, err = decodeBlockNumber(blockNumberBytes); err != nil {
+		cursor.err = err
+		return nil, 0, false
+	}
+	return blockHash, blockNumber, true
+}
+
+// Err returns the error that ended the enumeration, if any
+func (cursor *blockHashCursor) Err() error {
+	return cursor.err
+}
+
+// Close releases the underlying iterator. It is safe to call Close more than once
+func (cursor *blockHashCursor) Close() {
+	if cursor.itr != nil {
+		cursor.itr.Close()
+		cursor.itr = nil
+	}
+}
+
+// txTypeReverseCursor enumerates the (blockNumber, txIndex) of the transactions of a type from the latest to the
+// earliest, e.g., to list the latest deployments first. The gorocksdb version in use has no iterate lower bound,
+// so the scan is bounded by checking that the keys still start with the (prefix,txType) bytes.
+// Callers must Close the cursor to release the underlying iterator
+type txTypeReverseCursor struct {
+	itr     *gorocksdb.Iterator
+	prefix  []byte
+	started bool
+	err     error
+}
+
+// newTxTypeReverseCursor returns a reverse cursor over the transactions of the given type. The index keys must be
+// encoded in big-endian order (see indexByteOrder), as otherwise the key order is not the chain order
+func newTxTypeReverseCursor(txType protos.Transaction_Type) (*txTypeReverseCursor, error) {
+	if indexByteOrder != binary.ByteOrder(binary.BigEndian) {
+		return nil, fmt.Errorf("Cannot iterate the transaction type index in reverse. Index keys are encoded with byte order [%s]", indexByteOrder)
+	}
+	return &txTypeReverseCursor{db.GetDBHandle().GetIndexesCFIterator(), encodeTxTypeKeyPrefix(txType), false, nil}, nil
+}
+
+// Next returns the location of the previous transaction of the type, starting with the latest one. ok is false when
+// there are no more entries or when an entry could not be decoded, in which case Err returns the error
+func (cursor *txTypeReverseCursor) Next() (txLocation *TransactionLocation, ok bool) {
+	if cursor.itr == nil || cursor.err != nil {
+		return nil, false
+	}
+	defer recoverIndexPanic(&cursor.err)
+	if cursor.started {
+		cursor.itr.Prev()
+	} else {
+		seekToLastWithKeyPrefix(cursor.itr, cursor.prefix)
+		cursor.started = true
+	}
+	if !cursor.itr.ValidForPrefix(cursor.prefix) {
+		return nil, false
+	}
+	_, blockNumber, txIndex, err := decodeTxTypeCompositeKey(cursor.itr.Key().Data())
+	if err != nil {
+		cursor.err = err
+		return nil, false
+	}
+	return &TransactionLocation{blockNumber, txIndex}, true
+}
+
+// Err returns the error that ended the enumeration, if any
+func (cursor *txTypeReverseCursor) Err() error {
+	return cursor.err
+}
+
+// Close releases the underlying iterator. It is safe to call Close more than once
+func (cursor *txTypeReverseCursor) Close() {
+	if cursor.itr != nil {
+		cursor.itr.Close()
+		cursor.itr = nil
+	}
+}
+
+// fetchBlockTxCount returns the number of transactions in the given block as per the blockNumber -> txCount index.
+// found is false if the block is not indexed
+func fetchBlockTxCount(blockNumber uint64) (txCount uint64, found bool, err error) {
+	txCountBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockTxCountKey(blockNumber))
+	if err != nil || txCountBytes == nil {
+		return 0, false, err
+	}
+	if txCount, err = decodeBlockNumber(txCountBytes); err != nil {
+		return 0, false, err
+	}
+	return txCount, true, nil
+}
+
+// fetchTransactionsInRange returns the transactions of the given block with index in [startIndex, endIndex),
+// e.g., for paginating the transactions of a large block. The range is validated against the indexed
+// transaction count of the block before the block is loaded
+func fetchTransactionsInRange(blockNumber uint64, startIndex uint64, endIndex uint64) ([]*protos.Transaction, error) {
+	txCount, found, err := fetchBlockTxCount(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if err := verifyTxRange(blockNumber, startIndex, endIndex, txCount); err != nil {
+			return nil, err
+		}
+	}
+	block, err := fetchBlockFromDB(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No block found with block number [%d]", blockNumber))
+	}
+	transactions := block.GetTransactions()
+	if err := verifyTxRange(blockNumber, startIndex, endIndex, uint64(len(transactions))); err != nil {
+		return nil, err
+	}
+	return transactions[startIndex:endIndex], nil
+}
+
+func verifyTxRange(blockNumber uint64, startIndex uint64, endIndex uint64, txCount uint64) error {
+	if startIndex > endIndex || endIndex > txCount {
+		return fmt.Errorf("Invalid range [%d, %d) for block number [%d] with [%d] transactions",
+			startIndex, endIndex, blockNumber, txCount)
+	}
+	return nil
+}
+
+// BlockSummary is an entry returned by blockSummaryIterator. See MarshalJSON for its JSON form
+type BlockSummary struct {
+	BlockNumber uint64
+	BlockHash   []byte
+	TxCount     uint64
+}
+
+// blockSummaryIterator enumerates the indexed blocks in ascending block number, backed by a single iterator
+// over the blockNumber -> blockHash index. The transaction count of a block is looked up in the blockNumber -> txCount
+// index, or read from the block itself for the blocks indexed before that index was introduced.
+// Close must be called to release the underlying iterator
+type blockSummaryIterator struct {
+	itr     *gorocksdb.Iterator
+	prefix  []byte
+	started bool
+	err     error
+}
+
+func newBlockSummaryIterator() *blockSummaryIterator {
+	return &blockSummaryIterator{db.GetDBHandle().GetIndexesCFIterator(), newIndexKey(prefixBlockNumberKey), false, nil}
+}
+
+// Next returns the summary of the next block. ok is false when there are no more entries
+// or when an entry could not be read, in which case Err returns the error
+func (iterator *blockSummaryIterator) Next() (summary *BlockSummary, ok bool) {
+	if iterator.itr == nil || iterator.err != nil {
+		return nil, false
+	}
+	defer recoverIndexPanic(&iterator.err)
+	if iterator.started {
+		iterator.itr.Next()
+	} else {
+		iterator.itr.Seek(iterator.prefix)
+		iterator.started = true
+	}
+	if !iterator.itr.ValidForPrefix(iterator.prefix) {
+		return nil, false
+	}
+	blockHash, err := decodeIndexValue(statemgmt.Copy(iterator.itr.Value().Data()))
+	if err != nil {
+		iterator.err = err
+		return nil, false
+	}
+	blockNumber, err := decodeBlockNumberKey(iterator.itr.Key().Data())
+	if err != nil {
+		iterator.err = err
+		return nil, false
+	}
+	txCount, found, err := fetchBlockTxCount(blockNumber)
+	if err != nil {
+		iterator.err = err
+		return nil, false
+	}
+	if !found {
+		block, err := fetchBlockFromDB(blockNumber)
+		if err != nil {
+			iterator.err = err
+			return nil, false
+		}
+		if block == nil {
+			iterator.err = fmt.Errorf("Block number [%d] is indexed but the block is not found", blockNumber)
+			return nil, false
+		}
+		txCount = uint64(len(block.GetTransactions()))
+	}
+	return &BlockSummary{blockNumber, blockHash, txCount}, true
+}
+
+// Err returns the error that ended the enumeration, if any
+func (iterator *blockSummaryIterator) Err() error {
+	return iterator.err
+}
+
+// Close releases the underlying iterator. It is safe to call Close more than once
+func (iterator *blockSummaryIterator) Close() {
+	if iterator.itr != nil {
+		iterator.itr.Close()
+		iterator.itr = nil
+	}
+}
+
+// authorizedChaincode is an entry in the deployment inventory returned by listAllAuthorizedChaincodes
+type authorizedChaincode struct {
+	chaincodeID  *protos.ChaincodeID
+	addressCount uint64
+}
+
+// listAllAuthorizedChaincodes scans the address -> chaincodeID entries and returns each distinct
+// chaincodeID along with the number of addresses that are authorized for it
+func listAllAuthorizedChaincodes(limits scanLimits) ([]*authorizedChaincode, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []*authorizedChaincode
+	chaincodes := make(map[string]*authorizedChaincode)
+	prefix := newIndexKey(prefixAddressChaincodeIDCompositeKey)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.deadlineExceeded() {
+			return result, true, nil
+		}
+		_, chaincodeIDBytes, err := decodeAddressChaincodeIDCompositeKey(statemgmt.Copy(itr.Key().Data()))
+		if err != nil {
+			return nil, false, err
+		}
+		entry, ok := chaincodes[string(chaincodeIDBytes)]
+		if !ok {
+			if len(result) >= limits.maxResults {
+				return result, true, nil
+			}
+			chaincodeID := &protos.ChaincodeID{}
+			if err := proto.Unmarshal(chaincodeIDBytes, chaincodeID); err != nil {
+				return nil, false, err
+			}
+			entry = &authorizedChaincode{chaincodeID, 0}
+			chaincodes[string(chaincodeIDBytes)] = entry
+			result = append(result, entry)
+		}
+		entry.addressCount++
+	}
+	return result, false, nil
+}
+
+// chaincodeDeployment is an entry in the deployment history returned by fetchChaincodeHistory
+type chaincodeDeployment struct {
+	blockNumber uint64
+	txIndex     uint64
+	// the name generated by the deploy transaction, which identifies the deployed version
+	version string
+}
+
+// fetchChaincodeHistory returns, in chain order, the deployments of the chaincode with the path of the given chaincodeID.
+// The name in the chaincodeID is ignored, as each deployment generates a different name
+func fetchChaincodeHistory(chaincodeID *protos.ChaincodeID, limits scanLimits) ([]*chaincodeDeployment, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var history []*chaincodeDeployment
+	prefix := encodeChaincodeHistoryKeyPrefix(chaincodeID.Path)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(history)) {
+			return history, true, nil
+		}
+		key := itr.Key().Data()
+		blockNumber, err := decodeUint64At(key, len(prefix))
+		if err != nil {
+			return nil, false, err
+		}
+		txIndex, err := decodeUint64At(key, len(prefix)+8)
+		if err != nil {
+			return nil, false, err
+		}
+		history = append(history, &chaincodeDeployment{blockNumber, txIndex, string(itr.Value().Data())})
+	}
+	return history, false, nil
+}
+
+// fetchTransactionsByChaincodePaged returns, in chain order, a page of at most pageSize transactions on the chaincode
+// with the name of the given chaincodeID, along with a continuation token for the next page. A nil token fetches the first page.
+// The token is the last (chaincodeName,blockNumber,txIndex) key of the page, and the next page starts after that key.
+// The returned token is nil when there are no more transactions
+func fetchTransactionsByChaincodePaged(chaincodeID *protos.ChaincodeID, token []byte,
+	pageSize int) ([]*protos.Transaction, []byte, error) {
+	if pageSize <= 0 {
+		return nil, nil, fmt.Errorf("Page size should be greater than zero")
+	}
+	prefix := encodeChaincodeTxKeyPrefix(chaincodeID.Name)
+	if token != nil && !bytes.HasPrefix(token, prefix) {
+		return nil, nil, fmt.Errorf("Continuation token [%x] does not belong to chaincode [%s]", token, chaincodeID.Name)
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	if token == nil {
+		itr.Seek(prefix)
+	} else {
+		itr.Seek(token)
+		if itr.ValidForPrefix(prefix) && bytes.Equal(itr.Key().Data(), token) {
+			itr.Next()
+		}
+	}
+	var transactions []*protos.Transaction
+	var lastKey []byte
+	var block *protos.Block
+	var loadedBlockNumber uint64
+	for ; itr.ValidForPrefix(prefix); itr.Next() {
+		if len(transactions) == pageSize {
+			return transactions, lastKey, nil
+		}
+		lastKey = statemgmt.Copy(itr.Key().Data())
+		blockNumber, err := decodeUint64At(lastKey, len(prefix))
+		if err != nil {
+			return nil, nil, err
+		}
+		txIndex, err := decodeUint64At(lastKey, len(prefix)+8)
+		if err != nil {
+			return nil, nil, err
+		}
+		if block == nil || blockNumber != loadedBlockNumber {
+			if block, err = fetchBlockFromDB(blockNumber); err != nil {
+				return nil, nil, err
+			}
+			if block == nil {
+				return nil, nil, fmt.Errorf("Block [%d] referred by the index is not found", blockNumber)
+			}
+			loadedBlockNumber = blockNumber
+		}
+		if txIndex >= uint64(len(block.GetTransactions())) {
+			return nil, nil, fmt.Errorf("Transaction index [%d] referred by the index is beyond the transactions of block [%d]",
+				txIndex, blockNumber)
+		}
+		transactions = append(transactions, block.GetTransactions()[txIndex])
+	}
+	return transactions, nil, nil
+}
+
+// fetchDependentTransactions returns the uuids of the transactions that refer to the given transaction
+func fetchDependentTransactions(txUUID string, limits scanLimits) ([]string, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var dependents []string
+	prefix := encodeTxReferenceKeyPrefix(txUUID)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(dependents)) {
+			return dependents, true, nil
+		}
+		_, dependentTxUUID, err := decodeTxReferenceCompositeKey(statemgmt.Copy(itr.Key().Data()))
+		if err != nil {
+			return nil, false, err
+		}
+		dependents = append(dependents, dependentTxUUID)
+	}
+	return dependents, false, nil
+}
+
+// verifyTransactionInBlock checks whether the index places the given transaction in the claimed block.
+// It returns false (and no error) on a mismatch and ErrResourceNotFound if the transaction is not indexed
+func verifyTransactionInBlock(txUUID string, blockNumber uint64) (bool, error) {
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
+	if err != nil {
+		return false, err
+	}
+	return txLocation.BlockNumber == blockNumber, nil
+}
+
+// validateBlockTxIndexing checks that the txUUID entries of the transactions of the block cover the transaction
+// indexes 0..N-1 of the block exactly once and returns an error that describes every gap and duplicate otherwise.
+// A transaction whose uuid is not indexed, or is indexed in another block (e.g., a uuid reused by a later block), leaves a gap
+func validateBlockTxIndexing(blockNumber uint64) error {
+	block, err := fetchBlockFromDB(blockNumber)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No block found with block number [%d]", blockNumber))
+	}
+	transactions := block.GetTransactions()
+	txUUIDsByIndex := make([][]string, len(transactions))
+	var problems []string
+	for _, tx := range transactions {
+		txUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return err
+		}
+		txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
+		if err == ErrResourceNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if txLocation.BlockNumber != blockNumber {
+			continue
+		}
+		if txLocation.TxIndex >= uint64(len(transactions)) {
+			problems = append(problems, fmt.Sprintf("uuid [%s] is indexed at out of range index [%d]", txUUID, txLocation.TxIndex))
+			continue
+		}
+		txUUIDsByIndex[txLocation.TxIndex] = append(txUUIDsByIndex[txLocation.TxIndex], txUUID)
+	}
+	for txIndex, txUUIDs := range txUUIDsByIndex {
+		switch {
+		case len(txUUIDs) == 0:
+			problems = append(problems, fmt.Sprintf("index [%d] is not covered by any uuid", txIndex))
+		case len(txUUIDs) > 1:
+			problems = append(problems, fmt.Sprintf("index [%d] is covered by uuids %v", txIndex, txUUIDs))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Transactions of block [%d] are not indexed consistently: %s", blockNumber, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// formatTransactionLocation resolves the location of a transaction via the index
+// and returns it in a human readable form, for use in logs and tooling
+func formatTransactionLocation(txUUID string) (string, error) {
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
+	if err == ErrResourceNotFound {
+		return fmt.Sprintf("uuid %s not found in index", txUUID), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("block %d, index %d, uuid %s", txLocation.BlockNumber, txLocation.TxIndex, txUUID), nil
+}
+
+// getTxExecutingAddresses returns the distinct addresses that executed the given transaction. The transaction is
+// indexed under each of them
+var getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+	// TODO Fetch addresses form tx
+	return []string{"address1"}
+}
+
+// getBlockProposer returns the address of the validator that proposed the given block.
+// An empty string means that the block does not carry the proposer info
+var getBlockProposer = func(block *protos.Block) string {
+	// TODO fetch proposer from block once blocks carry it
+	return ""
+}
+
+// getTxMetadataEntries returns the metadata key-value entries carried by the given transaction
+var getTxMetadataEntries = func(tx *protos.Transaction) map[string]string {
+	// TODO fetch metadata entries from tx once transactions carry them in a structured form
+	return nil
+}
+
+// getTxReferencedUUIDs returns the uuids of prior transactions that the given transaction refers to
+var getTxReferencedUUIDs = func(tx *protos.Transaction) []string {
+	// TODO fetch references from tx once transactions carry them
+	return nil
+}
+
+// getDeployedChaincodeID returns the chaincodeID of a deploy transaction, or nil for other transactions
+func getDeployedChaincodeID(tx *protos.Transaction) *protos.ChaincodeID {
+	if tx.Type != protos.Transaction_CHAINCODE_DEPLOY {
+		return nil
+	}
+	chaincodeID := &protos.ChaincodeID{}
+	if err := proto.Unmarshal(tx.ChaincodeID, chaincodeID); err != nil {
+		indexLogger.Debugf("Not indexing the deployment of transaction [%s] with an invalid chaincodeID: %s", tx.Uuid, err)
+		return nil
+	}
+	return chaincodeID
+}
+
+// getTxChaincodeName returns the name of the chaincode that the transaction deploys, invokes, queries or terminates,
+// or an empty string for other transactions
+func getTxChaincodeName(tx *protos.Transaction) string {
+	switch tx.Type {
+	case protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE,
+		protos.Transaction_CHAINCODE_QUERY, protos.Transaction_CHAINCODE_TERMINATE:
+	default:
+		return ""
+	}
+	chaincodeID := &protos.ChaincodeID{}
+	if err := proto.Unmarshal(tx.ChaincodeID, chaincodeID); err != nil {
+		indexLogger.Debugf("Not indexing transaction [%s] by chaincode. Invalid chaincodeID: %s", tx.Uuid, err)
+		return ""
+	}
+	return chaincodeID.Name
+}
+
+func getAuthorisedAddresses(tx *protos.Transaction) ([]string, *protos.ChaincodeID) {
+	// TODO fetch address from chaincode deployment tx
+	// TODO this method should also return error
+	data := tx.ChaincodeID
+	cID := &protos.ChaincodeID{}
+	err := proto.Unmarshal(data, cID)
+	if err != nil {
+		return nil, nil
+	}
+	return []string{"address1", "address2"}, cID
+}
+
+// functions for encoding/decoding db keys/values for index data
+// encode / decode BlockNumber
+func encodeBlockNumber(blockNumber uint64) []byte {
+	return proto.EncodeVarint(blockNumber)
+}
+
+func decodeBlockNumber(blockNumberBytes []byte) (uint64, error) {
+	blockNumber, n := proto.DecodeVarint(blockNumberBytes)
+	if n == 0 {
+		return 0, fmt.Errorf("Invalid encoding of block number [%x]", blockNumberBytes)
+	}
+	return blockNumber, nil
+}
+
+// encode / decode BlockNumTxIndex
+func encodeBlockNumTxIndex(blockNumber uint64, txIndexInBlock uint64) []byte {
+	b := proto.NewBuffer([]byte{})
+	b.EncodeVarint(blockNumber)
+	b.EncodeVarint(txIndexInBlock)
+	return b.Bytes()
+}
+
+func decodeBlockNumTxIndex(bytes []byte) (blockNum uint64, txIndex uint64, err error) {
+	b := proto.NewBuffer(bytes)
+	blockNum, err = b.DecodeVarint()
+	if err != nil {
+		return
+	}
+	txIndex, err = b.DecodeVarint()
+	if err != nil {
+		return
+	}
+	return
+}
+
+// The point lookup keys are encoded by the indexKeyEncoder (see blockchain_indexes_keys.go)
+func encodeBlockHashKey(blockHash []byte) []byte {
+	return indexKeyEncoder.encodeBlockHashKey(blockHash)
+}
+
+func encodeBlockNumberKey(blockNumber uint64) []byte {
+	return indexKeyEncoder.encodeBlockNumberKey(blockNumber)
+}
+
+func decodeBlockHashKey(key []byte) []byte {
+	return indexKeyEncoder.decodeBlockHashKey(key)
+}
+
+func decodeBlockNumberKey(key []byte) (uint64, error) {
+	return indexKeyEncoder.decodeBlockNumberKey(key)
+}
+
+func encodeBlockTxCountKey(blockNumber uint64) []byte {
+	return indexKeyEncoder.encodeBlockTxCountKey(blockNumber)
+}
+
+func encodeTxUUIDKey(txUUID string) []byte {
+	return indexKeyEncoder.encodeTxUUIDKey(txUUID)
+}
+
+func encodeTxExecutingAddressesKey(txUUID string) []byte {
+	return indexKeyEncoder.encodeTxExecutingAddressesKey(txUUID)
+}
+
+func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byte {
+	b := proto.NewBuffer(encodeAddressKeyPrefix(address))
+	b.EncodeVarint(blockNumber)
+	return b.Bytes()
+}
+
+func encodePreviousBlockHashKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixPreviousBlockHashKey, encodeIndexUint64(blockNumber))
+}
+
+func encodeAddressLatestBlockKey(address string) []byte {
+	return prependKeyPrefix(prefixAddressLatestBlockKey, []byte(addressKeyForm(address)))
+}
+
+func encodeAddressKeyPrefix(address string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixAddressBlockNumCompositeKey))
+	b.EncodeRawBytes([]byte(addressKeyForm(address)))
+	return b.Bytes()
+}
+
+func decodeAddressBlockNumCompositeKey(key []byte) (address string, blockNumber uint64, err error) {
+	body, err := indexKeyBody(key)
+	if err != nil {
+		return
+	}
+	b := proto.NewBuffer(body)
+	addressBytes, err := b.DecodeRawBytes(false)
+	if err != nil {
+		return
+	}
+	blockNumber, err = b.DecodeVarint()
+	if err != nil {
+		return
+	}
+	address = string(addressBytes)
+	return
+}
+
+// the block number is encoded big-endian so that the addresses of a block share a fixed-length key prefix
+func encodeBlockNumAddressCompositeKey(blockNumber uint64, address string) []byte {
+	b := proto.NewBuffer(encodeBlockNumAddressKeyPrefix(blockNumber))
+	b.EncodeRawBytes([]byte(addressKeyForm(address)))
+	return b.Bytes()
+}
+
+func encodeBlockNumAddressKeyPrefix(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockNumAddressCompositeKey, encodeIndexUint64(blockNumber))
+}
+
+// the block number is encoded big-endian so that the blocks of a proposer are iterated in ascending order
+func encodeProposerBlockNumCompositeKey(proposer string, blockNumber uint64) []byte {
+	return append(encodeProposerKeyPrefix(proposer), encodeIndexUint64(blockNumber)...)
+}
+
+func encodeProposerKeyPrefix(proposer string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixProposerBlockNumCompositeKey))
+	b.EncodeRawBytes([]byte(proposer))
+	return b.Bytes()
+}
+
+func encodeTxCountBlockNumCompositeKey(cumulativeTxCount uint64, blockNumber uint64) []byte {
+	return append(encodeTxCountKeyPrefix(cumulativeTxCount), encodeIndexUint64(blockNumber)...)
+}
+
+func encodeTxCountKeyPrefix(cumulativeTxCount uint64) []byte {
+	return prependKeyPrefix(prefixTxCountBlockNumCompositeKey, encodeIndexUint64(cumulativeTxCount))
+}
+
+func decodeTxCountBlockNumCompositeKey(key []byte) (cumulativeTxCount uint64, blockNumber uint64, err error) {
+	headerLength := indexKeyHeaderLength()
+	if cumulativeTxCount, err = decodeUint64At(key, headerLength); err != nil {
+		return
+	}
+	blockNumber, err = decodeUint64At(key, headerLength+8)
+	return
+}
+
+func encodeTxMetadataCompositeKey(key string, value string, blockNumber uint64, txIndexInBlock uint64) []byte {
+	return append(encodeTxMetadataKeyPrefix(key, value), encodeBlockNumTxIndex(blockNumber, txIndexInBlock)...)
+}
+
+func encodeTxMetadataKeyPrefix(key string, value string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixTxMetadataCompositeKey))
+	b.EncodeRawBytes([]byte(key))
+	b.EncodeRawBytes([]byte(value))
+	return b.Bytes()
+}
+
+// the block number and the index within the block are big-endian encoded so that the deployments are ordered by them
+func encodeChaincodeHistoryCompositeKey(chaincodePath string, blockNumber uint64, txIndexInBlock uint64) []byte {
+	key := encodeChaincodeHistoryKeyPrefix(chaincodePath)
+	key = append(key, encodeIndexUint64(blockNumber)...)
+	return append(key, encodeIndexUint64(txIndexInBlock)...)
+}
+
+func encodeChaincodeHistoryKeyPrefix(chaincodePath string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixChaincodeHistoryCompositeKey))
+	b.EncodeRawBytes([]byte(chaincodePath))
+	return b.Bytes()
+}
+
+// the block number and the index within the block are encoded as fixed-width numbers so that
+// the transactions on a chaincode are ordered by them
+func encodeChaincodeTxCompositeKey(chaincodeName string, blockNumber uint64, txIndexInBlock uint64) []byte {
+	key := encodeChaincodeTxKeyPrefix(chaincodeName)
+	key = append(key, encodeIndexUint64(blockNumber)...)
+	return append(key, encodeIndexUint64(txIndexInBlock)...)
+}
+
+func encodeChaincodeTxKeyPrefix(chaincodeName string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixChaincodeTxCompositeKey))
+	b.EncodeRawBytes([]byte(chaincodeName))
+	return b.Bytes()
+}
+
+// encode / decode TxSizeKey. The size is big-endian encoded so that keys are ordered by size
+func encodeTxSizeKey(txSize uint64, blockNumber uint64, txIndexInBlock uint64) []byte {
+	return append(encodeTxSizeKeyPrefix(txSize), encodeBlockNumTxIndex(blockNumber, txIndexInBlock)...)
+}
+
+func encodeTxSizeKeyPrefix(txSize uint64) []byte {
+	return prependKeyPrefix(prefixTxSizeKey, encodeIndexUint64(txSize))
+}
+
+func decodeTxSizeKey(key []byte) (uint64, error) {
+	return decodeUint64At(key, indexKeyHeaderLength())
+}
+
+// encode / decode TxReferenceCompositeKey
+func encodeTxReferenceCompositeKey(referencedTxUUID string, txUUID string) []byte {
+	b := proto.NewBuffer(encodeTxReferenceKeyPrefix(referencedTxUUID))
+	b.EncodeRawBytes([]byte(txUUID))
+	return b.Bytes()
+}
+
+func encodeTxReferenceKeyPrefix(referencedTxUUID string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixTxReferenceCompositeKey))
+	b.EncodeRawBytes([]byte(referencedTxUUID))
+	return b.Bytes()
+}
+
+func decodeTxReferenceCompositeKey(key []byte) (referencedTxUUID string, txUUID string, err error) {
+	body, err := indexKeyBody(key)
+	if err != nil {
+		return
+	}
+	b := proto.NewBuffer(body)
+	referencedTxUUIDBytes, err := b.DecodeRawBytes(false)
+	if err != nil {
+		return
+	}
+	txUUIDBytes, err := b.DecodeRawBytes(false)
+	if err != nil {
+		return
+	}
+	referencedTxUUID, txUUID = string(referencedTxUUIDBytes), string(txUUIDBytes)
+	return
+}
+
+// encode / decode TxTypeCompositeKey. All the parts are big-endian encoded so that, for a given type,
+// the keys are ordered by block number and then by index within the block
+func encodeTxTypeCompositeKey(txType protos.Transaction_Type, blockNumber uint64, txIndexInBlock uint64) []byte {
+	key := encodeTxTypeKeyPrefix(txType)
+	key = append(key, encodeIndexUint64(blockNumber)...)
+	return append(key, encodeIndexUint64(txIndexInBlock)...)
+}
+
+func encodeTxTypeKeyPrefix(txType protos.Transaction_Type) []byte {
+	typeBytes := make([]byte, 4)
+	indexByteOrder.PutUint32(typeBytes, uint32(txType))
+	return prependKeyPrefix(prefixTxTypeCompositeKey, typeBytes)
+}
+
+func decodeTxTypeCompositeKey(key []byte) (txType protos.Transaction_Type, blockNumber uint64, txIndexInBlock uint64, err error) {
+	offset := indexKeyHeaderLength()
+	if len(key) != offset+20 {
+		err = fmt.Errorf("Invalid transaction type key [%x]", key)
+		return
+	}
+	txType = protos.Transaction_Type(indexByteOrder.Uint32(key[offset : offset+4]))
+	blockNumber = decodeIndexUint64(key[offset+4 : offset+12])
+	txIndexInBlock = decodeIndexUint64(key[offset+12 : offset+20])
+	return
+}
+
+// encode / decode prune cursor
+func encodePruneCursorKey() []byte {
+	return newIndexKey(prefixPruneCursorKey)
+}
+
+func encodePruneCursor(prunedBelow uint64, targetBlockNumber uint64) []byte {
+	b := proto.NewBuffer([]byte{})
+	b.EncodeVarint(prunedBelow)
+	b.EncodeVarint(targetBlockNumber)
+	return b.Bytes()
+}
+
+func decodePruneCursor(bytes []byte) (prunedBelow uint64, targetBlockNumber uint64, err error) {
+	b := proto.NewBuffer(bytes)
+	prunedBelow, err = b.DecodeVarint()
+	if err != nil {
+		return
+	}
+	targetBlockNumber, err = b.DecodeVarint()
+	return
+}
+
+func encodeAddressDigestKey(addressDigest string) []byte {
+	return indexKeyEncoder.encodeAddressDigestKey(addressDigest)
+}
+
+func encodeAddressChaincodeIDCompositeKey(address string, chaincodeIDBytes []byte) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixAddressChaincodeIDCompositeKey))
+	b.EncodeRawBytes([]byte(addressKeyForm(address)))
+	b.EncodeRawBytes(chaincodeIDBytes)
+	return b.Bytes()
+}
+
+func decodeAddressChaincodeIDCompositeKey(key []byte) (address string, chaincodeIDBytes []byte, err error) {
+	body, err := indexKeyBody(key)
+	if err != nil {
+		return
+	}
+	b := proto.NewBuffer(body)
+	addressBytes, err := b.DecodeRawBytes(false)
+	if err != nil {
+		return
+	}
+	chaincodeIDBytes, err = b.DecodeRawBytes(false)
+	if err != nil {
+		return
+	}
+	address = string(addressBytes)
+	return
+}
+
+func encodeListTxIndexes(listTx []uint64) []byte {
+	return indexValueCodec.encodeTxIndexes(listTx)
+}
+
+// ascendingTxIndexes sorts tx indexes in ascending order
+type ascendingTxIndexes []uint64
+
+func (indexes ascendingTxIndexes) Len() int {
+	return len(indexes)
+}
+
+func (indexes ascendingTxIndexes) Less(i, j int) bool {
+	return indexes[i] < indexes[j]
+}
+
+func (indexes ascendingTxIndexes) Swap(i, j int) {
+	indexes[i], indexes[j] = indexes[j], indexes[i]
+}
+
+func decodeListTxIndexes(bytes []byte) ([]uint64, error) {
+	return indexValueCodec.decodeTxIndexes(bytes)
+}
+
+// encodeIndexValue returns the value in the checksummed format if indexValueChecksums is set, else the value as is.
+// The checksummed format is the codec tag, followed by the value, followed by the big-endian crc32 (IEEE) of the value
+func encodeIndexValue(value []byte) []byte {
+	if !indexValueChecksums {
+		return value
+	}
+	encoded := make([]byte, 0, len(value)+5)
+	encoded = append(encoded, indexValueCodecCRC32)
+	encoded = append(encoded, value...)
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(value))
+	return append(encoded, checksum...)
+}
+
+// decodeIndexValue reverses encodeIndexValue and returns an error if the stored value does not match its checksum.
+// An empty value (i.e., a missing key) is returned as is
+func decodeIndexValue(encoded []byte) ([]byte, error) {
+	if !indexValueChecksums || len(encoded) == 0 {
+		return encoded, nil
+	}
+	if len(encoded) < 5 || encoded[0] != indexValueCodecCRC32 {
+		return nil, fmt.Errorf("Index value [%x] is corrupted: not in the checksummed format", encoded)
+	}
+	value := encoded[1 : len(encoded)-4]
+	storedChecksum := binary.BigEndian.Uint32(encoded[len(encoded)-4:])
+	if computedChecksum := crc32.ChecksumIEEE(value); computedChecksum != storedChecksum {
+		return nil, fmt.Errorf("Index value [%x] is corrupted: stored checksum [%08x] does not match computed checksum [%08x]",
+			encoded, storedChecksum, computedChecksum)
+	}
+	return value, nil
+}
+
+func encodeAddressList(addresses []string) []byte {
+	return indexValueCodec.encodeAddresses(addresses)
+}
+
+func decodeAddressList(bytes []byte) ([]string, error) {
+	return indexValueCodec.decodeAddresses(bytes)
+}
+
+func prependKeyPrefix(prefix byte, key []byte) []byte {
+	modifiedKey := newIndexKey(prefix)
+	modifiedKey = append(modifiedKey, key...)
+	return modifiedKey
+}
+
+// newIndexKey returns the leading bytes of an index key of the given type - the namespace (if any) followed by the prefix
+func newIndexKey(prefix byte) []byte {
+	if indexKeyNamespace == 0 {
+		return []byte{prefix}
+	}
+	return []byte{indexKeyNamespace, prefix}
+}
+
+// decodeUint64At decodes the big-endian uint64 at the given offset of the key,
+// returning an error instead of panicking if the key is too short
+func decodeUint64At(key []byte, offset int) (uint64, error) {
+	if offset < 0 || len(key) < offset+8 {
+		return 0, fmt.Errorf("Invalid index key [%x]: expected 8 bytes at offset [%d]", key, offset)
+	}
+	return decodeIndexUint64(key[offset : offset+8]), nil
+}
+
+// setIndexByteOrderFromConfig sets indexByteOrder as per indexKeysLittleEndian and logs a warning if the index keys
+// are thereby not in numeric order
+func setIndexByteOrderFromConfig() {
+	if !indexKeysLittleEndian {
+		indexByteOrder = binary.BigEndian
+		return
+	}
+	indexByteOrder = binary.LittleEndian
+	indexLogger.Warningf("Index keys are encoded with byte order [%s]. The queries that scan the index in numeric order will return wrong results",
+		indexByteOrder)
+}
+
+// encodeIndexUint64 encodes a fixed-width number of an index key as per indexByteOrder
+func encodeIndexUint64(number uint64) []byte {
+	bytes := make([]byte, 8)
+	indexByteOrder.PutUint64(bytes, number)
+	return bytes
+}
+
+func decodeIndexUint64(bytes []byte) uint64 {
+	return indexByteOrder.Uint64(bytes)
+}
+
+// indexKeyBody returns the key without the leading bytes added by newIndexKey
+func indexKeyBody(key []byte) ([]byte, error) {
+	if len(key) < indexKeyHeaderLength() {
+		return nil, fmt.Errorf("Invalid index key [%x]: shorter than the key header", key)
+	}
+	return key[indexKeyHeaderLength():], nil
+}
+
+// recoverIndexPanic converts a panic while reading the index (e.g., on a corrupted entry) into an error stored in err.
+// It is deferred by the enumerations that callers step through, so that a corrupted entry ends the enumeration with
+// an error instead of crashing the peer
+func recoverIndexPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("Recovered from a panic while reading the index: %v", r)
+	}
+}
+
+// indexKeyHeaderLength returns the number of leading bytes that newIndexKey adds to a key
+func indexKeyHeaderLength() int {
+	if indexKeyNamespace == 0 {
+		return 1
+	}
+	return 2
 }
@@ -17,21 +17,46 @@ limitations under the License.
 package ledger
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/tecbot/gorocksdb"
 )
 
-var lastIndexedBlockKey = []byte{byte(0)}
+var prefixLastIndexedBlockKey = byte(0)
+
+// asyncIndexerQueueCapacity is the number of blocks that can be queued for the async indexer
+// before the callers submitting blocks are blocked (or turned away by tryCreateIndexesAsync)
+var asyncIndexerQueueCapacity = 0
+
+// errIndexQueueFull is returned by tryCreateIndexesAsync when the block cannot be queued without blocking
+var errIndexQueueFull = errors.New("Async indexer queue is full")
+
+// errIndexerNotRunning is returned when a block is submitted to an async indexer that is not started yet or is stopped
+var errIndexerNotRunning = errors.New("Async indexer is not running")
+
+// errIndexerStopped is returned by start when the async indexer has already been stopped. A stopped indexer cannot be restarted
+var errIndexerStopped = errors.New("Async indexer has been stopped and cannot be started again")
+
+// runningAsyncIndexers is the number of async indexers that are started and not stopped yet. The bulk indexing,
+// which writes the last indexed block marker that an async indexer keeps in memory, is refused while it is non zero
+var runningAsyncIndexers int32
+
+// lifecycle states of the async indexer
+const (
+	indexerNotStarted = iota
+	indexerRunning
+	indexerStopped
+)
 
 type blockWrapper struct {
 	block       *protos.Block
 	blockNumber uint64
 	blockHash   []byte
-	stopNow     bool
 }
 
 type blockchainIndexerAsync struct {
@@ -39,18 +64,56 @@ type blockchainIndexerAsync struct {
 	// Channel for transferring block from block chain for indexing
 	blockChan    chan blockWrapper
 	indexerState *blockchainIndexerState
+	// commit index batches with synced writes
+	durableWrites       bool
+	queueCapacity       int
+	compactionScheduler *indexCompactionScheduler
+	statsSampler        *indexStatsSampler
+	batchPool           *writeBatchPool
+	// lifecycleLock serializes start and stop and guards lifecycleState. The blocks are submitted under
+	// the read lock, so that blockChan is not closed by stop while a block is being sent
+	lifecycleLock  sync.RWMutex
+	lifecycleState int
+	// closed when the indexing goroutine exits
+	doneChan chan struct{}
 }
 
 func newBlockchainIndexerAsync() *blockchainIndexerAsync {
-	return new(blockchainIndexerAsync)
+	setIndexByteOrderFromConfig()
+	return &blockchainIndexerAsync{durableWrites: indexWritesDurably, queueCapacity: asyncIndexerQueueCapacity,
+		compactionScheduler: newIndexCompactionSchedulerFromConfig(), statsSampler: newIndexStatsSamplerFromConfig(),
+		batchPool: newWriteBatchPoolFromConfig()}
 }
 
 func (indexer *blockchainIndexerAsync) isSynchronous() bool {
 	return false
 }
 
+// start starts the indexing goroutine after indexing the blocks committed but not yet indexed.
+// Starting a running indexer is a no-op and starting a stopped indexer returns errIndexerStopped
 func (indexer *blockchainIndexerAsync) start(blockchain *blockchain) error {
+	indexer.lifecycleLock.Lock()
+	defer indexer.lifecycleLock.Unlock()
+	switch indexer.lifecycleState {
+	case indexerRunning:
+		indexLogger.Debug("Async indexer is already running")
+		return nil
+	case indexerStopped:
+		return errIndexerStopped
+	}
+	if err := indexer.startIndexing(blockchain); err != nil {
+		return err
+	}
+	indexer.lifecycleState = indexerRunning
+	atomic.AddInt32(&runningAsyncIndexers, 1)
+	return nil
+}
+
+func (indexer *blockchainIndexerAsync) startIndexing(blockchain *blockchain) error {
 	indexer.blockchain = blockchain
+	if err := checkIndexSchemaVersion(); err != nil {
+		return err
+	}
 	indexerState, err := newBlockchainIndexerState(indexer)
 	if err != nil {
 		return err
@@ -65,19 +128,22 @@ func (indexer *blockchainIndexerAsync) start(blockchain *blockchain) error {
 	}
 	indexLogger.Debugf("staring indexer, lastIndexedBlockNum = [%d] after processing pending blocks",
 		indexer.indexerState.getLastIndexedBlockNumber())
-	indexer.blockChan = make(chan blockWrapper)
+	if indexer.indexerState.isZerothBlockIndexed() {
+		if err := backfillTxCounts(indexer.indexerState.getLastIndexedBlockNumber()); err != nil {
+			return err
+		}
+	}
+	warmUpIndexesFromConfig()
+	indexer.blockChan = make(chan blockWrapper, indexer.queueCapacity)
+	indexer.doneChan = make(chan struct{})
+	indexer.compactionScheduler.start()
+	indexer.statsSampler.start(blockchain.indexLag)
 	go func() {
-		for {
-			indexLogger.Debug("Going to wait on channel for next block to index")
-			blockWrapper := <-indexer.blockChan
-
+		defer close(indexer.doneChan)
+		// stop closes blockChan, which ends the loop once the queued blocks are indexed
+		for blockWrapper := range indexer.blockChan {
 			indexLogger.Debugf("Blockwrapper received on channel: block number = [%d]", blockWrapper.blockNumber)
 
-			if blockWrapper.stopNow {
-				indexLogger.Debug("stop command received on channel")
-				indexer.blockChan <- blockWrapper
-				return
-			}
 			if indexer.indexerState.hasError() {
 				indexLogger.Debugf("Not indexing block number [%d]. Because of previous error: %s.",
 					blockWrapper.blockNumber, indexer.indexerState.getError())
@@ -95,6 +161,7 @@ func (indexer *blockchainIndexerAsync) start(blockchain *blockchain) error {
 				indexLogger.Debugf("Finished indexing block number [%d]", blockWrapper.blockNumber)
 			}
 		}
+		indexLogger.Debug("Block channel closed. Stopping the indexing goroutine")
 	}()
 	return nil
 }
@@ -104,25 +171,62 @@ func (indexer *blockchainIndexerAsync) createIndexesSync(
 	return fmt.Errorf("Method not applicable")
 }
 
+// createIndexesAsync queues the block for indexing, waiting for room in the queue if needed.
+// errIndexerNotRunning is returned if the indexer is not started yet or is stopped
 func (indexer *blockchainIndexerAsync) createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error {
-	indexer.blockChan <- blockWrapper{block, blockNumber, blockHash, false}
+	indexer.lifecycleLock.RLock()
+	defer indexer.lifecycleLock.RUnlock()
+	if indexer.lifecycleState != indexerRunning {
+		return errIndexerNotRunning
+	}
+	indexer.blockChan <- blockWrapper{block, blockNumber, blockHash}
 	return nil
 }
 
+// tryCreateIndexesAsync queues the block for indexing only if this can be done without blocking.
+// errIndexQueueFull is returned otherwise so that the caller can apply backpressure or retry later,
+// and errIndexerNotRunning is returned if the indexer is not started yet or is stopped
+func (indexer *blockchainIndexerAsync) tryCreateIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error {
+	indexer.lifecycleLock.RLock()
+	defer indexer.lifecycleLock.RUnlock()
+	if indexer.lifecycleState != indexerRunning {
+		return errIndexerNotRunning
+	}
+	select {
+	case indexer.blockChan <- blockWrapper{block, blockNumber, blockHash}:
+		return nil
+	default:
+		return errIndexQueueFull
+	}
+}
+
 // createIndexes adds entries into db for creating indexes on various attributes
 func (indexer *blockchainIndexerAsync) createIndexesInternal(block *protos.Block, blockNumber uint64, blockHash []byte) error {
+	if err := verifyBlockNumberNotIndexedWithDifferentHash(blockNumber, blockHash); err != nil {
+		return err
+	}
 	openchainDB := db.GetDBHandle()
-	writeBatch := gorocksdb.NewWriteBatch()
-	defer writeBatch.Destroy()
-	addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
-	writeBatch.PutCF(openchainDB.IndexesCF, lastIndexedBlockKey, encodeBlockNumber(blockNumber))
+	writeBatch := indexer.batchPool.get()
+	defer indexer.batchPool.put(writeBatch)
+	indexWriteLock.RLock()
+	defer indexWriteLock.RUnlock()
+	if err := addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch); err != nil {
+		return err
+	}
+	writeBatch.PutCF(openchainDB.IndexesCF, encodeLastIndexedBlockKey(), encodeBlockNumber(blockNumber))
 	opt := gorocksdb.NewDefaultWriteOptions()
 	defer opt.Destroy()
+	opt.SetSync(indexer.durableWrites)
 	err := openchainDB.DB.Write(opt, writeBatch)
 	if err != nil {
+		indexWALDiscarded(blockNumber)
 		return err
 	}
+	indexWALCommitted(blockNumber)
+	indexExpiryCommitted(blockNumber)
 	indexer.indexerState.blockIndexed(blockNumber)
+	indexer.compactionScheduler.recordActivity()
+	indexEvents.publish(blockNumber, blockHash)
 	return nil
 }
 
@@ -136,13 +240,13 @@ func (indexer *blockchainIndexerAsync) fetchBlockNumberByBlockHash(blockHash []b
 	return fetchBlockNumberByBlockHashFromDB(blockHash)
 }
 
-func (indexer *blockchainIndexerAsync) fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error) {
+func (indexer *blockchainIndexerAsync) fetchTransactionLocationByUUID(txUUID string) (*TransactionLocation, error) {
 	err := indexer.indexerState.checkError()
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 	indexer.indexerState.waitForLastCommittedBlock()
-	return fetchTransactionIndexByUUIDFromDB(txUUID)
+	return fetchTransactionLocationByUUIDFromDB(txUUID)
 }
 
 func (indexer *blockchainIndexerAsync) indexPendingBlocks() error {
@@ -190,19 +294,33 @@ func (indexer *blockchainIndexerAsync) fetchBlockFromDBAndCreateIndexes(blockNum
 		return errBlockFetch
 	}
 
-	blockHash, errBlockHash := blockToIndex.GetHash()
+	blockHash, errBlockHash := computeBlockHash(blockToIndex)
 	if errBlockHash != nil {
 		return errBlockHash
 	}
-	indexer.createIndexesInternal(blockToIndex, blockNumber, blockHash)
-	return nil
+	return indexer.createIndexesInternal(blockToIndex, blockNumber, blockHash)
 }
 
+// stop waits for the queued blocks to be indexed and stops the indexing goroutine.
+// Stopping an indexer that is not running (not started, failed to start or already stopped) is a no-op
 func (indexer *blockchainIndexerAsync) stop() {
+	indexer.lifecycleLock.Lock()
+	defer indexer.lifecycleLock.Unlock()
+	if indexer.lifecycleState != indexerRunning {
+		return
+	}
+	indexer.lifecycleState = indexerStopped
 	indexer.indexerState.waitForLastCommittedBlock()
-	indexer.blockChan <- blockWrapper{nil, 0, nil, true}
-	<-indexer.blockChan
 	close(indexer.blockChan)
+	<-indexer.doneChan
+	atomic.AddInt32(&runningAsyncIndexers, -1)
+	indexer.compactionScheduler.stop()
+	indexer.statsSampler.stop()
+	indexer.batchPool.close()
+}
+
+func (indexer *blockchainIndexerAsync) statsHistory() []indexStatsSample {
+	return indexer.statsSampler.history()
 }
 
 // Code related to tracking the block number that has been indexed
@@ -316,14 +434,62 @@ func (indexerState *blockchainIndexerState) checkError() error {
 }
 
 func fetchLastIndexedBlockNumFromDB() (zerothBlockIndexed bool, lastIndexedBlockNum uint64, err error) {
-	lastIndexedBlockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(lastIndexedBlockKey)
+	lastIndexedBlockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeLastIndexedBlockKey())
 	if err != nil {
 		return
 	}
 	if lastIndexedBlockNumberBytes == nil {
 		return
 	}
-	lastIndexedBlockNum = decodeBlockNumber(lastIndexedBlockNumberBytes)
+	if lastIndexedBlockNum, err = decodeBlockNumber(lastIndexedBlockNumberBytes); err != nil {
+		return
+	}
 	zerothBlockIndexed = true
 	return
 }
+
+// reconcileIndexMarkers recomputes the last indexed block marker from the blockNumber -> blockhash index
+// and rewrites the marker. This repairs the marker after index entries are written out of order or in bulk
+// (e.g., via importIndexes). Since the async indexer resumes from the block next to the marker, the marker is set
+// to the highest block up to which the indexed block numbers are contiguous (starting from the pruned block number, if pruned),
+// so that the blocks in a gap get indexed. The marker is deleted if not even the first block is indexed.
+// This should be invoked while the async indexer is not running, as the indexer does not reload the marker
+func reconcileIndexMarkers() error {
+	prunedBelow, _, err := pruneStatus()
+	if err != nil {
+		return err
+	}
+	openchainDB := db.GetDBHandle()
+	itr := openchainDB.GetIndexesCFIterator()
+	defer itr.Close()
+
+	nextBlockNumber := prunedBelow
+	prefix := newIndexKey(prefixBlockNumberKey)
+	for itr.Seek(encodeBlockNumberKey(prunedBelow)); itr.ValidForPrefix(prefix); itr.Next() {
+		blockNumber, err := decodeBlockNumberKey(itr.Key().Data())
+		if err != nil {
+			return err
+		}
+		if blockNumber != nextBlockNumber {
+			break
+		}
+		nextBlockNumber++
+	}
+
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	if nextBlockNumber == 0 {
+		indexLogger.Debug("No indexed block found while reconciling the index markers. Removing the last indexed block marker")
+		writeBatch.DeleteCF(openchainDB.IndexesCF, encodeLastIndexedBlockKey())
+	} else {
+		indexLogger.Debugf("Setting the last indexed block marker to block number [%d]", nextBlockNumber-1)
+		writeBatch.PutCF(openchainDB.IndexesCF, encodeLastIndexedBlockKey(), encodeBlockNumber(nextBlockNumber-1))
+	}
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return openchainDB.DB.Write(opt, writeBatch)
+}
+
+func encodeLastIndexedBlockKey() []byte {
+	return newIndexKey(prefixLastIndexedBlockKey)
+}
@@ -19,9 +19,11 @@ package ledger
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/tecbot/gorocksdb"
@@ -164,8 +166,8 @@ func (noop *NoopIndexer) createIndexesAsync(block *protos.Block, blockNumber uin
 func (noop *NoopIndexer) fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error) {
 	return 0, nil
 }
-func (noop *NoopIndexer) fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error) {
-	return 0, 0, nil
+func (noop *NoopIndexer) fetchTransactionLocationByUUID(txUUID string) (*TransactionLocation, error) {
+	return &TransactionLocation{}, nil
 }
 func (noop *NoopIndexer) stop() {
 }
@@ -190,7 +192,7 @@ func TestIndexesAsync_IndexPendingBlocks(t *testing.T) {
 	// close the db and create new instance of blockchain (and the associated async indexer) - the indexer should index the pending blocks
 	testDBWrapper.CloseDB(t)
 	testBlockchainWrapper = newTestBlockchainWrapper(t)
-	defer chain.indexer.stop()
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
 
 	blockHash, _ := blocks[0].GetHash()
 	block := testBlockchainWrapper.getBlockByHash(blockHash)
@@ -200,3 +202,346 @@ func TestIndexesAsync_IndexPendingBlocks(t *testing.T) {
 	block = testBlockchainWrapper.getBlockByHash(blockHash)
 	testutil.AssertEquals(t, block, blocks[len(blocks)-1])
 }
+
+func TestIndexesAsync_IndexPendingBlocksError(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	chain := testBlockchainWrapper.blockchain
+	chain.indexer.stop()
+	chain.indexer = &NoopIndexer{}
+	for i := 0; i < 2; i++ {
+		block, _ := buildTestBlock(t)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	// the pending block 1 cannot be indexed, as its block number is indexed with another hash
+	openchainDB := db.GetDBHandle()
+	err := openchainDB.Put(openchainDB.IndexesCF, encodeBlockNumberKey(1), encodeIndexValue([]byte("otherHash")))
+	testutil.AssertNoError(t, err, "Error while writing the index entry")
+	indexer := newBlockchainIndexerAsync()
+	err = indexer.start(chain)
+	indexer.stop()
+	testutil.AssertError(t, err, "Expected an error indexing the pending blocks")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "is already indexed with block hash"), true)
+}
+
+func TestIndexesAsync_DurableWrites(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defaultDurableSetting := indexWritesDurably
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexWritesDurably = defaultDurableSetting
+	}()
+
+	for _, durable := range []bool{true, false} {
+		indexWritesDurably = durable
+		testutil.AssertEquals(t, newBlockchainIndexerAsync().durableWrites, durable)
+		testIndexesGetTransactionByUUID(t)
+	}
+}
+
+type testHasher struct {
+	numCalls int
+}
+
+func (hasher *testHasher) Hash(data []byte) []byte {
+	hasher.numCalls++
+	return []byte(fmt.Sprintf("testHash-%d", len(data)))
+}
+
+func TestIndexesAsync_InjectedHasher(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defaultHasher := indexHasher
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexHasher = defaultHasher
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	chain := testBlockchainWrapper.blockchain
+	chain.indexer.stop()
+	chain.indexer = &NoopIndexer{}
+	blocks, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+	if err != nil {
+		t.Fatalf("Error populating block chain with sample data: %s", err)
+	}
+
+	// the default hasher computes the same hash as the block itself
+	for _, block := range blocks {
+		expectedHash, _ := block.GetHash()
+		blockHash, err := computeBlockHash(block)
+		testutil.AssertNoError(t, err, "Error while computing block hash")
+		testutil.AssertEquals(t, blockHash, expectedHash)
+	}
+
+	// pending blocks are indexed by the async indexer using the injected hasher
+	hasher := &testHasher{}
+	indexHasher = hasher
+	testDBWrapper.CloseDB(t)
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	testutil.AssertEquals(t, hasher.numCalls, len(blocks))
+
+	lastBlock := blocks[len(blocks)-1]
+	blockHash, err := computeBlockHash(lastBlock)
+	testutil.AssertNoError(t, err, "Error while computing block hash")
+	testutil.AssertEquals(t, testBlockchainWrapper.getBlockByHash(blockHash), lastBlock)
+}
+
+func TestIndexesAsync_TryCreateIndexesQueueFull(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defaultCapacity := asyncIndexerQueueCapacity
+	asyncIndexerQueueCapacity = 1
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		asyncIndexerQueueCapacity = defaultCapacity
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	asyncIndexer, _ := testBlockchainWrapper.blockchain.indexer.(*blockchainIndexerAsync)
+
+	// hold the indexer state lock so that the worker stalls on the first block it receives
+	asyncIndexer.indexerState.lock.Lock()
+	blk1, _ := buildTestBlock(t)
+	testutil.AssertNoError(t, asyncIndexer.tryCreateIndexesAsync(blk1, 0, []byte("hash1")), "Error while queueing block")
+	for i := 0; len(asyncIndexer.blockChan) > 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	blk2, _ := buildTestBlock(t)
+	testutil.AssertNoError(t, asyncIndexer.tryCreateIndexesAsync(blk2, 1, []byte("hash2")), "Error while queueing block")
+	blk3, _ := buildTestBlock(t)
+	err := asyncIndexer.tryCreateIndexesAsync(blk3, 2, []byte("hash3"))
+	testutil.AssertSame(t, err, errIndexQueueFull)
+	asyncIndexer.indexerState.lock.Unlock()
+
+	for i := 0; asyncIndexer.indexerState.getLastIndexedBlockNumber() < 1 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB([]byte("hash2"))
+	testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+}
+
+func TestIndexes_IndexLag(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	chain := testBlockchainWrapper.blockchain
+	lag, err := chain.indexLag()
+	testutil.AssertNoError(t, err, "Error while computing index lag")
+	testutil.AssertEquals(t, lag, uint64(0))
+
+	_, _, err = testBlockchainWrapper.populateBlockChainWithSampleData()
+	if err != nil {
+		t.Fatalf("Error populating block chain with sample data: %s", err)
+	}
+	lag, err = chain.indexLag()
+	testutil.AssertNoError(t, err, "Error while computing index lag")
+	testutil.AssertEquals(t, lag, uint64(0))
+
+	// change the indexer to Noop - so, further blocks are not indexed
+	chain.indexer.stop()
+	chain.indexer = &NoopIndexer{}
+	for i := 0; i < 2; i++ {
+		block, _ := buildTestBlock(t)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	lag, err = chain.indexLag()
+	testutil.AssertNoError(t, err, "Error while computing index lag")
+	testutil.AssertEquals(t, lag, uint64(2))
+}
+
+func TestIndexes_IsCaughtUp(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	chain := testBlockchainWrapper.blockchain
+	caughtUp, err := chain.isCaughtUp()
+	testutil.AssertNoError(t, err, "Error while checking whether the index is caught up")
+	testutil.AssertEquals(t, caughtUp, true)
+
+	block, _ := buildTestBlock(t)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash0"))
+	caughtUp, err = chain.isCaughtUp()
+	testutil.AssertNoError(t, err, "Error while checking whether the index is caught up")
+	testutil.AssertEquals(t, caughtUp, true)
+
+	// blocks added with a Noop indexer are not indexed
+	chain.indexer.stop()
+	chain.indexer = &NoopIndexer{}
+	block, _ = buildTestBlock(t)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash1"))
+	caughtUp, err = chain.isCaughtUp()
+	testutil.AssertNoError(t, err, "Error while checking whether the index is caught up")
+	testutil.AssertEquals(t, caughtUp, false)
+}
+
+func TestIndexesAsync_ReconcileIndexMarkers(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	err := reconcileIndexMarkers()
+	testutil.AssertNoError(t, err, "Error while reconciling index markers")
+	zerothBlockIndexed, _, err := fetchLastIndexedBlockNumFromDB()
+	testutil.AssertNoError(t, err, "Error while fetching last indexed block number")
+	testutil.AssertEquals(t, zerothBlockIndexed, false)
+
+	// write index entries for blocks out of order (with a gap at block 4) along with a stale marker
+	openchainDB := db.GetDBHandle()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	for _, blockNumber := range []uint64{2, 0, 5, 3, 1} {
+		tx, _ := buildTestTx(t)
+		block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+		blockHash, _ := block.GetHash()
+		testutil.AssertNoError(t, addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch), "Error while adding index data")
+	}
+	writeBatch.PutCF(openchainDB.IndexesCF, encodeLastIndexedBlockKey(), encodeBlockNumber(0))
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	testutil.AssertNoError(t, openchainDB.DB.Write(opt, writeBatch), "Error while writing index data")
+
+	err = reconcileIndexMarkers()
+	testutil.AssertNoError(t, err, "Error while reconciling index markers")
+	zerothBlockIndexed, lastIndexedBlockNum, err := fetchLastIndexedBlockNumFromDB()
+	testutil.AssertNoError(t, err, "Error while fetching last indexed block number")
+	testutil.AssertEquals(t, zerothBlockIndexed, true)
+	testutil.AssertEquals(t, lastIndexedBlockNum, uint64(3))
+}
+
+func TestIndexesAsync_DoubleStart(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	chain, err := newBlockchain()
+	testutil.AssertNoError(t, err, "Error while creating the blockchain")
+	chain.indexer.stop()
+
+	indexer := newBlockchainIndexerAsync()
+	testutil.AssertNoError(t, indexer.start(chain), "Error while starting the indexer")
+	testutil.AssertNoError(t, indexer.start(chain), "Error while starting a running indexer")
+	testutil.AssertEquals(t, indexer.lifecycleState, indexerRunning)
+	tx, _ := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+	blockHash, _ := computeBlockHash(block)
+	testutil.AssertNoError(t, indexer.createIndexesAsync(block, 0, blockHash), "Error while queueing a block")
+	indexer.stop()
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+	indexer.stop()
+	testutil.AssertEquals(t, indexer.lifecycleState, indexerStopped)
+}
+
+func TestIndexesAsync_StopBeforeStart(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	chain, err := newBlockchain()
+	testutil.AssertNoError(t, err, "Error while creating the blockchain")
+	chain.indexer.stop()
+
+	indexer := newBlockchainIndexerAsync()
+	indexer.stop()
+	testutil.AssertEquals(t, indexer.lifecycleState, indexerNotStarted)
+	testutil.AssertNoError(t, indexer.start(chain), "Error while starting the indexer after a stop before start")
+	indexer.stop()
+}
+
+func TestIndexesAsync_StartStopStart(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	chain, err := newBlockchain()
+	testutil.AssertNoError(t, err, "Error while creating the blockchain")
+	chain.indexer.stop()
+
+	indexer := newBlockchainIndexerAsync()
+	testutil.AssertNoError(t, indexer.start(chain), "Error while starting the indexer")
+	indexer.stop()
+	err = indexer.start(chain)
+	testutil.AssertSame(t, err, errIndexerStopped)
+	indexer.stop()
+	testutil.AssertEquals(t, indexer.lifecycleState, indexerStopped)
+}
+
+func TestIndexesAsync_SubmitWhenNotRunning(t *testing.T) {
+	defaultCapacity := asyncIndexerQueueCapacity
+	asyncIndexerQueueCapacity = 4
+	defer func() { asyncIndexerQueueCapacity = defaultCapacity }()
+	testDBWrapper.CleanDB(t)
+	chain, err := newBlockchain()
+	testutil.AssertNoError(t, err, "Error while creating the blockchain")
+	chain.indexer.stop()
+
+	tx, _ := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+	blockHash, _ := computeBlockHash(block)
+	indexer := newBlockchainIndexerAsync()
+	testutil.AssertSame(t, indexer.tryCreateIndexesAsync(block, 0, blockHash), errIndexerNotRunning)
+	testutil.AssertSame(t, indexer.createIndexesAsync(block, 0, blockHash), errIndexerNotRunning)
+
+	// stop returns while the worker is still busy with the queued blocks
+	testutil.AssertNoError(t, indexer.start(chain), "Error while starting the indexer")
+	for i := uint64(0); i < 4; i++ {
+		tx, _ := buildTestTx(t)
+		block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+		blockHash, _ := computeBlockHash(block)
+		testutil.AssertNoError(t, indexer.tryCreateIndexesAsync(block, i, blockHash), "Error while queueing a block")
+	}
+	indexer.stop()
+	testutil.AssertEquals(t, indexer.indexerState.getLastIndexedBlockNumber(), uint64(3))
+
+	testutil.AssertSame(t, indexer.tryCreateIndexesAsync(block, 4, blockHash), errIndexerNotRunning)
+	testutil.AssertSame(t, indexer.createIndexesAsync(block, 4, blockHash), errIndexerNotRunning)
+}
+
+func TestIndexes_FindUnindexedBlocks(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	chain := testBlockchainWrapper.blockchain
+	indexer := chain.indexer
+	defer func() { indexer.stop() }()
+	unindexed, truncated, err := chain.findUnindexedBlocks(testScanLimits)
+	testutil.AssertNoError(t, err, "Error while finding unindexed blocks")
+	testutil.AssertEquals(t, len(unindexed), 0)
+	testutil.AssertEquals(t, truncated, false)
+
+	// blocks 1 and 3 are added while the indexer is Noop, so they are never indexed
+	for i := 0; i < 4; i++ {
+		if i%2 == 1 {
+			chain.indexer = &NoopIndexer{}
+		}
+		block, _ := buildTestBlock(t)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+		chain.indexer = indexer
+	}
+	isCaughtUp, err := chain.isCaughtUp()
+	testutil.AssertNoError(t, err, "Error while checking whether the index is caught up")
+	testutil.AssertEquals(t, isCaughtUp, false)
+
+	unindexed, truncated, err = chain.findUnindexedBlocks(testScanLimits)
+	testutil.AssertNoError(t, err, "Error while finding unindexed blocks")
+	testutil.AssertEquals(t, unindexed, []uint64{1, 3})
+	testutil.AssertEquals(t, truncated, false)
+
+	unindexed, truncated, err = chain.findUnindexedBlocks(newScanLimits(1))
+	testutil.AssertNoError(t, err, "Error while finding unindexed blocks")
+	testutil.AssertEquals(t, unindexed, []uint64{1})
+	testutil.AssertEquals(t, truncated, true)
+}
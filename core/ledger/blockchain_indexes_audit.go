@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexAuditEntry is an index entry that belongs to a block, as returned by auditBlockIndexEntries
+type indexAuditEntry struct {
+	Prefix byte   `json:"prefix"`
+	Key    []byte `json:"key"`
+	Value  []byte `json:"value"`
+}
+
+// auditBlockIndexEntries returns the index entries currently held for the given block, in the order in which
+// the keys are reconstructed from the block (see forEachBlockIndexKey). Entries that are shared by multiple blocks
+// (address -> chaincodeID, address -> latest block, address digests) and the cumulative transaction counts are not included
+func auditBlockIndexEntries(blockNumber uint64) ([]*indexAuditEntry, error) {
+	block, err := fetchBlockFromDB(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No block found with block number [%d]", blockNumber))
+	}
+	var keys [][]byte
+	seen := make(map[string]bool)
+	err = forEachBlockIndexKey(block, blockNumber, func(key []byte) {
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			keys = append(keys, key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// an iterator is used instead of point lookups so that the entries with an empty value are told apart from missing ones
+	itrs := make(map[*gorocksdb.ColumnFamilyHandle]*gorocksdb.Iterator)
+	defer func() {
+		for _, itr := range itrs {
+			itr.Close()
+		}
+	}()
+	prefixOffset := indexKeyHeaderLength() - 1
+	entries := []*indexAuditEntry{}
+	for _, key := range keys {
+		cf := indexCFForKey(key)
+		itr, ok := itrs[cf]
+		if !ok {
+			itr = db.GetDBHandle().GetIterator(cf)
+			itrs[cf] = itr
+		}
+		itr.Seek(key)
+		if !itr.Valid() || !bytes.Equal(itr.Key().Data(), key) {
+			continue
+		}
+		entries = append(entries, &indexAuditEntry{key[prefixOffset], key, statemgmt.Copy(itr.Value().Data())})
+	}
+	return entries, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_AuditBlockIndexEntries(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	_, err := auditBlockIndexEntries(0)
+	testutil.AssertError(t, err, "Expected an error while auditing a missing block")
+
+	tx1, _ := buildTestTx(t)
+	tx2, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+	entries, err := auditBlockIndexEntries(0)
+	testutil.AssertNoError(t, err, "Error while auditing the index entries of the block")
+
+	// with a single block indexed, every entry that is not shared across blocks belongs to the block
+	sharedPrefixes := map[byte]bool{
+		prefixLastIndexedBlockKey:            true,
+		prefixAddressChaincodeIDCompositeKey: true,
+		prefixTxCountBlockNumCompositeKey:    true,
+		prefixAddressDigestKey:               true,
+		prefixAddressLatestBlockKey:          true,
+		prefixIndexSchemaVersionKey:          true,
+		prefixActiveAddressCFKey:             true,
+		prefixIndexVerifyCursorKey:           true,
+		prefixAddressInternIDKey:             true,
+		prefixInternIDAddressKey:             true,
+		prefixIndexExpiryThresholdKey:        true,
+	}
+	expected := make(map[string][]byte)
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		key := itr.Key().Data()
+		if !sharedPrefixes[key[indexKeyHeaderLength()-1]] {
+			expected[string(key)] = append([]byte{}, itr.Value().Data()...)
+		}
+	}
+	testutil.AssertEquals(t, len(entries), len(expected))
+	for _, entry := range entries {
+		value, ok := expected[string(entry.Key)]
+		testutil.AssertEquals(t, ok, true)
+		testutil.AssertEquals(t, bytes.Equal(entry.Value, value), true)
+		testutil.AssertEquals(t, entry.Prefix, entry.Key[indexKeyHeaderLength()-1])
+	}
+	blockHash, _ := testBlockchainWrapper.getBlock(0).GetHash()
+	testutil.AssertEquals(t, entries[0].Prefix, prefixBlockHashKey)
+	testutil.AssertEquals(t, entries[0].Key, encodeBlockHashKey(blockHash))
+
+	// the entries of a block removed from the index are no longer reported
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, encodeBlockHashKey(blockHash)), "Error while deleting an index entry")
+	entriesAfterDelete, err := auditBlockIndexEntries(0)
+	testutil.AssertNoError(t, err, "Error while auditing the index entries of the block")
+	testutil.AssertEquals(t, len(entriesAfterDelete), len(entries)-1)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sync"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexWriteBatchPoolSize is the number of WriteBatches that the async indexer keeps for reuse, so that
+// indexing a block does not allocate a new WriteBatch under a high block rate. Zero disables the reuse
+var indexWriteBatchPoolSize = 2
+
+// writeBatchPool keeps cleared WriteBatches for reuse. A batch is handed out by get and only comes back to
+// the pool through put, which the owner calls once the commit of the batch has returned, so a batch is
+// never reused while it is being committed. A sync.Pool is not used, as it drops the pooled objects
+// without destroying them and a WriteBatch holds native memory. A nil pool allocates and destroys
+// a WriteBatch per use
+type writeBatchPool struct {
+	lock    sync.Mutex
+	size    int
+	batches []*gorocksdb.WriteBatch
+	closed  bool
+}
+
+// newWriteBatchPoolFromConfig returns a pool of indexWriteBatchPoolSize batches, or nil if the reuse is disabled
+func newWriteBatchPoolFromConfig() *writeBatchPool {
+	if indexWriteBatchPoolSize <= 0 {
+		return nil
+	}
+	return &writeBatchPool{size: indexWriteBatchPoolSize}
+}
+
+// get returns an empty WriteBatch
+func (pool *writeBatchPool) get() *gorocksdb.WriteBatch {
+	if pool == nil {
+		return gorocksdb.NewWriteBatch()
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if n := len(pool.batches); n > 0 {
+		writeBatch := pool.batches[n-1]
+		pool.batches = pool.batches[:n-1]
+		return writeBatch
+	}
+	return gorocksdb.NewWriteBatch()
+}
+
+// put clears the WriteBatch and keeps it for reuse, or destroys it if the pool is full or closed.
+// It should be called only after the commit of the batch has returned
+func (pool *writeBatchPool) put(writeBatch *gorocksdb.WriteBatch) {
+	if pool == nil {
+		writeBatch.Destroy()
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if pool.closed || len(pool.batches) >= pool.size {
+		writeBatch.Destroy()
+		return
+	}
+	writeBatch.Clear()
+	pool.batches = append(pool.batches, writeBatch)
+}
+
+// close destroys the pooled batches. The batches put afterwards are destroyed
+func (pool *writeBatchPool) close() {
+	if pool == nil {
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	for _, writeBatch := range pool.batches {
+		writeBatch.Destroy()
+	}
+	pool.batches = nil
+	pool.closed = true
+}
@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_WriteBatchPool(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	pool := &writeBatchPool{size: 1}
+	writeBatch := pool.get()
+	writeBatch.PutCF(db.GetDBHandle().IndexesCF, []byte("key"), []byte("value"))
+	other := pool.get()
+	testutil.AssertEquals(t, other != writeBatch, true)
+
+	// a returned batch is cleared and handed out again, while a batch beyond the pool size is destroyed
+	pool.put(writeBatch)
+	pool.put(other)
+	testutil.AssertEquals(t, len(pool.batches), 1)
+	reused := pool.get()
+	testutil.AssertEquals(t, reused == writeBatch, true)
+	testutil.AssertEquals(t, reused.Count(), 0)
+
+	pool.close()
+	pool.put(reused)
+	testutil.AssertEquals(t, len(pool.batches), 0)
+
+	// a nil pool allocates a batch per use
+	var nilPool *writeBatchPool
+	writeBatch = nilPool.get()
+	testutil.AssertNotNil(t, writeBatch)
+	nilPool.put(writeBatch)
+	nilPool.close()
+}
+
+func TestIndexesAsync_ReusedWriteBatches(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultPoolSize := indexWriteBatchPoolSize
+	indexBlockDataSynchronously = false
+	indexWriteBatchPoolSize = 1
+	defaultExtractor := getTxExecutingAddresses
+	executingAddresses := make(map[string]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexWriteBatchPoolSize = defaultPoolSize
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var uuids []string
+	for i := 0; i < 50; i++ {
+		tx, uuid := buildTestTx(t)
+		executingAddresses[uuid] = fmt.Sprintf("address%d", i)
+		uuids = append(uuids, uuid)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	indexer := testBlockchainWrapper.blockchain.indexer.(*blockchainIndexerAsync)
+	testutil.AssertNotNil(t, indexer.batchPool)
+
+	// no entry of a block leaks into the batch of the next one
+	for i, uuid := range uuids {
+		txLocation, err := indexer.fetchTransactionLocationByUUID(uuid)
+		testutil.AssertNoError(t, err, "Error while fetching transaction location")
+		testutil.AssertEquals(t, txLocation, &TransactionLocation{uint64(i), 0})
+		addresses, _, err := fetchAddressesInBlock(uint64(i), testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+		testutil.AssertEquals(t, addresses, []string{fmt.Sprintf("address%d", i)})
+	}
+}
+
+func BenchmarkIndexesAsync_CreateIndexesPooledBatches(b *testing.B) {
+	benchmarkIndexesAsyncCreateIndexes(b, 1)
+}
+
+func BenchmarkIndexesAsync_CreateIndexesNewBatches(b *testing.B) {
+	benchmarkIndexesAsyncCreateIndexes(b, 0)
+}
+
+func benchmarkIndexesAsyncCreateIndexes(b *testing.B, poolSize int) {
+	defaultPoolSize := indexWriteBatchPoolSize
+	indexWriteBatchPoolSize = poolSize
+	defer func() { indexWriteBatchPoolSize = defaultPoolSize }()
+	block := setupBenchmarkIndexedBlock(b)
+	indexer := newBlockchainIndexerAsync()
+	indexerState, err := newBlockchainIndexerState(indexer)
+	if err != nil {
+		b.Fatalf("Error while creating the indexer state: %s", err)
+	}
+	indexer.indexerState = indexerState
+	defer indexer.batchPool.close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 1; i <= b.N; i++ {
+		if err := indexer.createIndexesInternal(block, uint64(i), []byte(fmt.Sprintf("blockHash%d", i))); err != nil {
+			b.Fatalf("Error while indexing block: %s", err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexBulkChunkBlocks is the number of blocks whose index entries are committed in one WriteBatch by indexBlocks
+var indexBulkChunkBlocks = 100
+
+// errBulkIndexAsyncIndexerRunning is returned by indexBlocks while an async indexer is running
+var errBulkIndexAsyncIndexerRunning = errors.New("Cannot bulk index blocks while an async indexer is running")
+
+// indexBlocks indexes the given consecutive blocks, the first of which has the number startNumber, for bulk ingestion
+// (e.g., during a sync) where indexing the blocks one by one would cost a commit per block. The entries are committed
+// in chunks of indexBulkChunkBlocks blocks, each chunk atomically, and the last indexed block marker is updated only
+// with the last chunk. A failure leaves the chunks already committed in place and the marker behind them, so the
+// call can simply be repeated, as blocks that are already indexed are skipped. The blocks are refused while an async
+// indexer is running, as it keeps its own copy of the marker (errBulkIndexAsyncIndexerRunning).
+// The reads done while indexing a block do not see the entries of the earlier blocks of the same chunk, so the
+// cumulative transaction counts and the interned address ids are carried over here and indexVerifyUniqueTxUUIDs only
+// checks the uuids against the committed entries and within each block
+func indexBlocks(blocks []*protos.Block, startNumber uint64) error {
+	if indexBulkChunkBlocks <= 0 {
+		return fmt.Errorf("Bulk index chunk size should be greater than zero")
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	if atomic.LoadInt32(&runningAsyncIndexers) > 0 {
+		return errBulkIndexAsyncIndexerRunning
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	for chunkStart := 0; chunkStart < len(blocks); chunkStart += indexBulkChunkBlocks {
+		chunkEnd := chunkStart + indexBulkChunkBlocks
+		if chunkEnd > len(blocks) {
+			chunkEnd = len(blocks)
+		}
+		writeBatch := gorocksdb.NewWriteBatch()
+		indexWriteLock.RLock()
+		blockHashes, err := addIndexDataForBlocks(blocks[chunkStart:chunkEnd], startNumber+uint64(chunkStart), writeBatch)
+		if err == nil && chunkEnd == len(blocks) {
+			writeBatch.PutCF(openchainDB.IndexesCF, encodeLastIndexedBlockKey(), encodeBlockNumber(startNumber+uint64(len(blocks))-1))
+		}
+		if err == nil {
+			err = openchainDB.DB.Write(opt, writeBatch)
+		}
+		indexWriteLock.RUnlock()
+		for blockNumber := startNumber + uint64(chunkStart); blockNumber < startNumber+uint64(chunkEnd); blockNumber++ {
+			if err == nil {
+				indexWALCommitted(blockNumber)
+			} else {
+				indexWALDiscarded(blockNumber)
+			}
+		}
+		if err == nil {
+			indexExpiryCommitted(startNumber + uint64(chunkEnd) - 1)
+		}
+		writeBatch.Destroy()
+		if err != nil {
+			return err
+		}
+		for i, blockHash := range blockHashes {
+			indexEvents.publish(startNumber+uint64(chunkStart+i), blockHash)
+		}
+	}
+	indexLogger.Debugf("Indexed [%d] blocks starting at block number [%d]", len(blocks), startNumber)
+	return nil
+}
+
+// addIndexDataForBlocks adds to the writeBatch the index entries of the given consecutive blocks
+// and returns the hashes of the blocks
+func addIndexDataForBlocks(blocks []*protos.Block, startNumber uint64, writeBatch *gorocksdb.WriteBatch) ([][]byte, error) {
+	// the cumulative count of the first block is derived from the committed entries by addIndexDataForPersistence
+	txCount, txCountFound, err := fetchTxCountBeforeBlock(startNumber)
+	if err != nil {
+		return nil, err
+	}
+	// the ids of the addresses interned by the blocks of the chunk are likewise carried over the blocks
+	batchIDs := make(batchInternIDs)
+	var blockHashes [][]byte
+	for i, block := range blocks {
+		blockNumber := startNumber + uint64(i)
+		blockHash, err := computeBlockHash(block)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyBlockNumberNotIndexedWithDifferentHash(blockNumber, blockHash); err != nil {
+			return nil, err
+		}
+		if err := addIndexDataForBatch(block, blockNumber, blockHash, writeBatch, batchIDs); err != nil {
+			return nil, err
+		}
+		txCount += uint64(len(block.GetTransactions()))
+		if i > 0 && txCountFound {
+			writeBatch.PutCF(db.GetDBHandle().IndexesCF, encodeTxCountBlockNumCompositeKey(txCount, blockNumber), []byte{})
+		}
+		blockHashes = append(blockHashes, blockHash)
+	}
+	return blockHashes, nil
+}
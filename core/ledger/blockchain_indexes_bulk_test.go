@@ -0,0 +1,126 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_IndexBlocks(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultChunkBlocks := indexBulkChunkBlocks
+	indexBlockDataSynchronously = true
+	indexBulkChunkBlocks = 2
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexBulkChunkBlocks = defaultChunkBlocks
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var blocks []*protos.Block
+	var uuids [][]string
+	for i := 0; i < 5; i++ {
+		var transactions []*protos.Transaction
+		var blockUUIDs []string
+		for j := 0; j <= i%2; j++ {
+			tx, uuid := buildTestTx(t)
+			transactions = append(transactions, tx)
+			blockUUIDs = append(blockUUIDs, uuid)
+		}
+		blocks = append(blocks, protos.NewBlock(transactions, nil))
+		uuids = append(uuids, blockUUIDs)
+	}
+	testutil.AssertNoError(t, indexBlocks(blocks, 0), "Error while indexing blocks")
+
+	for i, block := range blocks {
+		blockHash, _ := block.GetHash()
+		blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+		testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+		testutil.AssertEquals(t, blockNumber, uint64(i))
+		for txIndex, uuid := range uuids[i] {
+			txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid)
+			testutil.AssertNoError(t, err, "Error while fetching transaction location")
+			testutil.AssertEquals(t, *txLocation, TransactionLocation{uint64(i), uint64(txIndex)})
+		}
+	}
+	zerothBlockIndexed, lastIndexedBlockNum, err := fetchLastIndexedBlockNumFromDB()
+	testutil.AssertNoError(t, err, "Error while fetching the last indexed block")
+	testutil.AssertEquals(t, zerothBlockIndexed, true)
+	testutil.AssertEquals(t, lastIndexedBlockNum, uint64(4))
+
+	// the cumulative transaction counts are carried across the blocks of a chunk and across the chunks
+	for ordinal, expectedBlockNumber := range []uint64{0, 1, 1, 2, 3, 3, 4} {
+		blockNumber, err := fetchBlockByGlobalTxOrdinal(uint64(ordinal))
+		testutil.AssertNoError(t, err, "Error while fetching block by tx ordinal")
+		testutil.AssertEquals(t, blockNumber, expectedBlockNumber)
+	}
+
+	// indexing the blocks again is a no-op
+	testutil.AssertNoError(t, indexBlocks(blocks, 0), "Error while indexing blocks again")
+	blockNumber, err := fetchBlockByGlobalTxOrdinal(6)
+	testutil.AssertNoError(t, err, "Error while fetching block by tx ordinal")
+	testutil.AssertEquals(t, blockNumber, uint64(4))
+
+	indexBulkChunkBlocks = 0
+	testutil.AssertError(t, indexBlocks(blocks, 0), "Expected an error for a zero chunk size")
+}
+
+func TestIndexes_IndexBlocksInjectedHasher(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultHasher := indexHasher
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexHasher = defaultHasher
+	}()
+	indexHasher = prefixHasher{}
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	block, _ := buildTestBlock(t)
+	testutil.AssertNoError(t, indexBlocks([]*protos.Block{block}, 0), "Error while indexing blocks")
+
+	// the block is indexed under the hash computed by the indexHasher, like the blocks indexed one by one
+	blockHash, err := computeBlockHash(block)
+	testutil.AssertNoError(t, err, "Error while computing the block hash")
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+}
+
+func TestIndexes_IndexBlocksAsyncIndexerRunning(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	block, _ := buildTestBlock(t)
+	err := indexBlocks([]*protos.Block{block}, 0)
+	testutil.AssertEquals(t, err, errBulkIndexAsyncIndexerRunning)
+
+	// the blocks are indexed once the async indexer is stopped
+	testBlockchainWrapper.blockchain.indexer.stop()
+	testutil.AssertNoError(t, indexBlocks([]*protos.Block{block}, 0), "Error while indexing blocks")
+}
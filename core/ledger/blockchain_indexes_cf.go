@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexSplitAddressCF, when true, stores the (address,blockNumber) entries, their continuations and the
+// (blockNumber,address) or blockNumber -> address ids entries in an address column family instead of the indexes column family.
+// The address entries are read by range scans while most of the other entries are read by point lookups, so keeping
+// them apart lets each column family be tuned for its access pattern (see db.Open). Switching this on an existing
+// ledger requires rebuildAddressIndex.
+// There are two address column families, addressIndexesCF and addressIndexesAltCF. Only the active one,
+// recorded by the activeAddressCF entry, holds entries; the other one is where rebuildAddressIndex builds
+// the new entries before swapping them in
+var indexSplitAddressCF = false
+
+// values of the activeAddressCF entry. A missing entry means activeAddressCFPrimary
+const (
+	activeAddressCFPrimary   = byte(0)
+	activeAddressCFAlternate = byte(1)
+)
+
+// activeAddressCF caches the active address column family of the opened db. The cache is keyed by the
+// rocksdb handle so that it is read again once the db is reopened
+var activeAddressCF struct {
+	sync.Mutex
+	rocksDB   *gorocksdb.DB
+	alternate bool
+}
+
+// isAddressIndexPrefix returns true for the prefixes of the entries that are moved by indexSplitAddressCF
+func isAddressIndexPrefix(prefix byte) bool {
+	return prefix == prefixAddressBlockNumCompositeKey || prefix == prefixAddressTxIndexesContinuationKey ||
+		prefix == prefixBlockNumAddressCompositeKey || prefix == prefixBlockAddressIDsKey
+}
+
+// indexCFForPrefix returns the column family that holds the index entries with the given prefix
+func indexCFForPrefix(prefix byte) *gorocksdb.ColumnFamilyHandle {
+	openchainDB := db.GetDBHandle()
+	if indexSplitAddressCF && isAddressIndexPrefix(prefix) {
+		return addressColumnFamily(isAlternateAddressCFActive())
+	}
+	return openchainDB.IndexesCF
+}
+
+// indexCFForKey returns the column family that holds the given index key
+func indexCFForKey(key []byte) *gorocksdb.ColumnFamilyHandle {
+	if len(key) < indexKeyHeaderLength() {
+		return db.GetDBHandle().IndexesCF
+	}
+	return indexCFForPrefix(key[indexKeyHeaderLength()-1])
+}
+
+// newIndexIterator returns an iterator over the column family that holds the index entries with the given prefix
+func newIndexIterator(prefix byte) *gorocksdb.Iterator {
+	return db.GetDBHandle().GetIterator(indexCFForPrefix(prefix))
+}
+
+// getIndexValue reads the given index key from the column family that holds it
+func getIndexValue(key []byte) ([]byte, error) {
+	return db.GetDBHandle().Get(indexCFForKey(key), key)
+}
+
+// indexColumnFamilies returns the column families that hold index entries
+func indexColumnFamilies() []*gorocksdb.ColumnFamilyHandle {
+	openchainDB := db.GetDBHandle()
+	if indexSplitAddressCF {
+		return []*gorocksdb.ColumnFamilyHandle{openchainDB.IndexesCF, addressColumnFamily(isAlternateAddressCFActive())}
+	}
+	return []*gorocksdb.ColumnFamilyHandle{openchainDB.IndexesCF}
+}
+
+// addressColumnFamily returns addressIndexesAltCF if alternate is true and addressIndexesCF otherwise
+func addressColumnFamily(alternate bool) *gorocksdb.ColumnFamilyHandle {
+	if alternate {
+		return db.GetDBHandle().AddressIndexesAltCF
+	}
+	return db.GetDBHandle().AddressIndexesCF
+}
+
+// isAlternateAddressCFActive returns true if addressIndexesAltCF is the active address column family
+func isAlternateAddressCFActive() bool {
+	openchainDB := db.GetDBHandle()
+	activeAddressCF.Lock()
+	defer activeAddressCF.Unlock()
+	if activeAddressCF.rocksDB != openchainDB.DB {
+		value, err := openchainDB.GetFromIndexesCF(encodeActiveAddressCFKey())
+		if err != nil {
+			indexLogger.Errorf("Error reading the active address column family, using addressIndexesCF: %s", err)
+			return false
+		}
+		activeAddressCF.rocksDB = openchainDB.DB
+		activeAddressCF.alternate = len(value) == 1 && value[0] == activeAddressCFAlternate
+	}
+	return activeAddressCF.alternate
+}
+
+// setActiveAddressCF records the active address column family. From then on the address entries are read
+// from and written to that column family
+func setActiveAddressCF(alternate bool) error {
+	value := activeAddressCFPrimary
+	if alternate {
+		value = activeAddressCFAlternate
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	activeAddressCF.Lock()
+	defer activeAddressCF.Unlock()
+	if err := openchainDB.DB.PutCF(opt, openchainDB.IndexesCF, encodeActiveAddressCFKey(), []byte{value}); err != nil {
+		return err
+	}
+	activeAddressCF.rocksDB = openchainDB.DB
+	activeAddressCF.alternate = alternate
+	return nil
+}
+
+func encodeActiveAddressCFKey() []byte {
+	return newIndexKey(prefixActiveAddressCFKey)
+}
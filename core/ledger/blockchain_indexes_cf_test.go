@@ -0,0 +1,118 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+)
+
+func TestIndexes_SplitAddressCF(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultSplit := indexSplitAddressCF
+	indexBlockDataSynchronously = true
+	indexSplitAddressCF = true
+	defaultExtractor := getTxExecutingAddresses
+	executingAddresses := make(map[string]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexSplitAddressCF = defaultSplit
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var uuids []string
+	for i := 0; i < 3; i++ {
+		var transactions []*protos.Transaction
+		for j := 0; j < 2; j++ {
+			tx, uuid := buildTestTx(t)
+			executingAddresses[uuid] = fmt.Sprintf("address%d", j)
+			transactions = append(transactions, tx)
+			uuids = append(uuids, uuid)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	countPrefixes := func(cf *gorocksdb.ColumnFamilyHandle) (int, int) {
+		itr := db.GetDBHandle().GetIterator(cf)
+		defer itr.Close()
+		addressEntries, otherEntries := 0, 0
+		for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+			if isAddressIndexPrefix(itr.Key().Data()[indexKeyHeaderLength()-1]) {
+				addressEntries++
+			} else {
+				otherEntries++
+			}
+		}
+		return addressEntries, otherEntries
+	}
+	assertLayout := func() {
+		addressEntries, _ := countPrefixes(db.GetDBHandle().IndexesCF)
+		testutil.AssertEquals(t, addressEntries, 0)
+		alternate := isAlternateAddressCFActive()
+		addressEntries, otherEntries := countPrefixes(addressColumnFamily(alternate))
+		testutil.AssertEquals(t, addressEntries, 12)
+		testutil.AssertEquals(t, otherEntries, 0)
+		addressEntries, otherEntries = countPrefixes(addressColumnFamily(!alternate))
+		testutil.AssertEquals(t, addressEntries+otherEntries, 0)
+	}
+	assertQueries := func() {
+		for _, address := range []string{"address0", "address1"} {
+			txLocations, _, err := fetchTransactionIndexesByAddress(address, testScanLimits)
+			testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+			testutil.AssertEquals(t, len(txLocations), 3)
+		}
+		addresses, _, err := fetchAddressesInBlock(1, testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+		testutil.AssertEquals(t, addresses, []string{"address0", "address1"})
+	}
+	testutil.AssertEquals(t, isAlternateAddressCFActive(), false)
+	assertLayout()
+	assertQueries()
+
+	// the point lookups still go to the indexes column family
+	blockNumber, txIndex, err := fetchTransactionIndexByUUIDFromDB(uuids[3])
+	testutil.AssertNoError(t, err, "Error while fetching transaction index by uuid")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+	testutil.AssertEquals(t, txIndex, uint64(1))
+
+	repaired, err := repairOrphanedAddressEntries()
+	testutil.AssertNoError(t, err, "Error while repairing the address entries")
+	testutil.AssertEquals(t, repaired, uint64(0))
+
+	testutil.AssertNoError(t, appendAddressTxIndexes("address2", 2, []uint64{0}), "Error while appending address tx indexes")
+	txLocations, _, err := fetchTransactionIndexesByAddress("address2", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txLocations), 1)
+
+	numBlocks, err := rebuildAddressIndex()
+	testutil.AssertNoError(t, err, "Error while rebuilding the address index")
+	testutil.AssertEquals(t, numBlocks, uint64(3))
+	testutil.AssertEquals(t, isAlternateAddressCFActive(), true)
+	assertLayout()
+	assertQueries()
+}
@@ -0,0 +1,108 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// indexCompactionInterval is the interval at which the indexes column family is compacted in the background.
+// Zero disables the background compaction
+var indexCompactionInterval = time.Duration(0)
+
+// indexMaintenanceLock serializes the operations that rewrite the index in bulk (import, prune)
+// and the background compaction, so that a compaction does not run concurrently with them
+var indexMaintenanceLock sync.Mutex
+
+// indexCompactionScheduler periodically compacts the indexes column family.
+// A compaction is triggered only if no block has been indexed since the previous tick,
+// so that the compaction runs during idle periods
+type indexCompactionScheduler struct {
+	interval       time.Duration
+	activity       uint64
+	numCompactions int
+	started        bool
+	stopOnce       sync.Once
+	stopChan       chan struct{}
+	doneChan       chan struct{}
+}
+
+func newIndexCompactionScheduler(interval time.Duration) *indexCompactionScheduler {
+	return &indexCompactionScheduler{interval: interval, stopChan: make(chan struct{}), doneChan: make(chan struct{})}
+}
+
+// newIndexCompactionSchedulerFromConfig returns a scheduler as per indexCompactionInterval, or nil if disabled
+func newIndexCompactionSchedulerFromConfig() *indexCompactionScheduler {
+	if indexCompactionInterval <= 0 {
+		return nil
+	}
+	return newIndexCompactionScheduler(indexCompactionInterval)
+}
+
+func (scheduler *indexCompactionScheduler) start() {
+	if scheduler == nil {
+		return
+	}
+	scheduler.started = true
+	go func() {
+		defer close(scheduler.doneChan)
+		ticker := time.NewTicker(scheduler.interval)
+		defer ticker.Stop()
+		lastActivity := atomic.LoadUint64(&scheduler.activity)
+		for {
+			select {
+			case <-scheduler.stopChan:
+				return
+			case <-ticker.C:
+				activity := atomic.LoadUint64(&scheduler.activity)
+				if activity != lastActivity {
+					lastActivity = activity
+					continue
+				}
+				scheduler.compact()
+			}
+		}
+	}()
+}
+
+// recordActivity notes that a block has been indexed
+func (scheduler *indexCompactionScheduler) recordActivity() {
+	if scheduler == nil {
+		return
+	}
+	atomic.AddUint64(&scheduler.activity, 1)
+}
+
+func (scheduler *indexCompactionScheduler) compact() {
+	compactIndexes()
+	scheduler.numCompactions++
+}
+
+// stop stops the scheduler and waits for an ongoing compaction, if any, to finish. It is safe to call stop more than once
+func (scheduler *indexCompactionScheduler) stop() {
+	if scheduler == nil {
+		return
+	}
+	scheduler.stopOnce.Do(func() {
+		close(scheduler.stopChan)
+		if scheduler.started {
+			<-scheduler.doneChan
+		}
+	})
+}
@@ -0,0 +1,61 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestIndexes_CompactionSchedulerStartStop(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	numGoroutines := runtime.NumGoroutine()
+	scheduler := newIndexCompactionScheduler(time.Millisecond)
+	scheduler.start()
+	time.Sleep(20 * time.Millisecond)
+	scheduler.stop()
+	scheduler.stop()
+	testutil.AssertEquals(t, scheduler.numCompactions > 0, true)
+
+	// the scheduler goroutine should have exited
+	for i := 0; i < 100 && runtime.NumGoroutine() > numGoroutines; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	testutil.AssertEquals(t, runtime.NumGoroutine(), numGoroutines)
+
+	// a scheduler that was never started can be stopped
+	newIndexCompactionScheduler(time.Millisecond).stop()
+}
+
+func TestIndexes_CompactionSchedulerFromConfig(t *testing.T) {
+	defaultInterval := indexCompactionInterval
+	defer func() { indexCompactionInterval = defaultInterval }()
+
+	indexCompactionInterval = 0
+	testutil.AssertNil(t, newIndexCompactionSchedulerFromConfig())
+	testutil.AssertNil(t, newBlockchainIndexerSync().compactionScheduler)
+
+	indexCompactionInterval = time.Minute
+	testutil.AssertEquals(t, newBlockchainIndexerSync().compactionScheduler.interval, time.Minute)
+	testutil.AssertEquals(t, newBlockchainIndexerAsync().compactionScheduler.interval, time.Minute)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexSource is a read-only view of the index key space of a db. *db.OpenchainDB implements it
+type indexSource interface {
+	GetIndexesCFIterator() *gorocksdb.Iterator
+}
+
+// indexDivergence is the first difference between two index key spaces found by compareIndexes.
+// value and otherValue are the values of the key in this db and in the other db, nil if the key is missing
+type indexDivergence struct {
+	key        []byte
+	value      []byte
+	otherValue []byte
+}
+
+func (divergence *indexDivergence) String() string {
+	switch {
+	case divergence.value == nil:
+		return fmt.Sprintf("Key [%x] is missing in this db", divergence.key)
+	case divergence.otherValue == nil:
+		return fmt.Sprintf("Key [%x] is missing in the other db", divergence.key)
+	default:
+		return fmt.Sprintf("Key [%x] has value [%x] in this db and value [%x] in the other db",
+			divergence.key, divergence.value, divergence.otherValue)
+	}
+}
+
+// compareIndexes walks the index key spaces of this db and of the other db in key order and returns the first
+// divergence, or nil if they are identical. This is meant for validating a migration of the indexes
+// or an export/import round trip. Neither db is modified. Only the indexes column family is compared,
+// so the address entries are not covered if indexSplitAddressCF is set
+func compareIndexes(other indexSource) (*indexDivergence, error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	otherItr := other.GetIndexesCFIterator()
+	defer otherItr.Close()
+
+	numKeys := 0
+	itr.SeekToFirst()
+	otherItr.SeekToFirst()
+	for itr.Valid() || otherItr.Valid() {
+		var cmp int
+		switch {
+		case !itr.Valid():
+			cmp = 1
+		case !otherItr.Valid():
+			cmp = -1
+		default:
+			cmp = bytes.Compare(itr.Key().Data(), otherItr.Key().Data())
+		}
+		switch {
+		case cmp < 0:
+			return &indexDivergence{statemgmt.Copy(itr.Key().Data()), statemgmt.Copy(itr.Value().Data()), nil}, nil
+		case cmp > 0:
+			return &indexDivergence{statemgmt.Copy(otherItr.Key().Data()), nil, statemgmt.Copy(otherItr.Value().Data())}, nil
+		}
+		if !bytes.Equal(itr.Value().Data(), otherItr.Value().Data()) {
+			return &indexDivergence{statemgmt.Copy(itr.Key().Data()), statemgmt.Copy(itr.Value().Data()),
+				statemgmt.Copy(otherItr.Value().Data())}, nil
+		}
+		numKeys++
+		itr.Next()
+		otherItr.Next()
+	}
+	indexLogger.Debugf("Compared [%d] index entries. No divergence found", numKeys)
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/tecbot/gorocksdb"
+)
+
+// testIndexCopy is a standalone db holding a copy of the index entries in its default column family
+type testIndexCopy struct {
+	dir string
+	db  *gorocksdb.DB
+}
+
+func newTestIndexCopy(t *testing.T) *testIndexCopy {
+	dir, err := ioutil.TempDir("", "indexcopy")
+	testutil.AssertNoError(t, err, "Error creating temp dir")
+	opts := gorocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+	opts.SetCreateIfMissing(true)
+	copyDB, err := gorocksdb.OpenDb(opts, dir)
+	testutil.AssertNoError(t, err, "Error opening db for the copy of the indexes")
+
+	writeOpts := gorocksdb.NewDefaultWriteOptions()
+	defer writeOpts.Destroy()
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		err := copyDB.Put(writeOpts, itr.Key().Data(), itr.Value().Data())
+		testutil.AssertNoError(t, err, "Error copying index entry")
+	}
+	return &testIndexCopy{dir, copyDB}
+}
+
+func (indexCopy *testIndexCopy) GetIndexesCFIterator() *gorocksdb.Iterator {
+	opts := gorocksdb.NewDefaultReadOptions()
+	defer opts.Destroy()
+	return indexCopy.db.NewIterator(opts)
+}
+
+func (indexCopy *testIndexCopy) put(t *testing.T, key []byte, value []byte) {
+	opts := gorocksdb.NewDefaultWriteOptions()
+	defer opts.Destroy()
+	testutil.AssertNoError(t, indexCopy.db.Put(opts, key, value), "Error writing to the copy of the indexes")
+}
+
+func (indexCopy *testIndexCopy) delete(t *testing.T, key []byte) {
+	opts := gorocksdb.NewDefaultWriteOptions()
+	defer opts.Destroy()
+	testutil.AssertNoError(t, indexCopy.db.Delete(opts, key), "Error deleting from the copy of the indexes")
+}
+
+func (indexCopy *testIndexCopy) close() {
+	indexCopy.db.Close()
+	os.RemoveAll(indexCopy.dir)
+}
+
+func TestIndexes_CompareIndexes(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	blocks, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+	testutil.AssertNoError(t, err, "Error populating block chain with sample data")
+
+	indexCopy := newTestIndexCopy(t)
+	defer indexCopy.close()
+	divergence, err := compareIndexes(indexCopy)
+	testutil.AssertNoError(t, err, "Error comparing equal indexes")
+	testutil.AssertNil(t, divergence)
+
+	// value mismatch
+	txUUIDKey := encodeTxUUIDKey(blocks[1].GetTransactions()[0].Uuid)
+	originalValue, err := db.GetDBHandle().GetFromIndexesCF(txUUIDKey)
+	testutil.AssertNoError(t, err, "Error reading tx uuid index")
+	indexCopy.put(t, txUUIDKey, []byte("corrupted"))
+	divergence, err = compareIndexes(indexCopy)
+	testutil.AssertNoError(t, err, "Error comparing indexes")
+	testutil.AssertEquals(t, divergence.key, txUUIDKey)
+	testutil.AssertEquals(t, divergence.value, originalValue)
+	testutil.AssertEquals(t, divergence.otherValue, []byte("corrupted"))
+	testutil.AssertEquals(t, strings.Contains(divergence.String(), "has value"), true)
+
+	// key missing in the other db
+	indexCopy.delete(t, txUUIDKey)
+	divergence, err = compareIndexes(indexCopy)
+	testutil.AssertNoError(t, err, "Error comparing indexes")
+	testutil.AssertEquals(t, divergence.key, txUUIDKey)
+	testutil.AssertNil(t, divergence.otherValue)
+	testutil.AssertEquals(t, strings.Contains(divergence.String(), "missing in the other db"), true)
+
+	// key missing in this db
+	indexCopy.put(t, txUUIDKey, originalValue)
+	extraKey := append(newIndexKey(prefixTxUUIDKey), []byte("extraUUID")...)
+	indexCopy.put(t, extraKey, originalValue)
+	divergence, err = compareIndexes(indexCopy)
+	testutil.AssertNoError(t, err, "Error comparing indexes")
+	testutil.AssertEquals(t, divergence.key, extraKey)
+	testutil.AssertNil(t, divergence.value)
+	testutil.AssertEquals(t, strings.Contains(divergence.String(), "missing in this db"), true)
+}
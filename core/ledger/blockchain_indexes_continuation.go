@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexMaxAddressTxIndexes, when non-zero, is the maximum number of tx indexes stored in the value of an
+// (address,blockNumber) entry. The tx indexes beyond it spill into continuation entries of up to as many tx indexes
+// each, so that an address with many transactions in a block does not produce one huge value. The continuations of an
+// entry are looked up only if the entry holds exactly indexMaxAddressTxIndexes tx indexes, so the setting should not be
+// changed for an existing db without rebuilding the address index (see rebuildAddressIndex)
+var indexMaxAddressTxIndexes = 0
+
+// splitAddressTxIndexes splits the tx indexes of an address in a block into the ones stored in the
+// (address,blockNumber) entry and the ones stored in each of its continuation entries
+func splitAddressTxIndexes(txIndexes []uint64) (head []uint64, continuations [][]uint64) {
+	if indexMaxAddressTxIndexes <= 0 || len(txIndexes) <= indexMaxAddressTxIndexes {
+		return txIndexes, nil
+	}
+	head = txIndexes[:indexMaxAddressTxIndexes]
+	for rest := txIndexes[indexMaxAddressTxIndexes:]; len(rest) > 0; {
+		n := indexMaxAddressTxIndexes
+		if n > len(rest) {
+			n = len(rest)
+		}
+		continuations = append(continuations, rest[:n])
+		rest = rest[n:]
+	}
+	return head, continuations
+}
+
+// numAddressTxIndexesContinuations returns the number of continuation entries used for the given number of tx indexes
+func numAddressTxIndexesContinuations(numTxIndexes int) int {
+	if indexMaxAddressTxIndexes <= 0 || numTxIndexes <= indexMaxAddressTxIndexes {
+		return 0
+	}
+	return (numTxIndexes - 1) / indexMaxAddressTxIndexes
+}
+
+// hasAddressTxIndexesContinuations returns true if an (address,blockNumber) entry holding the given tx indexes
+// may have continuation entries
+func hasAddressTxIndexesContinuations(txIndexes []uint64) bool {
+	return indexMaxAddressTxIndexes > 0 && len(txIndexes) == indexMaxAddressTxIndexes
+}
+
+// putAddressTxIndexes adds the (address,blockNumber) -> txIndexes entry and its continuation entries, if any
+func putAddressTxIndexes(address string, blockNumber uint64, txIndexes []uint64, putIndex func(key []byte, value []byte)) {
+	putListTxIndexes(encodeAddressBlockNumCompositeKey(address, blockNumber), txIndexes, putIndex)
+}
+
+// putListTxIndexes adds the given (address,blockNumber) key with the tx indexes and its continuation entries, if any
+func putListTxIndexes(key []byte, txIndexes []uint64, putIndex func(key []byte, value []byte)) {
+	head, continuations := splitAddressTxIndexes(txIndexes)
+	putIndex(key, encodeIndexValue(encodeListTxIndexes(head)))
+	for i, continuation := range continuations {
+		putIndex(encodeAddressTxIndexesContinuationKey(key, uint64(i)), encodeIndexValue(encodeListTxIndexes(continuation)))
+	}
+}
+
+// fetchAddressTxIndexesContinuations returns the tx indexes stored in the continuation entries of the given
+// (address,blockNumber) key, in order. itr should be an iterator over the column family of the address entries
+func fetchAddressTxIndexesContinuations(itr *gorocksdb.Iterator, addressBlockNumKey []byte) ([]uint64, error) {
+	var txIndexes []uint64
+	prefix := encodeAddressTxIndexesContinuationKeyPrefix(addressBlockNumKey)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		value, err := decodeIndexValue(statemgmt.Copy(itr.Value().Data()))
+		if err != nil {
+			return nil, err
+		}
+		continuation, err := decodeListTxIndexes(value)
+		if err != nil {
+			return nil, err
+		}
+		txIndexes = append(txIndexes, continuation...)
+	}
+	return txIndexes, nil
+}
+
+// a continuation key is the key of its (address,blockNumber) entry, under its own prefix, followed by the
+// sequence number of the continuation. As the address bytes are length prefixed and the block number is a varint,
+// the continuation keys of an entry never share a key prefix with the continuation keys of another entry
+func encodeAddressTxIndexesContinuationKey(addressBlockNumKey []byte, seq uint64) []byte {
+	return append(encodeAddressTxIndexesContinuationKeyPrefix(addressBlockNumKey), encodeIndexUint64(seq)...)
+}
+
+func encodeAddressTxIndexesContinuationKeyPrefix(addressBlockNumKey []byte) []byte {
+	return prependKeyPrefix(prefixAddressTxIndexesContinuationKey, addressBlockNumKey[indexKeyHeaderLength():])
+}
@@ -0,0 +1,128 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_AddressTxIndexesContinuations(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultMaxTxIndexes := indexMaxAddressTxIndexes
+	indexBlockDataSynchronously = true
+	indexMaxAddressTxIndexes = 2
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexMaxAddressTxIndexes = defaultMaxTxIndexes
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// all the transactions are executed by the default address
+	for i, numTxs := range []int{7, 3} {
+		var transactions []*protos.Transaction
+		for j := 0; j < numTxs; j++ {
+			tx, _ := buildTestTx(t)
+			transactions = append(transactions, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	countContinuations := func() int {
+		itr := newIndexIterator(prefixAddressTxIndexesContinuationKey)
+		defer itr.Close()
+		count := 0
+		prefix := newIndexKey(prefixAddressTxIndexesContinuationKey)
+		for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+			count++
+		}
+		return count
+	}
+	expectedLocations := func(numTxsPerBlock map[uint64]int) []*TransactionLocation {
+		var txLocations []*TransactionLocation
+		for blockNumber := uint64(0); blockNumber < 2; blockNumber++ {
+			for txIndex := 0; txIndex < numTxsPerBlock[blockNumber]; txIndex++ {
+				txLocations = append(txLocations, &TransactionLocation{blockNumber, uint64(txIndex)})
+			}
+		}
+		return txLocations
+	}
+	assertLocations := func(numTxsPerBlock map[uint64]int) {
+		txLocations, truncated, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+		testutil.AssertEquals(t, truncated, false)
+		testutil.AssertEquals(t, txLocations, expectedLocations(numTxsPerBlock))
+	}
+
+	// 7 tx indexes are stored as 2 in the entry and 2, 2, 1 in continuations. 3 tx indexes as 2 and 1
+	testutil.AssertEquals(t, countContinuations(), 4)
+	assertLocations(map[uint64]int{0: 7, 1: 3})
+
+	auditEntries, err := auditBlockIndexEntries(0)
+	testutil.AssertNoError(t, err, "Error while auditing the block index entries")
+	auditedContinuations := 0
+	for _, entry := range auditEntries {
+		if entry.Prefix == prefixAddressTxIndexesContinuationKey {
+			auditedContinuations++
+		}
+	}
+	testutil.AssertEquals(t, auditedContinuations, 3)
+
+	numBlocks, err := rebuildAddressIndex()
+	testutil.AssertNoError(t, err, "Error while rebuilding the address index")
+	testutil.AssertEquals(t, numBlocks, uint64(2))
+	testutil.AssertEquals(t, countContinuations(), 4)
+	assertLocations(map[uint64]int{0: 7, 1: 3})
+
+	// the appended tx indexes spill into a new continuation
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 1, []uint64{2, 3, 4}), "Error while appending address tx indexes")
+	testutil.AssertEquals(t, countContinuations(), 5)
+	assertLocations(map[uint64]int{0: 7, 1: 5})
+
+	// pruning a block removes the continuations of its entries
+	_, err = pruneIndexesBelow(1, 1, 0)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	testutil.AssertEquals(t, countContinuations(), 2)
+	assertLocations(map[uint64]int{1: 5})
+}
+
+func TestIndexes_SplitAddressTxIndexes(t *testing.T) {
+	defaultMaxTxIndexes := indexMaxAddressTxIndexes
+	defer func() { indexMaxAddressTxIndexes = defaultMaxTxIndexes }()
+
+	indexMaxAddressTxIndexes = 0
+	head, continuations := splitAddressTxIndexes([]uint64{0, 1, 2})
+	testutil.AssertEquals(t, head, []uint64{0, 1, 2})
+	testutil.AssertNil(t, continuations)
+
+	indexMaxAddressTxIndexes = 3
+	head, continuations = splitAddressTxIndexes([]uint64{0, 1, 2})
+	testutil.AssertEquals(t, head, []uint64{0, 1, 2})
+	testutil.AssertNil(t, continuations)
+	testutil.AssertEquals(t, numAddressTxIndexesContinuations(3), 0)
+
+	head, continuations = splitAddressTxIndexes([]uint64{0, 1, 2, 3, 4, 5, 6})
+	testutil.AssertEquals(t, head, []uint64{0, 1, 2})
+	testutil.AssertEquals(t, continuations, [][]uint64{{3, 4, 5}, {6}})
+	testutil.AssertEquals(t, numAddressTxIndexesContinuations(7), 2)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexReadAheadSteps is the number of entries an indexKeyCursor steps forward over before it falls back to a seek
+var indexReadAheadSteps = 16
+
+// indexKeyCursor looks up index keys with a forward iterator. When the keys are looked up
+// in (mostly) ascending order, consecutive lookups read neighbouring entries sequentially instead of
+// doing a random read per key. A key that is behind the cursor, or too far ahead of it, is sought
+type indexKeyCursor struct {
+	itr *gorocksdb.Iterator
+}
+
+// newIndexKeyCursor returns a cursor over the indexes column family
+func newIndexKeyCursor() *indexKeyCursor {
+	return newIndexKeyCursorCF(db.GetDBHandle().IndexesCF)
+}
+
+// newIndexKeyCursorCF returns a cursor over the given index column family
+func newIndexKeyCursorCF(cf *gorocksdb.ColumnFamilyHandle) *indexKeyCursor {
+	return &indexKeyCursor{db.GetDBHandle().GetIterator(cf)}
+}
+
+// exists returns true if the key is present in the column family of the cursor
+func (cursor *indexKeyCursor) exists(key []byte) bool {
+	return cursor.seek(key)
+}
+
+// value returns a copy of the value of the key, or nil if the key is not present
+func (cursor *indexKeyCursor) value(key []byte) []byte {
+	if !cursor.seek(key) {
+		return nil
+	}
+	return statemgmt.Copy(cursor.itr.Value().Data())
+}
+
+// seek moves the cursor to the first key that is not before the given key and returns true if it is the key
+func (cursor *indexKeyCursor) seek(key []byte) bool {
+	itr := cursor.itr
+	if !itr.Valid() || bytes.Compare(itr.Key().Data(), key) > 0 {
+		itr.Seek(key)
+	}
+	for steps := 0; itr.Valid() && bytes.Compare(itr.Key().Data(), key) < 0; steps++ {
+		if steps == indexReadAheadSteps {
+			itr.Seek(key)
+			break
+		}
+		itr.Next()
+	}
+	return itr.Valid() && bytes.Equal(itr.Key().Data(), key)
+}
+
+// err returns the error, if any, hit by the iterator of the cursor
+func (cursor *indexKeyCursor) err() error {
+	return cursor.itr.Err()
+}
+
+func (cursor *indexKeyCursor) close() {
+	cursor.itr.Close()
+}
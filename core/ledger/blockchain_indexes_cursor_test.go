@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/tecbot/gorocksdb"
+)
+
+func TestIndexes_IndexKeyCursor(t *testing.T) {
+	defaultReadAhead := indexReadAheadSteps
+	indexReadAheadSteps = 2
+	defer func() { indexReadAheadSteps = defaultReadAhead }()
+
+	testDBWrapper.CleanDB(t)
+	openchainDB := db.GetDBHandle()
+	for blockNumber := uint64(0); blockNumber < 20; blockNumber += 2 {
+		testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeBlockNumberKey(blockNumber), []byte("hash")),
+			"Error while seeding the index")
+	}
+	cursor := newIndexKeyCursor()
+	defer cursor.close()
+	// ascending, descending, far ahead (beyond the read-ahead) and past the last key
+	for _, blockNumber := range []uint64{0, 1, 2, 4, 3, 18, 0, 6, 16, 17, 25, 8} {
+		testutil.AssertEquals(t, cursor.exists(encodeBlockNumberKey(blockNumber)), blockNumber%2 == 0 && blockNumber < 20)
+	}
+	testutil.AssertEquals(t, cursor.value(encodeBlockNumberKey(10)), []byte("hash"))
+	testutil.AssertNil(t, cursor.value(encodeBlockNumberKey(11)))
+}
+
+func TestIndexes_RepairOrphanedAddressEntriesManyAddresses(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	openchainDB := db.GetDBHandle()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	for blockNumber := uint64(0); blockNumber < 10; blockNumber++ {
+		writeBatch.PutCF(openchainDB.IndexesCF, encodeBlockNumberKey(blockNumber), []byte("hash"))
+	}
+	// the block numbers restart with every address; entries from block 10 onwards are orphaned
+	for _, address := range []string{"address1", "address2", "address3"} {
+		for blockNumber := uint64(0); blockNumber < 15; blockNumber += 3 {
+			writeBatch.PutCF(openchainDB.IndexesCF, encodeAddressBlockNumCompositeKey(address, blockNumber),
+				encodeListTxIndexes([]uint64{0}))
+		}
+	}
+	testDBWrapper.WriteToDB(t, writeBatch)
+
+	repaired, err := repairOrphanedAddressEntries()
+	testutil.AssertNoError(t, err, "Error while repairing orphaned entries")
+	testutil.AssertEquals(t, repaired, uint64(3))
+	for _, address := range []string{"address1", "address2", "address3"} {
+		for blockNumber := uint64(0); blockNumber < 15; blockNumber += 3 {
+			value, _ := openchainDB.GetFromIndexesCF(encodeAddressBlockNumCompositeKey(address, blockNumber))
+			testutil.AssertEquals(t, value != nil, blockNumber < 10)
+		}
+	}
+}
+
+func BenchmarkIndexes_BlockNumberKeysPointReads(b *testing.B) {
+	keys := setupBenchmarkBlockNumberKeys(b)
+	openchainDB := db.GetDBHandle()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if _, err := openchainDB.GetFromIndexesCF(key); err != nil {
+				b.Fatalf("Error while reading the index: %s", err)
+			}
+		}
+	}
+}
+
+func BenchmarkIndexes_BlockNumberKeysCursor(b *testing.B) {
+	keys := setupBenchmarkBlockNumberKeys(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cursor := newIndexKeyCursor()
+		for _, key := range keys {
+			cursor.exists(key)
+		}
+		cursor.close()
+	}
+}
+
+// setupBenchmarkBlockNumberKeys indexes 10000 blockNumber keys and returns the keys in ascending order
+func setupBenchmarkBlockNumberKeys(b *testing.B) [][]byte {
+	testDBWrapper.CleanDB(b)
+	disableLogging()
+	openchainDB := db.GetDBHandle()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	var keys [][]byte
+	for blockNumber := uint64(0); blockNumber < 10000; blockNumber++ {
+		key := encodeBlockNumberKey(blockNumber)
+		writeBatch.PutCF(openchainDB.IndexesCF, key, []byte("hash"))
+		keys = append(keys, key)
+	}
+	testDBWrapper.WriteToDB(b, writeBatch)
+	return keys
+}
@@ -0,0 +1,276 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// decodeIndexKey returns a human-readable form of an index key, such as one read from a raw dump of the
+// indexes column family: the name of the key type (see describeKeyLayout) followed by its decoded parts,
+// e.g. 'addressBlockNum address="address1" blockNumber=3'. Hashes and chaincode ids are shown in hex and the
+// other identifiers are quoted. It returns an error for a key of an unknown type or that does not match the
+// layout of its type
+func decodeIndexKey(key []byte) (string, error) {
+	name, r, err := readIndexKey(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append([]string{name}, r.fields...), " "), nil
+}
+
+// getRawIndexValue returns the bytes stored under the index key of the given type, where key is the key without
+// its namespace and prefix, e.g., for inspecting arbitrary entries from tooling. The value is returned as stored:
+// it is neither decoded nor checked against its checksum (see encodeIndexValue). ErrResourceNotFound is returned
+// if there is no such key
+func getRawIndexValue(prefix byte, key []byte) ([]byte, error) {
+	value, err := getIndexValue(prependKeyPrefix(prefix, key))
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, ErrResourceNotFound
+	}
+	return value, nil
+}
+
+// indexKeyBlockNumber returns the block number that is part of an index key, if the key has one
+func indexKeyBlockNumber(key []byte) (uint64, bool) {
+	_, r, err := readIndexKey(key)
+	if err != nil {
+		return 0, false
+	}
+	return r.blockNumber, r.hasBlockNumber
+}
+
+// readIndexKey decodes the parts of an index key and returns the name of its key type along with the reader
+// holding the decoded parts
+func readIndexKey(key []byte) (string, *indexKeyReader, error) {
+	body, err := indexKeyBody(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if indexKeyNamespace != 0 && key[0] != indexKeyNamespace {
+		return "", nil, fmt.Errorf("Invalid index key [%x]: namespace [%d] instead of [%d]", key, key[0], indexKeyNamespace)
+	}
+	prefix := key[indexKeyHeaderLength()-1]
+	name := ""
+	for _, layout := range describeKeyLayout() {
+		if layout.Prefix == prefix {
+			name = layout.Name
+			break
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("Invalid index key [%x]: unknown prefix [%d]", key, prefix)
+	}
+
+	r := &indexKeyReader{body: body}
+	switch prefix {
+	case prefixBlockHashKey:
+		r.hex("blockHash", r.rest())
+	case prefixTxUUIDKey:
+		if txUUIDPartitionCount() > 1 {
+			r.number("partition", uint64(r.uint8()))
+		}
+		r.quoted("txUUID", r.rest())
+	case prefixTxExecutingAddressesKey:
+		r.quoted("txUUID", r.rest())
+	case prefixAddressBlockNumCompositeKey:
+		r.quoted("address", r.rawBytes())
+		r.number("blockNumber", r.varint())
+	case prefixAddressChaincodeIDCompositeKey:
+		r.quoted("address", r.rawBytes())
+		r.hex("chaincodeID", r.rawBytes())
+	case prefixTxSizeKey:
+		r.number("txSize", r.uint64())
+		r.number("blockNumber", r.varint())
+		r.number("txIndex", r.varint())
+	case prefixTxReferenceCompositeKey:
+		r.quoted("referencedTxUUID", r.rawBytes())
+		r.quoted("txUUID", r.rawBytes())
+	case prefixTxTypeCompositeKey:
+		r.field("txType", protos.Transaction_Type(r.uint32()).String())
+		r.number("blockNumber", r.uint64())
+		r.number("txIndex", r.uint64())
+	case prefixBlockNumberKey, prefixBlockTxCountKey, prefixPreviousBlockHashKey, prefixBlockTotalFeeKey,
+		prefixBlockTimestampKey, prefixBlockAddressIDsKey:
+		r.number("blockNumber", r.uint64())
+	case prefixProposerBlockNumCompositeKey:
+		r.quoted("proposer", r.rawBytes())
+		r.number("blockNumber", r.uint64())
+	case prefixTimestampBlockNumCompositeKey:
+		if b := r.next(8); b != nil {
+			r.field("timestampSeconds", fmt.Sprintf("%d", decodeTimestampSeconds(b)))
+		}
+		r.number("blockNumber", r.uint64())
+	case prefixTxCountBlockNumCompositeKey:
+		r.number("cumulativeTxCount", r.uint64())
+		r.number("blockNumber", r.uint64())
+	case prefixTxMetadataCompositeKey:
+		r.quoted("key", r.rawBytes())
+		r.quoted("value", r.rawBytes())
+		r.number("blockNumber", r.varint())
+		r.number("txIndex", r.varint())
+	case prefixAddressDigestKey:
+		r.quoted("addressDigest", r.rest())
+	case prefixBlockNumAddressCompositeKey:
+		r.number("blockNumber", r.uint64())
+		r.quoted("address", r.rawBytes())
+	case prefixChaincodeHistoryCompositeKey:
+		r.quoted("chaincodePath", r.rawBytes())
+		r.number("blockNumber", r.uint64())
+		r.number("txIndex", r.uint64())
+	case prefixAddressLatestBlockKey, prefixAddressInternIDKey:
+		r.quoted("address", r.rest())
+	case prefixAddressBlockFeeCompositeKey:
+		r.quoted("address", r.rawBytes())
+		r.number("blockNumber", r.uint64())
+	case prefixInternIDAddressKey:
+		r.number("id", r.uint64())
+	case prefixIndexTombstoneKey:
+		deletedKey := r.rest()
+		if decoded, err := decodeIndexKey(deletedKey); err == nil {
+			r.field("deletedKey", "("+decoded+")")
+		} else {
+			r.hex("deletedKey", deletedKey)
+		}
+	case prefixChaincodeTxCompositeKey:
+		r.quoted("chaincodeName", r.rawBytes())
+		r.number("blockNumber", r.uint64())
+		r.number("txIndex", r.uint64())
+	case prefixAddressTxIndexesContinuationKey:
+		r.quoted("address", r.rawBytes())
+		r.number("blockNumber", r.varint())
+		r.number("sequence", r.uint64())
+	case prefixTxTagCompositeKey:
+		r.quoted("tag", r.rawBytes())
+		r.number("blockNumber", r.uint64())
+		r.number("txIndex", r.uint64())
+	case prefixTxSignatureHashCompositeKey:
+		r.hex("signatureHash", r.rawBytes())
+		r.number("blockNumber", r.uint64())
+		r.number("txIndex", r.uint64())
+	}
+	if r.err == nil && r.offset != len(r.body) {
+		r.err = fmt.Errorf("[%d] unexpected trailing bytes", len(r.body)-r.offset)
+	}
+	if r.err != nil {
+		return "", nil, fmt.Errorf("Invalid %s key [%x]: %s", name, key, r.err)
+	}
+	return name, r, nil
+}
+
+// indexKeyReader reads the parts of an index key body in order. After the first error the reads return zero
+// values, so that a key can be decoded without checking every read.
+// The first part named blockNumber is also kept as a number
+type indexKeyReader struct {
+	body           []byte
+	offset         int
+	fields         []string
+	blockNumber    uint64
+	hasBlockNumber bool
+	err            error
+}
+
+func (r *indexKeyReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.body)-r.offset < n {
+		r.err = fmt.Errorf("expected [%d] bytes at offset [%d]", n, r.offset)
+		return nil
+	}
+	b := r.body[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *indexKeyReader) rest() []byte {
+	return r.next(len(r.body) - r.offset)
+}
+
+func (r *indexKeyReader) varint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := proto.DecodeVarint(r.body[r.offset:])
+	if n == 0 {
+		r.err = fmt.Errorf("invalid varint at offset [%d]", r.offset)
+		return 0
+	}
+	r.offset += n
+	return x
+}
+
+// rawBytes reads a varint length followed by that many bytes
+func (r *indexKeyReader) rawBytes() []byte {
+	n := r.varint()
+	if n > uint64(len(r.body)) {
+		r.err = fmt.Errorf("length [%d] at offset [%d] exceeds the key", n, r.offset)
+	}
+	return r.next(int(n))
+}
+
+func (r *indexKeyReader) uint8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *indexKeyReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return decodeIndexUint64(b)
+}
+
+func (r *indexKeyReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return indexByteOrder.Uint32(b)
+}
+
+func (r *indexKeyReader) field(name string, value string) {
+	if r.err == nil {
+		r.fields = append(r.fields, name+"="+value)
+	}
+}
+
+func (r *indexKeyReader) number(name string, value uint64) {
+	if r.err == nil && name == "blockNumber" && !r.hasBlockNumber {
+		r.blockNumber, r.hasBlockNumber = value, true
+	}
+	r.field(name, fmt.Sprintf("%d", value))
+}
+
+func (r *indexKeyReader) quoted(name string, value []byte) {
+	r.field(name, fmt.Sprintf("%q", value))
+}
+
+func (r *indexKeyReader) hex(name string, value []byte) {
+	r.field(name, fmt.Sprintf("%x", value))
+}
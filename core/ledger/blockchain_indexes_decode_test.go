@@ -0,0 +1,135 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_DecodeIndexKey(t *testing.T) {
+	addressBlockNumKey := encodeAddressBlockNumCompositeKey("address1", 3)
+	keys := []struct {
+		key      []byte
+		readable string
+	}{
+		{encodeLastIndexedBlockKey(), "lastIndexedBlock"},
+		{encodeBlockHashKey([]byte{0xab, 0xcd}), "blockHash blockHash=abcd"},
+		{encodeTxUUIDKey("uuid1"), `txUUID txUUID="uuid1"`},
+		{addressBlockNumKey, `addressBlockNum address="address1" blockNumber=3`},
+		{encodeAddressChaincodeIDCompositeKey("address1", []byte{0x0a, 0x01}),
+			`addressChaincodeID address="address1" chaincodeID=0a01`},
+		{encodeTxSizeKey(100, 3, 1), "txSize txSize=100 blockNumber=3 txIndex=1"},
+		{encodeTxReferenceCompositeKey("uuid1", "uuid2"), `txReference referencedTxUUID="uuid1" txUUID="uuid2"`},
+		{encodePruneCursorKey(), "pruneCursor"},
+		{encodeTxTypeCompositeKey(protos.Transaction_CHAINCODE_INVOKE, 3, 1),
+			"txType txType=CHAINCODE_INVOKE blockNumber=3 txIndex=1"},
+		{encodeBlockNumberKey(3), "blockNumber blockNumber=3"},
+		{encodeProposerBlockNumCompositeKey("proposer1", 3), `proposerBlockNum proposer="proposer1" blockNumber=3`},
+		{encodeTxExecutingAddressesKey("uuid1"), `txExecutingAddresses txUUID="uuid1"`},
+		{encodeTxCountBlockNumCompositeKey(10, 3), "txCountBlockNum cumulativeTxCount=10 blockNumber=3"},
+		{encodeTxMetadataCompositeKey("k", "v", 3, 1), `txMetadata key="k" value="v" blockNumber=3 txIndex=1`},
+		{encodeAddressDigestKey("digest1"), `addressDigest addressDigest="digest1"`},
+		{encodeBlockTxCountKey(3), "blockTxCount blockNumber=3"},
+		{encodeBlockNumAddressCompositeKey(3, "address1"), `blockNumAddress blockNumber=3 address="address1"`},
+		{encodeChaincodeHistoryCompositeKey("path1", 3, 1), `chaincodeHistory chaincodePath="path1" blockNumber=3 txIndex=1`},
+		{encodeAddressLatestBlockKey("address1"), `addressLatestBlock address="address1"`},
+		{encodeIndexTombstoneKey(encodeTxUUIDKey("uuid1")), `indexTombstone deletedKey=(txUUID txUUID="uuid1")`},
+		{encodeChaincodeTxCompositeKey("cc1", 3, 1), `chaincodeTx chaincodeName="cc1" blockNumber=3 txIndex=1`},
+		{encodeIndexSchemaVersionKey(), "indexSchemaVersion"},
+		{encodePreviousBlockHashKey(3), "previousBlockHash blockNumber=3"},
+		{encodeAddressTxIndexesContinuationKey(addressBlockNumKey, 2),
+			`addressTxIndexesContinuation address="address1" blockNumber=3 sequence=2`},
+		{encodeTxTagCompositeKey("tag1", 3, 1), `txTag tag="tag1" blockNumber=3 txIndex=1`},
+		{encodeActiveAddressCFKey(), "activeAddressCF"},
+		{encodeTxSignatureHashCompositeKey([]byte{0xab, 0xcd}, 3, 1), "txSignatureHash signatureHash=abcd blockNumber=3 txIndex=1"},
+		{encodeBlockTotalFeeKey(3), "blockTotalFee blockNumber=3"},
+		{encodeAddressBlockFeeCompositeKey("address1", 3), `addressBlockFee address="address1" blockNumber=3`},
+		{encodeIndexVerifyCursorKey(), "indexVerifyCursor"},
+		{encodeBlockTimestampKey(3), "blockTimestamp blockNumber=3"},
+		{encodeTimestampBlockNumCompositeKey(-5, 3), "timestampBlockNum timestampSeconds=-5 blockNumber=3"},
+		{encodeAddressInternIDKey("address1"), `addressInternID address="address1"`},
+		{encodeInternIDAddressKey(7), "internIDAddress id=7"},
+		{encodeBlockAddressIDsKey(3), "blockAddressIDs blockNumber=3"},
+		{encodeIndexExpiryThresholdKey(), "indexExpiryThreshold"},
+	}
+	testutil.AssertEquals(t, len(keys), len(describeKeyLayout()))
+	for _, k := range keys {
+		readable, err := decodeIndexKey(k.key)
+		testutil.AssertNoError(t, err, "Error while decoding an index key")
+		testutil.AssertEquals(t, readable, k.readable)
+	}
+
+	// keys that do not match their layout
+	for _, key := range [][]byte{
+		{},
+		{200},
+		append(encodeBlockNumberKey(3), 0),
+		encodeBlockNumberKey(3)[:5],
+		append(encodeLastIndexedBlockKey(), 1),
+		prependKeyPrefix(prefixAddressBlockNumCompositeKey, []byte{10, 'a'}),
+	} {
+		_, err := decodeIndexKey(key)
+		testutil.AssertError(t, err, "Expected an error decoding an invalid index key")
+	}
+
+	// the namespace is skipped
+	defaultNamespace := indexKeyNamespace
+	indexKeyNamespace = 0x80
+	defer func() { indexKeyNamespace = defaultNamespace }()
+	readable, err := decodeIndexKey(encodeTxUUIDKey("uuid1"))
+	testutil.AssertNoError(t, err, "Error while decoding a namespaced index key")
+	testutil.AssertEquals(t, readable, `txUUID txUUID="uuid1"`)
+	_, err = decodeIndexKey([]byte{0x81, prefixTxUUIDKey})
+	testutil.AssertError(t, err, "Expected an error decoding a key of another namespace")
+}
+
+func TestIndexes_GetRawIndexValue(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultChecksums := indexValueChecksums
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexValueChecksums = defaultChecksums
+	}()
+
+	for _, checksums := range []bool{false, true} {
+		indexValueChecksums = checksums
+		testDBWrapper.CleanDB(t)
+		testBlockchainWrapper := newTestBlockchainWrapper(t)
+		for i := 0; i < 2; i++ {
+			tx, _ := buildTestTx(t)
+			testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+		}
+		block, err := testBlockchainWrapper.blockchain.getBlock(1)
+		testutil.AssertNoError(t, err, "Error while fetching a block")
+		blockHash, err := computeBlockHash(block)
+		testutil.AssertNoError(t, err, "Error while computing the block hash")
+
+		// the value is returned as stored, in the checksummed format if enabled
+		value, err := getRawIndexValue(prefixBlockHashKey, blockHash)
+		testutil.AssertNoError(t, err, "Error while fetching the raw value of the block hash key")
+		testutil.AssertEquals(t, value, encodeIndexValue(encodeBlockNumber(1)))
+
+		_, err = getRawIndexValue(prefixBlockHashKey, []byte("unknown"))
+		testutil.AssertEquals(t, err, ErrResourceNotFound)
+		testBlockchainWrapper.blockchain.indexer.stop()
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// indexEventBufferSize is the number of index events buffered for each subscriber.
+// An event is dropped for a subscriber whose buffer is full, so that a slow subscriber does not hold up the indexer
+var indexEventBufferSize = 16
+
+// IndexEvent is sent to the subscribers after the index entries of a block are committed
+type IndexEvent struct {
+	BlockNumber uint64
+	BlockHash   []byte
+}
+
+// indexEventBroadcaster delivers index events to the subscribers without blocking
+type indexEventBroadcaster struct {
+	lock        sync.RWMutex
+	subscribers map[<-chan IndexEvent]chan IndexEvent
+	dropped     uint64
+}
+
+var indexEvents = &indexEventBroadcaster{subscribers: make(map[<-chan IndexEvent]chan IndexEvent)}
+
+// SubscribeIndexEvents returns a channel on which an IndexEvent is received for every block indexed from now on.
+// Events are dropped if the channel is not drained (see indexEventBufferSize)
+func (ledger *Ledger) SubscribeIndexEvents() <-chan IndexEvent {
+	return indexEvents.subscribe()
+}
+
+// UnsubscribeIndexEvents stops the delivery of index events on a channel returned by SubscribeIndexEvents and closes it
+func (ledger *Ledger) UnsubscribeIndexEvents(events <-chan IndexEvent) {
+	indexEvents.unsubscribe(events)
+}
+
+func (broadcaster *indexEventBroadcaster) subscribe() <-chan IndexEvent {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+	events := make(chan IndexEvent, indexEventBufferSize)
+	broadcaster.subscribers[events] = events
+	return events
+}
+
+func (broadcaster *indexEventBroadcaster) unsubscribe(events <-chan IndexEvent) {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+	if subscriber, ok := broadcaster.subscribers[events]; ok {
+		delete(broadcaster.subscribers, events)
+		close(subscriber)
+	}
+}
+
+// publish sends the event to every subscriber whose buffer is not full
+func (broadcaster *indexEventBroadcaster) publish(blockNumber uint64, blockHash []byte) {
+	broadcaster.lock.RLock()
+	defer broadcaster.lock.RUnlock()
+	for _, subscriber := range broadcaster.subscribers {
+		select {
+		case subscriber <- IndexEvent{blockNumber, blockHash}:
+		default:
+			atomic.AddUint64(&broadcaster.dropped, 1)
+			indexLogger.Debugf("Dropped the index event of block number [%d] for a subscriber that is not keeping up", blockNumber)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func receiveIndexEvent(t *testing.T, events <-chan IndexEvent) IndexEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an index event")
+	}
+	return IndexEvent{}
+}
+
+func TestIndexes_SubscribeIndexEvents(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	for _, synchronous := range []bool{true, false} {
+		indexBlockDataSynchronously = synchronous
+		testDBWrapper.CleanDB(t)
+		testBlockchainWrapper := newTestBlockchainWrapper(t)
+		events1 := indexEvents.subscribe()
+		events2 := indexEvents.subscribe()
+
+		tx, _ := buildTestTx(t)
+		block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+		blockNumber := testBlockchainWrapper.addNewBlock(block, []byte("stateHash1"))
+		blockHash, _ := testBlockchainWrapper.getBlock(blockNumber).GetHash()
+		for _, events := range []<-chan IndexEvent{events1, events2} {
+			event := receiveIndexEvent(t, events)
+			testutil.AssertEquals(t, event.BlockNumber, blockNumber)
+			testutil.AssertEquals(t, event.BlockHash, blockHash)
+		}
+
+		indexEvents.unsubscribe(events1)
+		indexEvents.unsubscribe(events2)
+		_, open := <-events1
+		testutil.AssertEquals(t, open, false)
+		testBlockchainWrapper.blockchain.indexer.stop()
+	}
+}
+
+func TestIndexes_IndexEventsDroppedForSlowSubscriber(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultBufferSize := indexEventBufferSize
+	indexBlockDataSynchronously = true
+	indexEventBufferSize = 1
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexEventBufferSize = defaultBufferSize
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	events := indexEvents.subscribe()
+	defer indexEvents.unsubscribe(events)
+	droppedBefore := indexEvents.dropped
+
+	// the subscriber does not drain its channel while the blocks are indexed
+	for i := 0; i < 3; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	testutil.AssertEquals(t, receiveIndexEvent(t, events).BlockNumber, uint64(0))
+	testutil.AssertEquals(t, indexEvents.dropped-droppedBefore, uint64(2))
+	testutil.AssertEquals(t, testBlockchainWrapper.blockchain.getSize(), uint64(3))
+}
@@ -0,0 +1,174 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sync/atomic"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexExpiryEnabled installs the compaction filter that drops the entries below the expiry threshold
+// (see setIndexExpiryThreshold). The filter is part of the options of the index column families, so the setting
+// is read when the db is opened. It is implied by a non-zero indexExpiryRetainBlocks
+var indexExpiryEnabled = false
+
+// indexExpiryRetainBlocks, when non-zero, moves the expiry threshold (see setIndexExpiryThreshold) forward as
+// blocks are indexed, so that the compactions only keep the entries of the last indexExpiryRetainBlocks blocks.
+// This is meant for the chains where only the recent history is queried, as an alternative to pruneIndexes
+// that needs no delete scans
+var indexExpiryRetainBlocks = uint64(0)
+
+// indexExpiryThreshold is the block number below which the entries of the index column families are dropped
+// by the compactions. Zero disables the expiry. It is persisted in the indexes column family and loaded when
+// the indexer is started. It is read atomically, as the compaction filter is called from the rocksdb compaction threads
+var indexExpiryThreshold uint64
+
+func init() {
+	db.SetIndexesCompactionFilter(indexExpiryFilter)
+}
+
+// indexExpiryFilter returns the compaction filter of the index column families if the expiry is configured
+func indexExpiryFilter() gorocksdb.CompactionFilter {
+	if !indexExpiryEnabled && indexExpiryRetainBlocks == 0 {
+		return nil
+	}
+	return indexExpiryCompactionFilter{}
+}
+
+// setIndexExpiryThreshold sets the block number below which the entries are dropped by the compactions.
+// The entries are dropped lazily, as the compactions reach them (see compactIndexes to force it), and only if the
+// expiry is enabled (see indexExpiryEnabled) when the db is opened.
+// Unlike pruneIndexes, the expiry is not recorded by the prune cursor, and the entries that do not refer to a
+// block number (e.g., the executing addresses of a transaction and the address digests)
+// are kept. The threshold should not be above the highest indexed block, whose entries are needed to index
+// the next block
+func setIndexExpiryThreshold(blockNumber uint64) error {
+	openchainDB := db.GetDBHandle()
+	if err := openchainDB.Put(openchainDB.IndexesCF, encodeIndexExpiryThresholdKey(), encodeBlockNumber(blockNumber)); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&indexExpiryThreshold, blockNumber)
+	return nil
+}
+
+// indexExpiryThresholdFor returns the expiry threshold that retains indexExpiryRetainBlocks blocks up to the given
+// indexed block, and whether it is ahead of the current threshold. The threshold never moves backwards
+func indexExpiryThresholdFor(blockNumber uint64) (uint64, bool) {
+	if indexExpiryRetainBlocks == 0 || blockNumber+1 <= indexExpiryRetainBlocks {
+		return 0, false
+	}
+	threshold := blockNumber + 1 - indexExpiryRetainBlocks
+	return threshold, threshold > atomic.LoadUint64(&indexExpiryThreshold)
+}
+
+// advanceIndexExpiryThreshold adds to the writeBatch the expiry threshold for the given indexed block, if it moves
+// the threshold forward. The threshold used by the compaction filter is only moved once the batch is committed
+// (see indexExpiryCommitted), so that no entry is dropped against a threshold that is not persisted
+func advanceIndexExpiryThreshold(blockNumber uint64, writeBatch *gorocksdb.WriteBatch) {
+	if threshold, ok := indexExpiryThresholdFor(blockNumber); ok {
+		writeBatch.PutCF(db.GetDBHandle().IndexesCF, encodeIndexExpiryThresholdKey(), encodeBlockNumber(threshold))
+	}
+}
+
+// indexExpiryCommitted is called once the batch carrying the index entries of the given block has been committed,
+// and moves the expiry threshold forward to the one added to the batch by advanceIndexExpiryThreshold
+func indexExpiryCommitted(blockNumber uint64) {
+	threshold, ok := indexExpiryThresholdFor(blockNumber)
+	if !ok {
+		return
+	}
+	for {
+		current := atomic.LoadUint64(&indexExpiryThreshold)
+		if current >= threshold || atomic.CompareAndSwapUint64(&indexExpiryThreshold, current, threshold) {
+			return
+		}
+	}
+}
+
+// loadIndexExpiryThreshold sets the expiry threshold to the one persisted in the indexes column family, if any, else to zero
+func loadIndexExpiryThreshold() error {
+	thresholdBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeIndexExpiryThresholdKey())
+	if err != nil {
+		return err
+	}
+	threshold := uint64(0)
+	if thresholdBytes != nil {
+		if threshold, err = decodeBlockNumber(thresholdBytes); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&indexExpiryThreshold, threshold)
+	return nil
+}
+
+func encodeIndexExpiryThresholdKey() []byte {
+	return newIndexKey(prefixIndexExpiryThresholdKey)
+}
+
+// compactIndexes compacts the index column families, which drops the entries below the expiry threshold
+func compactIndexes() {
+	indexMaintenanceLock.Lock()
+	defer indexMaintenanceLock.Unlock()
+	indexLogger.Debug("Compacting the index column families")
+	openchainDB := db.GetDBHandle()
+	for _, cf := range indexColumnFamilies() {
+		openchainDB.DB.CompactRangeCF(cf, gorocksdb.Range{})
+	}
+}
+
+// indexExpiryCompactionFilter drops the index entries whose block number is below indexExpiryThreshold
+type indexExpiryCompactionFilter struct{}
+
+func (indexExpiryCompactionFilter) Filter(level int, key, val []byte) (bool, []byte) {
+	threshold := atomic.LoadUint64(&indexExpiryThreshold)
+	if threshold == 0 {
+		return false, nil
+	}
+	blockNumber, found := indexEntryBlockNumber(key, val)
+	return found && blockNumber < threshold, nil
+}
+
+func (indexExpiryCompactionFilter) Name() string {
+	return "indexExpiry"
+}
+
+// indexEntryBlockNumber returns the block number of an index entry: the block number in the value for the
+// blockHash and txUUID entries, else the block number that is part of the key, if any
+func indexEntryBlockNumber(key []byte, value []byte) (uint64, bool) {
+	if len(key) < indexKeyHeaderLength() || (indexKeyNamespace != 0 && key[0] != indexKeyNamespace) {
+		return 0, false
+	}
+	switch key[indexKeyHeaderLength()-1] {
+	case prefixBlockHashKey:
+		value, err := decodeIndexValue(value)
+		if err != nil {
+			return 0, false
+		}
+		blockNumber, err := decodeBlockNumber(value)
+		return blockNumber, err == nil
+	case prefixTxUUIDKey:
+		value, err := decodeIndexValue(value)
+		if err != nil {
+			return 0, false
+		}
+		blockNumber, _, err := decodeBlockNumTxIndex(value)
+		return blockNumber, err == nil
+	}
+	return indexKeyBlockNumber(key)
+}
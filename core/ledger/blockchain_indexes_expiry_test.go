@@ -0,0 +1,212 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+)
+
+func TestIndexes_IndexEntryBlockNumber(t *testing.T) {
+	entries := []struct {
+		key            []byte
+		value          []byte
+		blockNumber    uint64
+		hasBlockNumber bool
+	}{
+		{encodeBlockHashKey([]byte("hash")), encodeBlockNumber(3), 3, true},
+		{encodeTxUUIDKey("uuid1"), encodeBlockNumTxIndex(3, 1), 3, true},
+		{encodeBlockNumberKey(3), []byte("hash"), 3, true},
+		{encodeAddressBlockNumCompositeKey("address1", 3), nil, 3, true},
+		{encodeTxSizeKey(100, 3, 1), nil, 3, true},
+		{encodeTimestampBlockNumCompositeKey(-5, 3), nil, 3, true},
+		{encodeTxExecutingAddressesKey("uuid1"), nil, 0, false},
+		{encodeAddressDigestKey("digest"), []byte("address1"), 0, false},
+		{encodeInternIDAddressKey(3), []byte("address1"), 0, false},
+		{[]byte{}, nil, 0, false},
+	}
+	for _, entry := range entries {
+		blockNumber, hasBlockNumber := indexEntryBlockNumber(entry.key, entry.value)
+		testutil.AssertEquals(t, hasBlockNumber, entry.hasBlockNumber)
+		testutil.AssertEquals(t, blockNumber, entry.blockNumber)
+	}
+}
+
+func TestIndexes_ExpiryCompactionFilter(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultExpiryEnabled := indexExpiryEnabled
+	indexBlockDataSynchronously = true
+	indexExpiryEnabled = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexExpiryEnabled = defaultExpiryEnabled
+		setIndexExpiryThreshold(0)
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var uuids []string
+	for i := 0; i < 4; i++ {
+		tx, uuid := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+		uuids = append(uuids, uuid)
+	}
+
+	// nothing is dropped until the threshold is set
+	compactIndexes()
+	minBlock, _, err := indexedBlockRange()
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block range")
+	testutil.AssertEquals(t, minBlock, uint64(0))
+
+	testutil.AssertNoError(t, setIndexExpiryThreshold(2), "Error while setting the expiry threshold")
+	compactIndexes()
+	minBlock, maxBlock, err := indexedBlockRange()
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block range")
+	testutil.AssertEquals(t, minBlock, uint64(2))
+	testutil.AssertEquals(t, maxBlock, uint64(3))
+	for blockNumber, uuid := range uuids {
+		txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid)
+		if blockNumber < 2 {
+			testutil.AssertEquals(t, err, ErrResourceNotFound)
+		} else {
+			testutil.AssertNoError(t, err, "Error while fetching the location of a recent transaction")
+			testutil.AssertEquals(t, txLocation.BlockNumber, uint64(blockNumber))
+		}
+	}
+	// the entries without a block number are kept
+	_, err = fetchExecutingAddresses(uuids[0])
+	testutil.AssertNoError(t, err, "Error while fetching the executing addresses of an expired transaction")
+
+	// the expired blocks are not reported as missing from the index
+	unindexed, _, err := testBlockchainWrapper.blockchain.findUnindexedBlocks(testScanLimits)
+	testutil.AssertNoError(t, err, "Error while finding unindexed blocks")
+	testutil.AssertEquals(t, len(unindexed), 0)
+
+	// the threshold is persisted, so neither are they once the ledger is restarted
+	testBlockchainWrapper.blockchain.indexer.stop()
+	testDBWrapper.CloseDB(t)
+	atomic.StoreUint64(&indexExpiryThreshold, 0)
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	testutil.AssertEquals(t, atomic.LoadUint64(&indexExpiryThreshold), uint64(2))
+	unindexed, _, err = testBlockchainWrapper.blockchain.findUnindexedBlocks(testScanLimits)
+	testutil.AssertNoError(t, err, "Error while finding unindexed blocks after a restart")
+	testutil.AssertEquals(t, len(unindexed), 0)
+}
+
+func TestIndexes_ExpiryNotConfigured(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		setIndexExpiryThreshold(0)
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 3; i++ {
+		block, _ := buildTestBlock(t)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	// without the expiry configured when the db was opened, the compactions do not filter the entries
+	testutil.AssertNoError(t, setIndexExpiryThreshold(2), "Error while setting the expiry threshold")
+	compactIndexes()
+	minBlock, _, err := indexedBlockRange()
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block range")
+	testutil.AssertEquals(t, minBlock, uint64(0))
+}
+
+func TestIndexes_ExpiryAddressCF(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultSplit := indexSplitAddressCF
+	defaultExpiryEnabled := indexExpiryEnabled
+	indexBlockDataSynchronously = true
+	indexSplitAddressCF = true
+	indexExpiryEnabled = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexSplitAddressCF = defaultSplit
+		indexExpiryEnabled = defaultExpiryEnabled
+		setIndexExpiryThreshold(0)
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 4; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	testutil.AssertNoError(t, setIndexExpiryThreshold(2), "Error while setting the expiry threshold")
+	compactIndexes()
+	txs, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{2, 0}, {3, 0}})
+}
+
+func TestIndexes_ExpiryRetainBlocks(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultRetainBlocks := indexExpiryRetainBlocks
+	indexBlockDataSynchronously = true
+	indexExpiryRetainBlocks = 3
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexExpiryRetainBlocks = defaultRetainBlocks
+		setIndexExpiryThreshold(0)
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 5; i++ {
+		block, _ := buildTestBlock(t)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	testutil.AssertEquals(t, indexExpiryThreshold, uint64(2))
+	thresholdBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeIndexExpiryThresholdKey())
+	testutil.AssertNoError(t, err, "Error while reading the persisted expiry threshold")
+	testutil.AssertEquals(t, thresholdBytes, encodeBlockNumber(2))
+
+	// the threshold does not move backwards
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	advanceIndexExpiryThreshold(3, writeBatch)
+	testutil.AssertEquals(t, writeBatch.Count(), 0)
+	indexExpiryCommitted(3)
+	testutil.AssertEquals(t, indexExpiryThreshold, uint64(2))
+
+	compactIndexes()
+	minBlock, maxBlock, err := indexedBlockRange()
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block range")
+	testutil.AssertEquals(t, minBlock, uint64(2))
+	testutil.AssertEquals(t, maxBlock, uint64(4))
+	// a threshold added to a batch is used only once the batch is committed
+	advanceIndexExpiryThreshold(5, writeBatch)
+	testutil.AssertEquals(t, writeBatch.Count(), 1)
+	testutil.AssertEquals(t, indexExpiryThreshold, uint64(2))
+	indexExpiryCommitted(5)
+	testutil.AssertEquals(t, indexExpiryThreshold, uint64(3))
+}
@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexSchemaVersion is the version of the index key/value layout. Version 2 adds the codec-encoded list values,
+// the address continuation entries, the interned address ids and the partitioned txUUID keys
+const indexSchemaVersion = uint64(2)
+
+var indexExportMagic = []byte("fabric-index")
+
+// indexMaxFrameLength is the largest frame length accepted by readFrame, so that a corrupted or hostile
+// length does not make it allocate an arbitrary amount of memory
+const indexMaxFrameLength = 64 << 20
+
+// number of entries written per WriteBatch during import
+var indexImportBatchSize = 1000
+
+// exportIndexes writes all the key-values of the indexes column family to the writer.
+// The stream starts with a header (magic bytes followed by the schema version)
+// and is followed by one frame per entry: length-prefixed key followed by length-prefixed value.
+// All the lengths (and the version) are encoded as unsigned varints
+func exportIndexes(w io.Writer) error {
+	bufWriter := bufio.NewWriter(w)
+	if _, err := bufWriter.Write(indexExportMagic); err != nil {
+		return err
+	}
+	if err := writeUvarint(bufWriter, indexSchemaVersion); err != nil {
+		return err
+	}
+
+	// the entries of all the index column families go in the same stream, as importIndexes routes each key
+	// to its column family. They are read from one snapshot, so that the export is consistent across them
+	openchainDB := db.GetDBHandle()
+	snapshot := openchainDB.GetSnapshot()
+	defer snapshot.Release()
+	numEntries := 0
+	for _, cf := range indexColumnFamilies() {
+		n, err := writeIndexFrames(bufWriter, snapshot, cf)
+		if err != nil {
+			return err
+		}
+		numEntries += n
+	}
+	indexLogger.Debugf("Exported [%d] index entries", numEntries)
+	return bufWriter.Flush()
+}
+
+// writeIndexFrames writes a frame pair for each entry of the given column family in the snapshot
+// and returns the number of entries
+func writeIndexFrames(w io.Writer, snapshot *gorocksdb.Snapshot, cf *gorocksdb.ColumnFamilyHandle) (int, error) {
+	itr := db.GetDBHandle().GetSnapshotIterator(snapshot, cf)
+	defer itr.Close()
+	numEntries := 0
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		if err := writeFrame(w, itr.Key().Data()); err != nil {
+			return numEntries, err
+		}
+		if err := writeFrame(w, itr.Value().Data()); err != nil {
+			return numEntries, err
+		}
+		numEntries++
+	}
+	return numEntries, itr.Err()
+}
+
+// importIndexes reads a stream produced by exportIndexes and writes the entries to the indexes column family
+func importIndexes(r io.Reader) error {
+	bufReader := bufio.NewReader(r)
+	magic := make([]byte, len(indexExportMagic))
+	if _, err := io.ReadFull(bufReader, magic); err != nil || !bytes.Equal(magic, indexExportMagic) {
+		return fmt.Errorf("Input is not an index export")
+	}
+	version, err := binary.ReadUvarint(bufReader)
+	if err != nil {
+		return err
+	}
+	if version != indexSchemaVersion {
+		return &ErrIndexSchemaMismatch{version, indexSchemaVersion}
+	}
+
+	indexMaintenanceLock.Lock()
+	defer indexMaintenanceLock.Unlock()
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer func() { writeBatch.Destroy() }()
+	numEntries := 0
+	for {
+		key, err := readFrame(bufReader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		value, err := readFrame(bufReader)
+		if err != nil {
+			return fmt.Errorf("Truncated index export. Error reading value: %s", err)
+		}
+		writeBatch.PutCF(indexCFForKey(key), key, value)
+		numEntries++
+		if numEntries%indexImportBatchSize == 0 {
+			if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+				return err
+			}
+			writeBatch.Destroy()
+			writeBatch = gorocksdb.NewWriteBatch()
+		}
+	}
+	if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+		return err
+	}
+	indexLogger.Debugf("Imported [%d] index entries", numEntries)
+	return nil
+}
+
+func writeUvarint(w io.Writer, x uint64) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	if err := writeUvarint(w, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > indexMaxFrameLength {
+		return nil, fmt.Errorf("Frame length [%d] exceeds the maximum of [%d]", length, indexMaxFrameLength)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestIndexes_ExportImport(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultBatchSize := indexImportBatchSize
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexImportBatchSize = defaultBatchSize
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	blocks, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+	if err != nil {
+		t.Fatalf("Error populating block chain with sample data: %s", err)
+	}
+	testBlockchainWrapper.blockchain.indexer.stop()
+
+	var buffer bytes.Buffer
+	err = exportIndexes(&buffer)
+	testutil.AssertNoError(t, err, "Error while exporting indexes")
+	exported := buffer.Bytes()
+
+	// import into a fresh db and verify the lookups
+	testDBWrapper.CleanDB(t)
+	indexImportBatchSize = 2
+	err = importIndexes(bytes.NewReader(exported))
+	testutil.AssertNoError(t, err, "Error while importing indexes")
+	for i, block := range blocks {
+		blockHash, _ := block.GetHash()
+		blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+		testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+		testutil.AssertEquals(t, blockNumber, uint64(i))
+		for j, tx := range block.GetTransactions() {
+			blockNumber, txIndex, err := fetchTransactionIndexByUUIDFromDB(tx.Uuid)
+			testutil.AssertNoError(t, err, "Error while fetching transaction index")
+			testutil.AssertEquals(t, blockNumber, uint64(i))
+			testutil.AssertEquals(t, txIndex, uint64(j))
+		}
+	}
+
+	// a re-export of the imported indexes is byte-identical
+	buffer.Reset()
+	err = exportIndexes(&buffer)
+	testutil.AssertNoError(t, err, "Error while exporting indexes")
+	testutil.AssertEquals(t, buffer.Bytes(), exported)
+}
+
+func TestIndexes_ImportInvalidHeader(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	err := importIndexes(bytes.NewReader([]byte("not an export")))
+	testutil.AssertError(t, err, "Error expected for input without the export header")
+
+	var buffer bytes.Buffer
+	buffer.Write(indexExportMagic)
+	writeUvarint(&buffer, indexSchemaVersion+1)
+	err = importIndexes(&buffer)
+	testutil.AssertError(t, err, "Error expected for unsupported schema version")
+
+	buffer.Reset()
+	buffer.Write(indexExportMagic)
+	writeUvarint(&buffer, indexSchemaVersion)
+	writeFrame(&buffer, []byte("key"))
+	err = importIndexes(&buffer)
+	testutil.AssertError(t, err, "Error expected for truncated export")
+}
+
+func TestIndexes_ImportOversizedFrame(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	var buffer bytes.Buffer
+	buffer.Write(indexExportMagic)
+	writeUvarint(&buffer, indexSchemaVersion)
+	// a frame length far beyond the maximum, with no data behind it
+	writeUvarint(&buffer, 1<<62)
+	err := importIndexes(&buffer)
+	testutil.AssertError(t, err, "Error expected for a frame length above the maximum")
+}
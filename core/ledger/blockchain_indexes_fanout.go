@@ -0,0 +1,134 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/protos"
+)
+
+// indexQueryConcurrency is the number of blocks that the queries touching many blocks (e.g.,
+// fetchTransactionsByAddress) load in parallel. Loading blocks in parallel speeds up such queries on
+// storage with a high read latency. A value below 2 loads the blocks one at a time
+var indexQueryConcurrency = 1
+
+// fetchBlocksConcurrently loads the given blocks with up to indexQueryConcurrency loads in parallel and returns
+// them in the order of blockNumbers. It returns an error if any of the blocks is not found, as the block
+// numbers are expected to come from the index
+func fetchBlocksConcurrently(blockNumbers []uint64) ([]*protos.Block, error) {
+	blocks := make([]*protos.Block, len(blockNumbers))
+	workers := indexQueryConcurrency
+	if workers > len(blockNumbers) {
+		workers = len(blockNumbers)
+	}
+	if workers < 2 {
+		for i, blockNumber := range blockNumbers {
+			block, err := fetchIndexedBlock(blockNumber)
+			if err != nil {
+				return nil, err
+			}
+			blocks[i] = block
+		}
+		return blocks, nil
+	}
+
+	// the workers take the positions of the blocks to load from positions, and stop taking more after an error
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+	positions := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range positions {
+				block, err := fetchIndexedBlock(blockNumbers[i])
+				if err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+					continue
+				}
+				blocks[i] = block
+			}
+		}()
+	}
+	for i := range blockNumbers {
+		errLock.Lock()
+		failed := firstErr != nil
+		errLock.Unlock()
+		if failed {
+			break
+		}
+		positions <- i
+	}
+	close(positions)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return blocks, nil
+}
+
+// fetchIndexedBlock loads a block that is referred by the index
+func fetchIndexedBlock(blockNumber uint64) (*protos.Block, error) {
+	block, err := fetchBlockFromDB(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("Block [%d] referred by the index is not found", blockNumber)
+	}
+	return block, nil
+}
+
+// fetchTransactionsByAddress returns the transactions executed by the given address, in chain order.
+// The blocks of the transactions are loaded with up to indexQueryConcurrency loads in parallel
+func fetchTransactionsByAddress(address string, limits scanLimits) ([]*protos.Transaction, bool, error) {
+	txLocations, truncated, err := fetchTransactionIndexesByAddress(address, limits)
+	if err != nil {
+		return nil, false, err
+	}
+	var blockNumbers []uint64
+	for _, txLocation := range txLocations {
+		if len(blockNumbers) == 0 || blockNumbers[len(blockNumbers)-1] != txLocation.BlockNumber {
+			blockNumbers = append(blockNumbers, txLocation.BlockNumber)
+		}
+	}
+	blocks, err := fetchBlocksConcurrently(blockNumbers)
+	if err != nil {
+		return nil, false, err
+	}
+	transactions := make([]*protos.Transaction, 0, len(txLocations))
+	blockIndex := 0
+	for _, txLocation := range txLocations {
+		for blockNumbers[blockIndex] != txLocation.BlockNumber {
+			blockIndex++
+		}
+		blockTxs := blocks[blockIndex].GetTransactions()
+		if txLocation.TxIndex >= uint64(len(blockTxs)) {
+			return nil, false, fmt.Errorf("Transaction index [%d] referred by the index is beyond the transactions of block [%d]",
+				txLocation.TxIndex, txLocation.BlockNumber)
+		}
+		transactions = append(transactions, blockTxs[txLocation.TxIndex])
+	}
+	return transactions, truncated, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_FetchBlocksConcurrently(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultConcurrency := indexQueryConcurrency
+	indexBlockDataSynchronously = true
+	indexQueryConcurrency = 3
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexQueryConcurrency = defaultConcurrency
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var uuids []string
+	for i := 0; i < 8; i++ {
+		tx, uuid := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+		uuids = append(uuids, uuid)
+	}
+
+	blockNumbers := []uint64{7, 0, 5, 2, 6, 1}
+	blocks, err := fetchBlocksConcurrently(blockNumbers)
+	testutil.AssertNoError(t, err, "Error while fetching blocks")
+	testutil.AssertEquals(t, len(blocks), len(blockNumbers))
+	for i, blockNumber := range blockNumbers {
+		testutil.AssertEquals(t, blocks[i].GetTransactions()[0].Uuid, uuids[blockNumber])
+	}
+
+	_, err = fetchBlocksConcurrently([]uint64{1, 2, 100, 3})
+	testutil.AssertError(t, err, "Expected an error for a block that is not found")
+
+	blocks, err = fetchBlocksConcurrently(nil)
+	testutil.AssertNoError(t, err, "Error while fetching no blocks")
+	testutil.AssertEquals(t, len(blocks), 0)
+}
+
+func TestIndexes_FetchTransactionsByAddressConcurrently(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultConcurrency := indexQueryConcurrency
+	defaultAddressExtractor := getTxExecutingAddresses
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexQueryConcurrency = defaultConcurrency
+		getTxExecutingAddresses = defaultAddressExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// address1 executes the first transaction of every block and the third one of every other block
+	executingAddresses := make(map[string]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	var expected []string
+	for i := 0; i < 12; i++ {
+		var txs []*protos.Transaction
+		for j := 0; j < 3; j++ {
+			tx, uuid := buildTestTx(t)
+			executingAddresses[uuid] = "address2"
+			if j == 0 || (j == 2 && i%2 == 0) {
+				executingAddresses[uuid] = "address1"
+				expected = append(expected, uuid)
+			}
+			txs = append(txs, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(txs, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		indexQueryConcurrency = concurrency
+		txs, truncated, err := fetchTransactionsByAddress("address1", testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching the transactions of the address")
+		testutil.AssertEquals(t, truncated, false)
+		testutil.AssertEquals(t, len(txs), len(expected))
+		for i, tx := range txs {
+			testutil.AssertEquals(t, tx.Uuid, expected[i])
+		}
+
+		txs, truncated, err = fetchTransactionsByAddress("address1", newScanLimits(5))
+		testutil.AssertNoError(t, err, "Error while fetching the transactions of the address")
+		testutil.AssertEquals(t, truncated, true)
+		testutil.AssertEquals(t, len(txs), 5)
+		for i, tx := range txs {
+			testutil.AssertEquals(t, tx.Uuid, expected[i])
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// FeeExtractor returns the fee paid by a transaction. The fees are indexed per block (blockNumber -> total fee)
+// and per executing address and block ((address,blockNumber) -> fee), see fetchBlockTotalFee and fetchAddressTotalFee
+type FeeExtractor func(tx *protos.Transaction) uint64
+
+// getTxFee returns the fee paid by the given transaction. No transaction pays a fee unless an extractor is registered
+var getTxFee FeeExtractor = func(tx *protos.Transaction) uint64 {
+	return 0
+}
+
+// RegisterFeeExtractor sets the extractor of the fee that is indexed for each transaction. It should be called
+// before the ledger, and hence its indexer, is created, as the fees of the blocks indexed before the call are not
+// counted. A nil extractor disables the fee indexing
+func RegisterFeeExtractor(extractor FeeExtractor) {
+	if extractor == nil {
+		extractor = func(tx *protos.Transaction) uint64 { return 0 }
+	}
+	getTxFee = extractor
+}
+
+// fetchBlockTotalFee returns the sum of the fees paid by the transactions of the given block.
+// It returns zero for a block without fees, as no entry is stored for such a block, and for a block that is not indexed
+func fetchBlockTotalFee(blockNumber uint64) (uint64, error) {
+	feeBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockTotalFeeKey(blockNumber))
+	if err != nil || feeBytes == nil {
+		return 0, err
+	}
+	return decodeBlockNumber(feeBytes)
+}
+
+// fetchAddressTotalFee returns the sum of the fees paid by the transactions executed by the given address.
+// The sum is taken over the (address,blockNumber) -> fee entries, so that indexing a block again does not count its
+// fees twice. The fees of the pruned or expired blocks are not included
+func fetchAddressTotalFee(address string) (uint64, error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	var totalFee uint64
+	prefix := encodeAddressBlockFeeKeyPrefix(address)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		fee, err := decodeBlockNumber(itr.Value().Data())
+		if err != nil {
+			return 0, err
+		}
+		totalFee += fee
+	}
+	return totalFee, nil
+}
+
+// blockFees returns the sum of the fees of the transactions of the block and, for each executing address, the sum of
+// the fees of the transactions it executed. The fee of a transaction with several executing addresses is counted for
+// each of them. The addresses whose transactions pay no fee are left out
+func blockFees(block *protos.Block) (uint64, map[string]uint64) {
+	var totalFee uint64
+	addressFees := make(map[string]uint64)
+	for _, tx := range block.GetTransactions() {
+		fee := getTxFee(tx)
+		if fee == 0 {
+			continue
+		}
+		totalFee += fee
+		for _, address := range getTxExecutingAddresses(tx) {
+			addressFees[address] += fee
+		}
+	}
+	return totalFee, addressFees
+}
+
+// putFeeIndexes adds the blockNumber -> total fee entry of the block and the (address,blockNumber) -> fee entry of
+// each address that paid a fee in the block. Nothing is added for a block without fees
+func putFeeIndexes(block *protos.Block, blockNumber uint64, putIndex func(key []byte, value []byte)) {
+	totalFee, addressFees := blockFees(block)
+	if totalFee == 0 {
+		return
+	}
+	putIndex(encodeBlockTotalFeeKey(blockNumber), encodeBlockNumber(totalFee))
+	for address, fee := range addressFees {
+		putIndex(encodeAddressBlockFeeCompositeKey(address, blockNumber), encodeBlockNumber(fee))
+	}
+}
+
+// the block number is big-endian encoded so that the keys are ordered by block number
+func encodeBlockTotalFeeKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockTotalFeeKey, encodeIndexUint64(blockNumber))
+}
+
+func encodeAddressBlockFeeCompositeKey(address string, blockNumber uint64) []byte {
+	return append(encodeAddressBlockFeeKeyPrefix(address), encodeIndexUint64(blockNumber)...)
+}
+
+func encodeAddressBlockFeeKeyPrefix(address string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixAddressBlockFeeCompositeKey))
+	b.EncodeRawBytes([]byte(addressKeyForm(address)))
+	return b.Bytes()
+}
@@ -0,0 +1,158 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// feeTestTx is the executing address and the fee of a test transaction
+type feeTestTx struct {
+	address string
+	fee     uint64
+}
+
+// feeTestBlocks returns blocks of transactions with the given addresses and fees, with the extractors of the addresses
+// and fees set for them
+func feeTestBlocks(t *testing.T, blockTxs [][]feeTestTx) []*protos.Block {
+	executingAddresses := make(map[string]string)
+	fees := make(map[string]uint64)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	RegisterFeeExtractor(func(tx *protos.Transaction) uint64 {
+		return fees[tx.Uuid]
+	})
+	var blocks []*protos.Block
+	for _, txs := range blockTxs {
+		var transactions []*protos.Transaction
+		for _, feeTx := range txs {
+			tx, uuid := buildTestTx(t)
+			executingAddresses[uuid] = feeTx.address
+			fees[uuid] = feeTx.fee
+			transactions = append(transactions, tx)
+		}
+		blocks = append(blocks, protos.NewBlock(transactions, nil))
+	}
+	return blocks
+}
+
+var feeTestBlockTxs = [][]feeTestTx{
+	{{"address1", 5}, {"address2", 0}, {"address1", 7}},
+	{{"address1", 3}, {"address2", 2}},
+	{{"address1", 0}, {"address2", 0}},
+}
+
+func assertFees(t *testing.T) {
+	for blockNumber, expectedFee := range []uint64{12, 5, 0, 0} {
+		fee, err := fetchBlockTotalFee(uint64(blockNumber))
+		testutil.AssertNoError(t, err, "Error while fetching the total fee of the block")
+		testutil.AssertEquals(t, fee, expectedFee)
+	}
+	for address, expectedFee := range map[string]uint64{"address1": 15, "address2": 2, "unknown": 0} {
+		fee, err := fetchAddressTotalFee(address)
+		testutil.AssertNoError(t, err, "Error while fetching the total fee of the address")
+		testutil.AssertEquals(t, fee, expectedFee)
+	}
+}
+
+func TestIndexes_FetchFees(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultAddressExtractor := getTxExecutingAddresses
+	defaultFeeExtractor := getTxFee
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxExecutingAddresses = defaultAddressExtractor
+		getTxFee = defaultFeeExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i, block := range feeTestBlocks(t, feeTestBlockTxs) {
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	assertFees(t)
+
+	// no entry is stored for a block without fees
+	value, err := getIndexValue(encodeBlockTotalFeeKey(2))
+	testutil.AssertNoError(t, err, "Error while reading the total fee entry")
+	testutil.AssertNil(t, value)
+}
+
+func TestIndexes_FetchFeesBulkIndexed(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultChunkBlocks := indexBulkChunkBlocks
+	indexBlockDataSynchronously = true
+	indexBulkChunkBlocks = 2
+	defaultAddressExtractor := getTxExecutingAddresses
+	defaultFeeExtractor := getTxFee
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexBulkChunkBlocks = defaultChunkBlocks
+		getTxExecutingAddresses = defaultAddressExtractor
+		getTxFee = defaultFeeExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// the fees of the blocks of a chunk add up, and indexing the blocks again does not count them twice
+	blocks := feeTestBlocks(t, feeTestBlockTxs)
+	testutil.AssertNoError(t, indexBlocks(blocks, 0), "Error while indexing blocks")
+	assertFees(t)
+	testutil.AssertNoError(t, indexBlocks(blocks, 0), "Error while indexing blocks again")
+	assertFees(t)
+}
+
+func TestIndexes_FetchFeesPrunedAndReindexed(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultAddressExtractor := getTxExecutingAddresses
+	defaultFeeExtractor := getTxFee
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxExecutingAddresses = defaultAddressExtractor
+		getTxFee = defaultFeeExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	blocks := feeTestBlocks(t, feeTestBlockTxs)
+	for i, block := range blocks {
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	// the fees of a pruned block are no longer counted
+	done, err := pruneIndexesBelow(1, 1, 0)
+	testutil.AssertNoError(t, err, "Error while pruning the indexes")
+	testutil.AssertEquals(t, done, true)
+	fee, err := fetchAddressTotalFee("address1")
+	testutil.AssertNoError(t, err, "Error while fetching the total fee of the address")
+	testutil.AssertEquals(t, fee, uint64(3))
+
+	// and indexing the block number again counts them once
+	testutil.AssertNoError(t, indexBlocks(blocks[:1], 0), "Error while indexing the pruned block again")
+	assertFees(t)
+}
@@ -0,0 +1,251 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexInternBlockAddresses, when true, stores the addresses of a block as a single blockNumber -> address ids
+// entry instead of one (blockNumber,address) entry per address. Each address is interned to a small integer id
+// the first time it is indexed (address -> id and id -> address entries), and the ids of a block are stored as
+// a delta encoded integer set. The addresses of a block mostly recur across blocks, so this takes much less
+// space than the (blockNumber,address) entries when the addresses are long. The interning entries are not tied
+// to a block and hence are retained when the indexes of a block are pruned.
+// Switching this on an existing ledger requires rebuildAddressIndex
+var indexInternBlockAddresses = false
+
+// internIDs caches the next address id to assign for the opened db. The cache is keyed by the rocksdb handle
+// so that it is derived again from the highest id in the db once the db is reopened. The ids are never
+// persisted separately: an id taken by a write that fails is skipped
+var internIDs struct {
+	sync.Mutex
+	rocksDB *gorocksdb.DB
+	nextID  uint64
+}
+
+// blockAddressIDsLock serializes the read-modify-write of the address ids of a block by appendAddressTxIndexes.
+// The ids are an integer set rather than a list value, hence they are not covered by the locks of appendToListValue
+var blockAddressIDsLock sync.Mutex
+
+// batchInternIDs holds the ids assigned to new addresses by the blocks of a WriteBatch. The blocks of a batch
+// do not see each other's uncommitted entries, so the ids are looked up here as well, and an address first
+// indexed by several blocks of the batch gets a single id
+type batchInternIDs map[string]uint64
+
+// internAddress returns the id of the address, assigning the next id and adding the address -> id and
+// id -> address entries if the address has none, neither in the db nor in batchIDs. batchIDs may be nil
+// for a WriteBatch that holds a single block
+func internAddress(address string, batchIDs batchInternIDs, putIndex func(key []byte, value []byte)) (uint64, error) {
+	openchainDB := db.GetDBHandle()
+	key := encodeAddressInternIDKey(address)
+	idBytes, err := openchainDB.GetFromIndexesCF(key)
+	if err != nil {
+		return 0, err
+	}
+	if idBytes != nil {
+		return decodeBlockNumber(idBytes)
+	}
+	if id, ok := batchIDs[address]; ok {
+		return id, nil
+	}
+	internIDs.Lock()
+	defer internIDs.Unlock()
+	if internIDs.rocksDB != openchainDB.DB {
+		nextID, err := fetchNextInternID()
+		if err != nil {
+			return 0, err
+		}
+		internIDs.rocksDB = openchainDB.DB
+		internIDs.nextID = nextID
+	}
+	id := internIDs.nextID
+	internIDs.nextID++
+	if batchIDs != nil {
+		batchIDs[address] = id
+	}
+	putIndex(key, encodeBlockNumber(id))
+	putIndex(encodeInternIDAddressKey(id), []byte(address))
+	return id, nil
+}
+
+// fetchNextInternID returns one more than the highest id in the id -> address entries, or 0 if there is none
+func fetchNextInternID() (uint64, error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	prefix := newIndexKey(prefixInternIDAddressKey)
+	seekToLastForPrefix(itr, prefixInternIDAddressKey)
+	if !itr.ValidForPrefix(prefix) {
+		return 0, nil
+	}
+	highestID, err := decodeUint64At(itr.Key().Data(), len(prefix))
+	if err != nil {
+		return 0, err
+	}
+	return highestID + 1, nil
+}
+
+// fetchInternedAddress returns the address with the given id
+func fetchInternedAddress(id uint64) (string, error) {
+	address, err := db.GetDBHandle().GetFromIndexesCF(encodeInternIDAddressKey(id))
+	if err != nil {
+		return "", err
+	}
+	if address == nil {
+		return "", fmt.Errorf("No address is interned with id [%d]", id)
+	}
+	return string(address), nil
+}
+
+// putBlockAddressIDs adds the blockNumber -> address ids entry of the block, interning the addresses as needed.
+// The new addresses of a block are interned in sorted order, so that the ids do not depend on the order of
+// the addresses. Nothing is added unless indexInternBlockAddresses is set; as for the (blockNumber,address) entries,
+// nothing is added either if indexAddressLatestBlockOnly is set
+func putBlockAddressIDs(blockNumber uint64, addresses []string, batchIDs batchInternIDs,
+	putIndex func(key []byte, value []byte)) error {
+	if !indexInternBlockAddresses || indexAddressLatestBlockOnly || len(addresses) == 0 {
+		return nil
+	}
+	sortedAddresses := make([]string, len(addresses))
+	copy(sortedAddresses, addresses)
+	sort.Strings(sortedAddresses)
+	ids := make([]uint64, 0, len(addresses))
+	for _, address := range sortedAddresses {
+		id, err := internAddress(address, batchIDs, putIndex)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	putIndex(encodeBlockAddressIDsKey(blockNumber), encodeIntegerSet(ids))
+	return nil
+}
+
+// appendBlockAddressID adds the id of the address to the address ids entry of the block. The caller holds
+// blockAddressIDsLock until the entry is written
+func appendBlockAddressID(blockNumber uint64, address string, putIndex func(key []byte, value []byte)) error {
+	id, err := internAddress(address, nil, putIndex)
+	if err != nil {
+		return err
+	}
+	ids, err := fetchBlockAddressIDs(blockNumber)
+	if err != nil {
+		return err
+	}
+	putIndex(encodeBlockAddressIDsKey(blockNumber), encodeIntegerSet(append(ids, id)))
+	return nil
+}
+
+// fetchBlockAddressIDs returns the ids of the addresses of the block in ascending order
+func fetchBlockAddressIDs(blockNumber uint64) ([]uint64, error) {
+	idsBytes, err := getIndexValue(encodeBlockAddressIDsKey(blockNumber))
+	if err != nil || idsBytes == nil {
+		return nil, err
+	}
+	return decodeIntegerSet(idsBytes)
+}
+
+// fetchInternedAddressesInBlock is fetchAddressesInBlock for indexInternBlockAddresses. The addresses are
+// returned in the order of their ids, i.e., in the order in which they were first indexed
+func fetchInternedAddressesInBlock(blockNumber uint64, limits scanLimits) ([]string, bool, error) {
+	ids, err := fetchBlockAddressIDs(blockNumber)
+	if err != nil {
+		return nil, false, err
+	}
+	var addresses []string
+	for _, id := range ids {
+		if limits.reached(len(addresses)) {
+			return addresses, true, nil
+		}
+		address, err := fetchInternedAddress(id)
+		if err != nil {
+			return nil, false, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, false, nil
+}
+
+// ascendingInternIDs sorts ids in ascending order
+type ascendingInternIDs []uint64
+
+func (ids ascendingInternIDs) Len() int {
+	return len(ids)
+}
+
+func (ids ascendingInternIDs) Less(i, j int) bool {
+	return ids[i] < ids[j]
+}
+
+func (ids ascendingInternIDs) Swap(i, j int) {
+	ids[i], ids[j] = ids[j], ids[i]
+}
+
+// encodeIntegerSet encodes the distinct ids in ascending order, as the varint of the first id followed by the
+// varints of the differences between consecutive ids, so that ids assigned close together take a byte each
+func encodeIntegerSet(ids []uint64) []byte {
+	sortedIDs := make([]uint64, len(ids))
+	copy(sortedIDs, ids)
+	sort.Sort(ascendingInternIDs(sortedIDs))
+	b := proto.NewBuffer([]byte{})
+	for i, id := range sortedIDs {
+		switch {
+		case i == 0:
+			b.EncodeVarint(id)
+		case id != sortedIDs[i-1]:
+			b.EncodeVarint(id - sortedIDs[i-1])
+		}
+	}
+	return b.Bytes()
+}
+
+func decodeIntegerSet(value []byte) ([]uint64, error) {
+	var ids []uint64
+	for len(value) > 0 {
+		delta, n := binary.Uvarint(value)
+		if n <= 0 || (len(ids) > 0 && delta == 0) {
+			return nil, fmt.Errorf("Invalid encoding of integer set")
+		}
+		if len(ids) > 0 {
+			delta += ids[len(ids)-1]
+		}
+		ids = append(ids, delta)
+		value = value[n:]
+	}
+	return ids, nil
+}
+
+func encodeAddressInternIDKey(address string) []byte {
+	return prependKeyPrefix(prefixAddressInternIDKey, []byte(addressKeyForm(address)))
+}
+
+// the ids are big-endian encoded so that the highest id is the last key
+func encodeInternIDAddressKey(id uint64) []byte {
+	return prependKeyPrefix(prefixInternIDAddressKey, encodeIndexUint64(id))
+}
+
+func encodeBlockAddressIDsKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockAddressIDsKey, encodeIndexUint64(blockNumber))
+}
@@ -0,0 +1,195 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// internTestBlocks returns blocks of transactions executed by the given addresses, with the address extractor set for them
+func internTestBlocks(t *testing.T, blockAddresses [][]string) []*protos.Block {
+	executingAddresses := make(map[string]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	var blocks []*protos.Block
+	for _, addresses := range blockAddresses {
+		var transactions []*protos.Transaction
+		for _, address := range addresses {
+			tx, uuid := buildTestTx(t)
+			executingAddresses[uuid] = address
+			transactions = append(transactions, tx)
+		}
+		blocks = append(blocks, protos.NewBlock(transactions, nil))
+	}
+	return blocks
+}
+
+var internTestLongAddress = strings.Repeat("long-address-", 10)
+
+var internTestBlockAddresses = [][]string{
+	{"address1", internTestLongAddress, "address1"},
+	{"address2", "address1"},
+	{internTestLongAddress, "address2", "address3"},
+}
+
+// assertInternedAddresses checks that the addresses of each block are read back as the original strings
+func assertInternedAddresses(t *testing.T) {
+	for blockNumber, addresses := range internTestBlockAddresses {
+		expected := make(map[string]bool)
+		for _, address := range addresses {
+			expected[address] = true
+		}
+		fetched, truncated, err := fetchAddressesInBlock(uint64(blockNumber), testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching the addresses of the block")
+		testutil.AssertEquals(t, truncated, false)
+		testutil.AssertEquals(t, len(fetched), len(expected))
+		for _, address := range fetched {
+			testutil.AssertEquals(t, expected[address], true)
+		}
+	}
+}
+
+func TestIndexes_IntegerSetEncoding(t *testing.T) {
+	for _, ids := range [][]uint64{nil, {0}, {7}, {3, 1, 2}, {5, 5, 0, 300, 1 << 40}} {
+		expected := []uint64{}
+		seen := make(map[uint64]bool)
+		for _, id := range ids {
+			if !seen[id] {
+				expected = append(expected, id)
+				seen[id] = true
+			}
+		}
+		sort.Sort(ascendingInternIDs(expected))
+		decoded, err := decodeIntegerSet(encodeIntegerSet(ids))
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error while decoding the integer set %v", ids))
+		testutil.AssertEquals(t, len(decoded), len(expected))
+		for i := range expected {
+			testutil.AssertEquals(t, decoded[i], expected[i])
+		}
+	}
+	// consecutive ids take a byte each
+	testutil.AssertEquals(t, len(encodeIntegerSet([]uint64{1000, 1001, 1002})), 4)
+
+	_, err := decodeIntegerSet([]byte{0x80})
+	testutil.AssertError(t, err, "Expected an error for a truncated varint")
+	_, err = decodeIntegerSet([]byte{0x01, 0x00})
+	testutil.AssertError(t, err, "Expected an error for a repeated id")
+}
+
+func TestIndexes_InternBlockAddresses(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultIntern := indexInternBlockAddresses
+	defaultMaxAddressLength := indexMaxAddressLength
+	defaultAddressExtractor := getTxExecutingAddresses
+	indexBlockDataSynchronously = true
+	indexInternBlockAddresses = true
+	indexMaxAddressLength = 32
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexInternBlockAddresses = defaultIntern
+		indexMaxAddressLength = defaultMaxAddressLength
+		getTxExecutingAddresses = defaultAddressExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i, block := range internTestBlocks(t, internTestBlockAddresses) {
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	assertInternedAddresses(t)
+
+	// each address is interned once and round-trips through its id
+	for id, address := range []string{"address1", internTestLongAddress, "address2", "address3"} {
+		idBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeAddressInternIDKey(address))
+		testutil.AssertNoError(t, err, "Error while reading the id of the address")
+		internedID, err := decodeBlockNumber(idBytes)
+		testutil.AssertNoError(t, err, "Error while decoding the id of the address")
+		testutil.AssertEquals(t, internedID, uint64(id))
+		internedAddress, err := fetchInternedAddress(internedID)
+		testutil.AssertNoError(t, err, "Error while fetching the interned address")
+		testutil.AssertEquals(t, internedAddress, address)
+	}
+	_, err := fetchInternedAddress(4)
+	testutil.AssertError(t, err, "Expected an error for an id that is not assigned")
+
+	// the addresses of a block are stored as ids instead of (blockNumber,address) entries
+	ids, err := fetchBlockAddressIDs(1)
+	testutil.AssertNoError(t, err, "Error while fetching the address ids of the block")
+	testutil.AssertEquals(t, ids, []uint64{0, 2})
+	itr := newIndexIterator(prefixBlockNumAddressCompositeKey)
+	defer itr.Close()
+	prefix := newIndexKey(prefixBlockNumAddressCompositeKey)
+	itr.Seek(prefix)
+	testutil.AssertEquals(t, itr.ValidForPrefix(prefix), false)
+
+	addresses, truncated, err := fetchAddressesInBlock(2, newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching the addresses of the block")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, addresses, []string{internTestLongAddress, "address2"})
+
+	// appending tx indexes of a new address adds it to the ids of the block
+	testutil.AssertNoError(t, appendAddressTxIndexes("address4", 1, []uint64{5}), "Error while appending tx indexes")
+	addresses, _, err = fetchAddressesInBlock(1, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching the addresses of the block")
+	testutil.AssertEquals(t, addresses, []string{"address1", "address2", "address4"})
+}
+
+func TestIndexes_InternBlockAddressesBulkIndexed(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultIntern := indexInternBlockAddresses
+	defaultChunkBlocks := indexBulkChunkBlocks
+	defaultAddressExtractor := getTxExecutingAddresses
+	indexBlockDataSynchronously = true
+	indexInternBlockAddresses = true
+	indexBulkChunkBlocks = 2
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexInternBlockAddresses = defaultIntern
+		indexBulkChunkBlocks = defaultChunkBlocks
+		getTxExecutingAddresses = defaultAddressExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// an address first indexed by two blocks of a chunk gets a single id
+	blocks := internTestBlocks(t, internTestBlockAddresses)
+	testutil.AssertNoError(t, indexBlocks(blocks, 0), "Error while indexing blocks")
+	assertInternedAddresses(t)
+	nextID, err := fetchNextInternID()
+	testutil.AssertNoError(t, err, "Error while fetching the next intern id")
+	testutil.AssertEquals(t, nextID, uint64(4))
+	ids, err := fetchBlockAddressIDs(1)
+	testutil.AssertNoError(t, err, "Error while fetching the address ids of the block")
+	testutil.AssertEquals(t, ids, []uint64{0, 2})
+
+	testutil.AssertNoError(t, indexBlocks(blocks, 0), "Error while indexing blocks again")
+	assertInternedAddresses(t)
+	nextID, err = fetchNextInternID()
+	testutil.AssertNoError(t, err, "Error while fetching the next intern id")
+	testutil.AssertEquals(t, nextID, uint64(4))
+}
@@ -0,0 +1,45 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+)
+
+// MarshalJSON encodes the block summary with the block hash hex-encoded
+func (summary BlockSummary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlockNumber uint64 `json:"blockNumber"`
+		BlockHash   string `json:"blockHash"`
+		TxCount     uint64 `json:"txCount"`
+	}{summary.BlockNumber, hex.EncodeToString(summary.BlockHash), summary.TxCount})
+}
+
+// MarshalIndexQueryResult encodes the result of an index query (e.g., []*TransactionLocation or []*BlockSummary)
+// as JSON for consumption by external tools. The field names are stable and the byte fields are hex-encoded.
+// A nil list (e.g., no matching transactions) is encoded as an empty list rather than null
+func MarshalIndexQueryResult(result interface{}) ([]byte, error) {
+	if result == nil {
+		return []byte("[]"), nil
+	}
+	if value := reflect.ValueOf(result); value.Kind() == reflect.Slice && value.IsNil() {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestIndexes_MarshalIndexQueryResult(t *testing.T) {
+	jsonBytes, err := MarshalIndexQueryResult([]*TransactionLocation{{1, 2}, {3, 0}})
+	testutil.AssertNoError(t, err, "Error while marshalling transaction locations")
+	testutil.AssertEquals(t, string(jsonBytes), `[{"blockNumber":1,"txIndex":2},{"blockNumber":3,"txIndex":0}]`)
+
+	jsonBytes, err = MarshalIndexQueryResult([]*BlockSummary{{5, []byte{0xab, 0x01}, 7}})
+	testutil.AssertNoError(t, err, "Error while marshalling block summaries")
+	testutil.AssertEquals(t, string(jsonBytes), `[{"blockNumber":5,"blockHash":"ab01","txCount":7}]`)
+
+	var noResult []*TransactionLocation
+	jsonBytes, err = MarshalIndexQueryResult(noResult)
+	testutil.AssertNoError(t, err, "Error while marshalling empty result")
+	testutil.AssertEquals(t, string(jsonBytes), `[]`)
+}
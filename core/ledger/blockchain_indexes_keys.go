@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import "fmt"
+
+// keyEncoder encodes the keys of the index entries that are keyed by a single identifier. An alternative encoder
+// (e.g., collation friendly) can be installed as indexKeyEncoder without changing the call sites, which use the
+// encode*Key and decode*Key functions. As the block hash and block number keys are also scanned by prefix,
+// an encoder must start every key with newIndexKey(prefix) and keep the block number keys in ascending order.
+// The composite keys are not part of the interface, as their decoders and prefix scans depend on the layout of the key.
+// An encoder should not be changed for an existing db
+type keyEncoder interface {
+	encodeBlockHashKey(blockHash []byte) []byte
+	decodeBlockHashKey(key []byte) []byte
+	encodeBlockNumberKey(blockNumber uint64) []byte
+	decodeBlockNumberKey(key []byte) (uint64, error)
+	encodeBlockTxCountKey(blockNumber uint64) []byte
+	encodeTxUUIDKey(txUUID string) []byte
+	encodeTxExecutingAddressesKey(txUUID string) []byte
+	encodeAddressDigestKey(addressDigest string) []byte
+}
+
+// defaultKeyEncoder prepends the key type prefix (and the namespace, if any) to the raw identifier
+type defaultKeyEncoder struct {
+}
+
+var indexKeyEncoder keyEncoder = defaultKeyEncoder{}
+
+func (defaultKeyEncoder) encodeBlockHashKey(blockHash []byte) []byte {
+	return prependKeyPrefix(prefixBlockHashKey, blockHash)
+}
+
+func (defaultKeyEncoder) decodeBlockHashKey(key []byte) []byte {
+	return key[indexKeyHeaderLength():]
+}
+
+// the block number is big-endian encoded so that keys are ordered by block number
+func (defaultKeyEncoder) encodeBlockNumberKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockNumberKey, encodeIndexUint64(blockNumber))
+}
+
+func (defaultKeyEncoder) decodeBlockNumberKey(key []byte) (uint64, error) {
+	if len(key) != indexKeyHeaderLength()+8 {
+		return 0, fmt.Errorf("Invalid block number key [%x]", key)
+	}
+	return decodeIndexUint64(key[indexKeyHeaderLength():]), nil
+}
+
+func (defaultKeyEncoder) encodeBlockTxCountKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockTxCountKey, encodeIndexUint64(blockNumber))
+}
+
+// with more than one partition (see indexTxUUIDPartitions), the partition byte of the txUUID follows the prefix
+func (defaultKeyEncoder) encodeTxUUIDKey(txUUID string) []byte {
+	return append(encodeTxUUIDPartitionKeyPrefix(txUUIDPartition(txUUID)), txUUID...)
+}
+
+func (defaultKeyEncoder) encodeTxExecutingAddressesKey(txUUID string) []byte {
+	return prependKeyPrefix(prefixTxExecutingAddressesKey, []byte(txUUID))
+}
+
+func (defaultKeyEncoder) encodeAddressDigestKey(addressDigest string) []byte {
+	return prependKeyPrefix(prefixAddressDigestKey, []byte(addressDigest))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_DefaultKeyEncoder(t *testing.T) {
+	encoder := defaultKeyEncoder{}
+	blockNumberBytes := []byte{0, 0, 0, 0, 0, 0, 1, 2}
+
+	testutil.AssertEquals(t, encoder.encodeBlockHashKey([]byte("hash")), append([]byte{prefixBlockHashKey}, "hash"...))
+	testutil.AssertEquals(t, encoder.encodeBlockNumberKey(258), append([]byte{prefixBlockNumberKey}, blockNumberBytes...))
+	testutil.AssertEquals(t, encoder.encodeBlockTxCountKey(258), append([]byte{prefixBlockTxCountKey}, blockNumberBytes...))
+	testutil.AssertEquals(t, encoder.encodeTxUUIDKey("uuid"), append([]byte{prefixTxUUIDKey}, "uuid"...))
+	testutil.AssertEquals(t, encoder.encodeTxExecutingAddressesKey("uuid"), append([]byte{prefixTxExecutingAddressesKey}, "uuid"...))
+	testutil.AssertEquals(t, encoder.encodeAddressDigestKey("digest"), append([]byte{prefixAddressDigestKey}, "digest"...))
+	testutil.AssertEquals(t, encoder.decodeBlockHashKey(encoder.encodeBlockHashKey([]byte("hash"))), []byte("hash"))
+	blockNumber, err := encoder.decodeBlockNumberKey(encoder.encodeBlockNumberKey(258))
+	testutil.AssertNoError(t, err, "Error while decoding block number key")
+	testutil.AssertEquals(t, blockNumber, uint64(258))
+
+	defaultNamespace := indexKeyNamespace
+	indexKeyNamespace = 0x80
+	defer func() { indexKeyNamespace = defaultNamespace }()
+	testutil.AssertEquals(t, encoder.encodeTxUUIDKey("uuid"), append([]byte{0x80, prefixTxUUIDKey}, "uuid"...))
+	testutil.AssertEquals(t, encoder.encodeBlockNumberKey(258), append([]byte{0x80, prefixBlockNumberKey}, blockNumberBytes...))
+	blockNumber, err = encoder.decodeBlockNumberKey(encoder.encodeBlockNumberKey(258))
+	testutil.AssertNoError(t, err, "Error while decoding block number key")
+	testutil.AssertEquals(t, blockNumber, uint64(258))
+}
+
+func TestIndexes_IndexByteOrder(t *testing.T) {
+	defaultLittleEndian := indexKeysLittleEndian
+	defer func() {
+		indexKeysLittleEndian = defaultLittleEndian
+		setIndexByteOrderFromConfig()
+	}()
+
+	for _, littleEndian := range []bool{false, true} {
+		indexKeysLittleEndian = littleEndian
+		setIndexByteOrderFromConfig()
+		var byteOrder binary.ByteOrder = binary.BigEndian
+		if littleEndian {
+			byteOrder = binary.LittleEndian
+		}
+		expectedBytes := make([]byte, 8)
+		byteOrder.PutUint64(expectedBytes, 258)
+
+		key := encodeBlockNumberKey(258)
+		testutil.AssertEquals(t, key, append([]byte{prefixBlockNumberKey}, expectedBytes...))
+		blockNumber, err := decodeBlockNumberKey(key)
+		testutil.AssertNoError(t, err, "Error while decoding block number key")
+		testutil.AssertEquals(t, blockNumber, uint64(258))
+
+		txType, blockNumber, txIndex, err := decodeTxTypeCompositeKey(encodeTxTypeCompositeKey(protos.Transaction_CHAINCODE_QUERY, 258, 7))
+		testutil.AssertNoError(t, err, "Error while decoding tx type key")
+		testutil.AssertEquals(t, txType, protos.Transaction_CHAINCODE_QUERY)
+		testutil.AssertEquals(t, blockNumber, uint64(258))
+		testutil.AssertEquals(t, txIndex, uint64(7))
+
+		txCount, blockNumber, err := decodeTxCountBlockNumCompositeKey(encodeTxCountBlockNumCompositeKey(1000, 258))
+		testutil.AssertNoError(t, err, "Error while decoding tx count key")
+		testutil.AssertEquals(t, txCount, uint64(1000))
+		testutil.AssertEquals(t, blockNumber, uint64(258))
+
+		txSize, err := decodeTxSizeKey(encodeTxSizeKey(4096, 258, 7))
+		testutil.AssertNoError(t, err, "Error while decoding tx size key")
+		testutil.AssertEquals(t, txSize, uint64(4096))
+
+		deletedAt := time.Unix(1000, 5)
+		decodedDeletedAt, err := decodeIndexTombstone(encodeIndexTombstone(deletedAt))
+		testutil.AssertNoError(t, err, "Error while decoding tombstone")
+		testutil.AssertEquals(t, decodedDeletedAt.Equal(deletedAt), true)
+	}
+}
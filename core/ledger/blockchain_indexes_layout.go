@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+// indexKeyLayout describes the key and value encoding of one type of index entry, for tools
+// that read the indexes column family outside of Go. Every key starts with the namespace byte
+// (only if indexKeyNamespace is non-zero) followed by the prefix byte. In the encodings,
+// 'varint' is an unsigned protobuf varint, 'uint64be' is a fixed 8 byte big-endian integer
+// ('uint32be' a fixed 4 byte one, both little-endian instead if indexKeysLittleEndian is set) and
+// 'bytes' is a varint length followed by that many bytes. An address in a key is replaced by its digest
+// if it is longer than indexMaxAddressLength
+type indexKeyLayout struct {
+	Prefix byte   `json:"prefix"`
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	// ValueChecksummed is true for the values that are wrapped by encodeIndexValue
+	// (codec tag + value + uint32be crc32) when indexValueChecksums is set
+	ValueChecksummed bool `json:"valueChecksummed"`
+}
+
+// describeKeyLayout returns the layout of every type of index entry, ordered by prefix
+func describeKeyLayout() []indexKeyLayout {
+	return []indexKeyLayout{
+		{prefixLastIndexedBlockKey, "lastIndexedBlock", "prefix", "blockNumber varint", false},
+		{prefixBlockHashKey, "blockHash", "prefix + raw blockHash", "blockNumber varint", true},
+		{prefixTxUUIDKey, "txUUID", "prefix + partition byte (if indexTxUUIDPartitions > 1) + raw txUUID",
+			"blockNumber varint + txIndex varint", true},
+		{prefixAddressBlockNumCompositeKey, "addressBlockNum", "prefix + address bytes + blockNumber varint",
+			"repeated txIndex varint", true},
+		{prefixAddressChaincodeIDCompositeKey, "addressChaincodeID", "prefix + address bytes + marshalled ChaincodeID bytes",
+			"empty", false},
+		{prefixTxSizeKey, "txSize", "prefix + txSize uint64be + blockNumber varint + txIndex varint",
+			"blockNumber varint + txIndex varint", true},
+		{prefixTxReferenceCompositeKey, "txReference", "prefix + referencedTxUUID bytes + txUUID bytes", "empty", false},
+		{prefixPruneCursorKey, "pruneCursor", "prefix", "prunedBelow varint + targetBlockNumber varint", false},
+		{prefixTxTypeCompositeKey, "txType", "prefix + txType uint32be + blockNumber uint64be + txIndex uint64be",
+			"empty", false},
+		{prefixBlockNumberKey, "blockNumber", "prefix + blockNumber uint64be", "raw blockHash", true},
+		{prefixProposerBlockNumCompositeKey, "proposerBlockNum", "prefix + proposer bytes + blockNumber uint64be",
+			"empty", false},
+		{prefixTxExecutingAddressesKey, "txExecutingAddresses", "prefix + raw txUUID", "repeated address bytes", true},
+		{prefixTxCountBlockNumCompositeKey, "txCountBlockNum", "prefix + cumulativeTxCount uint64be + blockNumber uint64be",
+			"empty", false},
+		{prefixTxMetadataCompositeKey, "txMetadata",
+			"prefix + metadataKey bytes + metadataValue bytes + blockNumber varint + txIndex varint",
+			"blockNumber varint + txIndex varint", true},
+		{prefixAddressDigestKey, "addressDigest", "prefix + raw address digest", "raw full address", false},
+		{prefixBlockTxCountKey, "blockTxCount", "prefix + blockNumber uint64be", "txCount varint", false},
+		{prefixBlockNumAddressCompositeKey, "blockNumAddress", "prefix + blockNumber uint64be + address bytes", "empty", false},
+		{prefixChaincodeHistoryCompositeKey, "chaincodeHistory",
+			"prefix + chaincodePath bytes + blockNumber uint64be + txIndex uint64be", "raw chaincodeName", false},
+		{prefixAddressLatestBlockKey, "addressLatestBlock", "prefix + raw address", "blockNumber varint", false},
+		{prefixIndexTombstoneKey, "indexTombstone", "prefix + deleted index key", "deletion time unix nanoseconds uint64be", false},
+		{prefixChaincodeTxCompositeKey, "chaincodeTx", "prefix + chaincodeName bytes + blockNumber uint64be + txIndex uint64be",
+			"empty", false},
+		{prefixIndexSchemaVersionKey, "indexSchemaVersion", "prefix",
+			"schemaVersion varint + byteOrder byte (0 big-endian, 1 little-endian)", false},
+		{prefixPreviousBlockHashKey, "previousBlockHash", "prefix + blockNumber uint64be", "raw previousBlockHash", true},
+		{prefixAddressTxIndexesContinuationKey, "addressTxIndexesContinuation",
+			"prefix + address bytes + blockNumber varint + sequence uint64be", "repeated txIndex varint", true},
+		{prefixTxTagCompositeKey, "txTag", "prefix + tag bytes + blockNumber uint64be + txIndex uint64be", "empty", false},
+		{prefixActiveAddressCFKey, "activeAddressCF", "prefix", "0 (addressIndexesCF) or 1 (addressIndexesAltCF) byte", false},
+		{prefixTxSignatureHashCompositeKey, "txSignatureHash",
+			"prefix + signatureHash bytes + blockNumber uint64be + txIndex uint64be", "empty", false},
+		{prefixBlockTotalFeeKey, "blockTotalFee", "prefix + blockNumber uint64be", "totalFee varint", false},
+		{prefixAddressBlockFeeCompositeKey, "addressBlockFee", "prefix + address bytes + blockNumber uint64be", "fee varint",
+			false},
+		{prefixIndexVerifyCursorKey, "indexVerifyCursor", "prefix", "nextBlockNumber varint", false},
+		{prefixBlockTimestampKey, "blockTimestamp", "prefix + blockNumber uint64be", "marshalled Timestamp", false},
+		{prefixTimestampBlockNumCompositeKey, "timestampBlockNum",
+			"prefix + (timestampSeconds with the sign bit flipped) uint64be + blockNumber uint64be", "empty", false},
+		{prefixAddressInternIDKey, "addressInternID", "prefix + raw address", "id varint", false},
+		{prefixInternIDAddressKey, "internIDAddress", "prefix + id uint64be", "raw full address", false},
+		{prefixBlockAddressIDsKey, "blockAddressIDs", "prefix + blockNumber uint64be",
+			"first id varint + repeated id delta varint", false},
+		{prefixIndexExpiryThresholdKey, "indexExpiryThreshold", "prefix", "blockNumber varint", false},
+	}
+}
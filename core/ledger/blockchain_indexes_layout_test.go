@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestIndexes_DescribeKeyLayout(t *testing.T) {
+	allPrefixes := []byte{
+		prefixLastIndexedBlockKey,
+		prefixBlockHashKey,
+		prefixTxUUIDKey,
+		prefixAddressBlockNumCompositeKey,
+		prefixAddressChaincodeIDCompositeKey,
+		prefixTxSizeKey,
+		prefixTxReferenceCompositeKey,
+		prefixPruneCursorKey,
+		prefixTxTypeCompositeKey,
+		prefixBlockNumberKey,
+		prefixProposerBlockNumCompositeKey,
+		prefixTxExecutingAddressesKey,
+		prefixTxCountBlockNumCompositeKey,
+		prefixTxMetadataCompositeKey,
+		prefixAddressDigestKey,
+		prefixBlockTxCountKey,
+		prefixBlockNumAddressCompositeKey,
+		prefixChaincodeHistoryCompositeKey,
+		prefixAddressLatestBlockKey,
+		prefixIndexTombstoneKey,
+		prefixChaincodeTxCompositeKey,
+		prefixIndexSchemaVersionKey,
+		prefixPreviousBlockHashKey,
+		prefixAddressTxIndexesContinuationKey,
+		prefixTxTagCompositeKey,
+		prefixActiveAddressCFKey,
+		prefixTxSignatureHashCompositeKey,
+		prefixBlockTotalFeeKey,
+		prefixAddressBlockFeeCompositeKey,
+		prefixIndexVerifyCursorKey,
+		prefixBlockTimestampKey,
+		prefixTimestampBlockNumCompositeKey,
+		prefixAddressInternIDKey,
+		prefixInternIDAddressKey,
+		prefixBlockAddressIDsKey,
+		prefixIndexExpiryThresholdKey,
+	}
+	layouts := describeKeyLayout()
+	testutil.AssertEquals(t, len(layouts), len(allPrefixes))
+
+	described := make(map[byte]bool)
+	names := make(map[string]bool)
+	for i, layout := range layouts {
+		if i > 0 && layout.Prefix <= layouts[i-1].Prefix {
+			t.Fatalf("Layouts are not ordered by unique prefixes at prefix [%d]", layout.Prefix)
+		}
+		if layout.Name == "" || layout.Key == "" || layout.Value == "" || names[layout.Name] {
+			t.Fatalf("Incomplete or duplicate layout for prefix [%d]: %#v", layout.Prefix, layout)
+		}
+		names[layout.Name] = true
+		described[layout.Prefix] = true
+	}
+	for _, prefix := range allPrefixes {
+		if !described[prefix] {
+			t.Fatalf("Prefix [%d] is not described", prefix)
+		}
+	}
+}
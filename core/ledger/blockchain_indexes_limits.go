@@ -0,0 +1,58 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"time"
+)
+
+// scanLimits bounds the work done by a query that scans a range of index entries. maxResults is mandatory
+// and a zero deadline means no deadline. When a limit is hit, the query stops and returns the results
+// collected so far along with truncated = true. The queries that return their results sorted in chain order
+// sort the partial result, which hence is not necessarily the first maxResults results in chain order
+type scanLimits struct {
+	maxResults int
+	deadline   time.Time
+}
+
+// newScanLimits returns limits with the given maximum number of results and no deadline
+func newScanLimits(maxResults int) scanLimits {
+	return scanLimits{maxResults: maxResults}
+}
+
+// withTimeout returns a copy of the limits with a deadline at the given duration from now
+func (limits scanLimits) withTimeout(timeout time.Duration) scanLimits {
+	limits.deadline = time.Now().Add(timeout)
+	return limits
+}
+
+func (limits scanLimits) validate() error {
+	if limits.maxResults <= 0 {
+		return fmt.Errorf("Invalid scan limits. maxResults [%d] should be positive", limits.maxResults)
+	}
+	return nil
+}
+
+func (limits scanLimits) deadlineExceeded() bool {
+	return !limits.deadline.IsZero() && time.Now().After(limits.deadline)
+}
+
+// reached returns true if a scan that has collected numResults results should stop
+func (limits scanLimits) reached(numResults int) bool {
+	return numResults >= limits.maxResults || limits.deadlineExceeded()
+}
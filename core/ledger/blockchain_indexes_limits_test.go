@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// testScanLimits does not limit the scans of the tests that do not exercise the limits
+var testScanLimits = newScanLimits(math.MaxInt32)
+
+func TestIndexes_ScanLimits(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var txs []*protos.Transaction
+	for i := 0; i < 5; i++ {
+		tx, _ := buildTestTx(t)
+		txs = append(txs, tx)
+	}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(txs, nil), []byte("stateHash1"))
+
+	result, truncated, err := fetchTransactionsBySizeRange(0, math.MaxUint64, newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, len(result), 2)
+
+	result, truncated, err = fetchTransactionsBySizeRange(0, math.MaxUint64, newScanLimits(5))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, len(result), 5)
+
+	// the transactions of the address in a block are in a single entry, which is trimmed to the limit
+	result, truncated, err = fetchTransactionIndexesByAddress("address1", newScanLimits(3))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, result, []*TransactionLocation{{0, 0}, {0, 1}, {0, 2}})
+
+	result, truncated, err = fetchTransactionsBySizeRange(0, math.MaxUint64, newScanLimits(5).withTimeout(-time.Second))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, len(result), 0)
+
+	_, _, err = fetchTransactionsBySizeRange(0, math.MaxUint64, scanLimits{})
+	testutil.AssertError(t, err, "Expected error for scan limits without maxResults")
+}
+
+func TestIndexes_ScanLimitsKeepChainOrder(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	openchainDB := db.GetDBHandle()
+	// the varint encoding of 256 sorts before the one of 129, so the keys iterate out of chain order
+	for _, blockNumber := range []uint64{256, 129} {
+		key := encodeAddressBlockNumCompositeKey("address1", blockNumber)
+		err := openchainDB.Put(indexCFForKey(key), key, encodeIndexValue(encodeListTxIndexes([]uint64{0})))
+		testutil.AssertNoError(t, err, "Error while writing the address entry")
+		key = encodeTxMetadataCompositeKey("key", "value", blockNumber, 0)
+		err = openchainDB.Put(indexCFForKey(key), key, encodeIndexValue(encodeBlockNumTxIndex(blockNumber, 0)))
+		testutil.AssertNoError(t, err, "Error while writing the metadata entry")
+	}
+
+	result, truncated, err := fetchTransactionIndexesByAddress("address1", newScanLimits(1))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, result, []*TransactionLocation{{129, 0}})
+
+	result, truncated, err = fetchTransactionsByMetadata("key", "value", newScanLimits(1))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by metadata")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, result, []*TransactionLocation{{129, 0}})
+}
@@ -0,0 +1,169 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+)
+
+// Implementation for in-memory indexer. The indexes are kept in maps instead of the db
+// and are rebuilt from the blocks in the chain when the indexer is started.
+// This is meant for tests and light deployments where the index does not need to be persisted
+type blockchainIndexerMem struct {
+	lock              sync.RWMutex
+	blockHashToNumber map[string]uint64
+	txUUIDToLocation  map[string]TransactionLocation
+	// the hash and the uuids each block number is indexed with, to drop them when the block number is re-indexed
+	blockNumberToHash map[uint64]string
+	blockNumberToUUID map[uint64][]string
+	// the entries of the block passed to createIndexesSync, applied once the block is persisted
+	pending *memIndexEntries
+}
+
+// memIndexEntries are the in-memory index entries of a block
+type memIndexEntries struct {
+	blockNumber uint64
+	blockHash   string
+	txUUIDs     []string
+}
+
+func newBlockchainIndexerMem() *blockchainIndexerMem {
+	return &blockchainIndexerMem{
+		blockHashToNumber: make(map[string]uint64),
+		txUUIDToLocation:  make(map[string]TransactionLocation),
+		blockNumberToHash: make(map[uint64]string),
+		blockNumberToUUID: make(map[uint64][]string)}
+}
+
+func (indexer *blockchainIndexerMem) isSynchronous() bool {
+	return true
+}
+
+func (indexer *blockchainIndexerMem) start(blockchain *blockchain) error {
+	for blockNumber := uint64(0); blockNumber < blockchain.getSize(); blockNumber++ {
+		block, err := fetchBlockFromDB(blockNumber)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			continue
+		}
+		blockHash, err := computeBlockHash(block)
+		if err != nil {
+			return err
+		}
+		entries, err := newMemIndexEntries(block, blockNumber, blockHash)
+		if err != nil {
+			return err
+		}
+		indexer.lock.Lock()
+		indexer.applyEntries(entries)
+		indexer.lock.Unlock()
+	}
+	indexLogger.Debugf("Started in-memory indexer with [%d] blocks indexed", len(indexer.blockHashToNumber))
+	return nil
+}
+
+// createIndexesSync stages the in-memory entries of the block. The writeBatch is not used, and the entries
+// are applied by indexesPersisted once the writeBatch, which holds the block, is committed
+func (indexer *blockchainIndexerMem) createIndexesSync(
+	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+	entries, err := newMemIndexEntries(block, blockNumber, blockHash)
+	if err != nil {
+		return err
+	}
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+	indexer.pending = entries
+	return nil
+}
+
+// indexesPersisted applies the entries staged by createIndexesSync if the block was persisted, else drops them
+func (indexer *blockchainIndexerMem) indexesPersisted(success bool) {
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+	if indexer.pending == nil {
+		return
+	}
+	if success {
+		indexer.applyEntries(indexer.pending)
+		indexMetrics.blockIndexed(len(indexer.pending.txUUIDs))
+	}
+	indexer.pending = nil
+}
+
+func (indexer *blockchainIndexerMem) createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error {
+	return fmt.Errorf("Method not applicable")
+}
+
+func newMemIndexEntries(block *protos.Block, blockNumber uint64, blockHash []byte) (*memIndexEntries, error) {
+	entries := &memIndexEntries{blockNumber: blockNumber, blockHash: string(blockHash)}
+	for _, tx := range block.GetTransactions() {
+		txUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return nil, err
+		}
+		entries.txUUIDs = append(entries.txUUIDs, txUUID)
+	}
+	return entries, nil
+}
+
+// applyEntries adds the entries of a block to the maps, replacing the ones of the block previously indexed
+// with the same block number, if any. The caller should hold the lock
+func (indexer *blockchainIndexerMem) applyEntries(entries *memIndexEntries) {
+	if replacedHash, ok := indexer.blockNumberToHash[entries.blockNumber]; ok && replacedHash != entries.blockHash {
+		delete(indexer.blockHashToNumber, replacedHash)
+	}
+	for _, txUUID := range indexer.blockNumberToUUID[entries.blockNumber] {
+		if indexer.txUUIDToLocation[txUUID].BlockNumber == entries.blockNumber {
+			delete(indexer.txUUIDToLocation, txUUID)
+		}
+	}
+	indexer.blockHashToNumber[entries.blockHash] = entries.blockNumber
+	indexer.blockNumberToHash[entries.blockNumber] = entries.blockHash
+	for txIndex, txUUID := range entries.txUUIDs {
+		indexer.txUUIDToLocation[txUUID] = TransactionLocation{entries.blockNumber, uint64(txIndex)}
+	}
+	indexer.blockNumberToUUID[entries.blockNumber] = entries.txUUIDs
+}
+
+func (indexer *blockchainIndexerMem) fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error) {
+	indexer.lock.RLock()
+	defer indexer.lock.RUnlock()
+	blockNumber, ok := indexer.blockHashToNumber[string(blockHash)]
+	if !ok {
+		return 0, newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No block indexed with block hash [%x]", blockHash))
+	}
+	return blockNumber, nil
+}
+
+func (indexer *blockchainIndexerMem) fetchTransactionLocationByUUID(txUUID string) (*TransactionLocation, error) {
+	indexer.lock.RLock()
+	defer indexer.lock.RUnlock()
+	txLocation, ok := indexer.txUUIDToLocation[txUUID]
+	if !ok {
+		return nil, ErrResourceNotFound
+	}
+	return &txLocation, nil
+}
+
+func (indexer *blockchainIndexerMem) stop() {
+}
@@ -0,0 +1,148 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+	"golang.org/x/net/context"
+)
+
+func TestIndexesMem_GetBlockByBlockNumber(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+	testIndexesGetBlockByBlockNumber(t)
+}
+
+func TestIndexesMem_GetBlockByBlockHash(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+	testIndexesGetBlockByBlockHash(t)
+}
+
+func TestIndexesMem_GetBlockByBlockHashWrongHash(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+	testIndexesGetBlockByBlockHashWrongHash(t)
+}
+
+func TestIndexesMem_GetTransactionByBlockNumberAndTxIndex(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+	testIndexesGetTransactionByBlockNumberAndTxIndex(t)
+}
+
+func TestIndexesMem_GetTransactionByBlockHashAndTxIndex(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+	testIndexesGetTransactionByBlockHashAndTxIndex(t)
+}
+
+func TestIndexesMem_GetTransactionByUUID(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+	testIndexesGetTransactionByUUID(t)
+}
+
+func TestIndexesMem_UnknownUUID(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	_, err := testBlockchainWrapper.blockchain.getTransactionByUUID("unknown-uuid")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+}
+
+func TestIndexesMem_RebuildOnStart(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	tx1, uuid1 := buildTestTx(t)
+	block1 := protos.NewBlock([]*protos.Transaction{tx1}, nil)
+	testBlockchainWrapper.addNewBlock(block1, []byte("stateHash1"))
+	tx2, uuid2 := buildTestTx(t)
+	block2 := protos.NewBlock([]*protos.Transaction{tx2}, nil)
+	testBlockchainWrapper.addNewBlock(block2, []byte("stateHash2"))
+	testBlockchainWrapper.blockchain.indexer.stop()
+
+	// the indexes of a new instance of the blockchain are rebuilt from the blocks in the db
+	testDBWrapper.CloseDB(t)
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid1), tx1)
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid2), tx2)
+	blockHash, _ := block2.GetHash()
+	testutil.AssertEquals(t, testBlockchainWrapper.getBlockByHash(blockHash), block2)
+}
+
+func TestIndexesMem_AppliedOnlyOncePersisted(t *testing.T) {
+	defaultSetting := indexBlockDataInMemory
+	indexBlockDataInMemory = true
+	defer func() { indexBlockDataInMemory = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	chain := testBlockchainWrapper.blockchain
+
+	// the entries of a block that fails to persist are dropped
+	tx1, uuid1 := buildTestTx(t)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	_, err := chain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding the persistence changes of the block")
+	chain.blockPersistenceStatus(false)
+	_, err = chain.indexer.fetchTransactionLocationByUUID(uuid1)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	// re-indexing a block number replaces the hash and the uuids of the previous block
+	block1 := protos.NewBlock([]*protos.Transaction{tx1}, nil)
+	testutil.AssertNoError(t, chain.persistRawBlock(block1, 0), "Error while persisting the block")
+	blockHash1, _ := block1.GetHash()
+	tx2, uuid2 := buildTestTx(t)
+	block2 := protos.NewBlock([]*protos.Transaction{tx2}, nil)
+	testutil.AssertNoError(t, chain.persistRawBlock(block2, 0), "Error while persisting the replacing block")
+	blockHash2, _ := block2.GetHash()
+
+	_, err = chain.indexer.fetchBlockNumberByBlockHash(blockHash1)
+	testutil.AssertError(t, err, "Expected an error for the hash of the replaced block")
+	_, err = chain.indexer.fetchTransactionLocationByUUID(uuid1)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	blockNumber, err := chain.indexer.fetchBlockNumberByBlockHash(blockHash2)
+	testutil.AssertNoError(t, err, "Error while fetching the replacing block by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+	txLocation, err := chain.indexer.fetchTransactionLocationByUUID(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching the transaction of the replacing block")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{0, 0})
+}
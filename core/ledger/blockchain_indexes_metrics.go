@@ -0,0 +1,128 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// indexTrackBuildTime, when true, makes addIndexDataForPersistence measure how long it takes to index each block
+// and fold it into a rolling average (see getAverageIndexTimePerBlock), e.g., to notice the indexing slowing down
+// as the blocks grow. The measurement costs two reads of the clock per block
+var indexTrackBuildTime = false
+
+// indexBuildTimeWeight is the inverse of the weight of the latest block in the rolling average of the build time,
+// i.e., the average moves by 1/indexBuildTimeWeight of the difference between the latest time and the average
+const indexBuildTimeWeight = 8
+
+// indexMetricsCounters are the counters maintained by the indexer. The fields are updated atomically
+type indexMetricsCounters struct {
+	indexedBlocks uint64
+	indexedTxs    uint64
+	lookupHits    uint64
+	lookupMisses  uint64
+	// avgBuildTime is the rolling average of the build time of a block in nanoseconds, zero if none measured
+	avgBuildTime uint64
+}
+
+var indexMetrics indexMetricsCounters
+
+func (counters *indexMetricsCounters) blockIndexed(numTxs int) {
+	atomic.AddUint64(&counters.indexedBlocks, 1)
+	atomic.AddUint64(&counters.indexedTxs, uint64(numTxs))
+}
+
+// blockBuildTimed folds the time taken to index a block into the rolling average of the build time
+func (counters *indexMetricsCounters) blockBuildTimed(elapsed time.Duration) {
+	buildTime := int64(elapsed)
+	if buildTime <= 0 {
+		// keep a measured average distinguishable from none being measured
+		buildTime = 1
+	}
+	for {
+		current := atomic.LoadUint64(&counters.avgBuildTime)
+		average := buildTime
+		if current > 0 {
+			average = int64(current) + (buildTime-int64(current))/indexBuildTimeWeight
+		}
+		if average <= 0 {
+			average = 1
+		}
+		if atomic.CompareAndSwapUint64(&counters.avgBuildTime, current, uint64(average)) {
+			return
+		}
+	}
+}
+
+// getAverageIndexTimePerBlock returns the rolling average of the time taken by addIndexDataForPersistence
+// to index a block, or zero if indexTrackBuildTime is not set or no block has been indexed since it was set
+func getAverageIndexTimePerBlock() time.Duration {
+	return time.Duration(atomic.LoadUint64(&indexMetrics.avgBuildTime))
+}
+
+// lookupDone counts a lookup of a block by hash or of a transaction by uuid as per the error returned by the lookup.
+// Errors other than the block or the transaction not being indexed are not counted
+func (counters *indexMetricsCounters) lookupDone(err error) {
+	if err == nil {
+		atomic.AddUint64(&counters.lookupHits, 1)
+		return
+	}
+	if ledgerError, ok := err.(*Error); ok &&
+		(ledgerError.Type() == ErrorTypeResourceNotFound || ledgerError.Type() == ErrorTypeBlockNotFound) {
+		atomic.AddUint64(&counters.lookupMisses, 1)
+	}
+}
+
+// WriteIndexMetrics writes the metrics of the indexer to the writer in the Prometheus text exposition format
+func (ledger *Ledger) WriteIndexMetrics(w io.Writer) error {
+	return writeIndexMetrics(w, ledger.blockchain)
+}
+
+func writeIndexMetrics(w io.Writer, blockchain *blockchain) error {
+	indexLag, err := blockchain.indexLag()
+	if err != nil {
+		return err
+	}
+	metrics := []struct {
+		name       string
+		metricType string
+		help       string
+		value      uint64
+	}{
+		{"fabric_ledger_indexed_blocks_total", "counter", "Number of blocks indexed.",
+			atomic.LoadUint64(&indexMetrics.indexedBlocks)},
+		{"fabric_ledger_indexed_transactions_total", "counter", "Number of transactions indexed.",
+			atomic.LoadUint64(&indexMetrics.indexedTxs)},
+		{"fabric_ledger_index_lookup_hits_total", "counter", "Number of block hash and transaction uuid lookups that found an entry.",
+			atomic.LoadUint64(&indexMetrics.lookupHits)},
+		{"fabric_ledger_index_lookup_misses_total", "counter", "Number of block hash and transaction uuid lookups that found no entry.",
+			atomic.LoadUint64(&indexMetrics.lookupMisses)},
+		{"fabric_ledger_index_lag_blocks", "gauge", "Number of committed blocks not indexed yet.", indexLag},
+	}
+	bufWriter := bufio.NewWriter(w)
+	for _, metric := range metrics {
+		if _, err := fmt.Fprintf(bufWriter, "# HELP %s %s\n# TYPE %s %s\n%s %d\n",
+			metric.name, metric.help, metric.name, metric.metricType, metric.name, metric.value); err != nil {
+			return err
+		}
+	}
+	return bufWriter.Flush()
+}
@@ -0,0 +1,127 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+var testMetricLineRegexp = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*) ([0-9]+)$`)
+var testMetricCommentRegexp = regexp.MustCompile(`^# (HELP [a-zA-Z_:][a-zA-Z0-9_:]* .+|TYPE [a-zA-Z_:][a-zA-Z0-9_:]* (counter|gauge))$`)
+
+// parseTestMetrics returns the values of the metrics in the output of writeIndexMetrics and fails the test on an invalid line
+func parseTestMetrics(t *testing.T, output string) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			testutil.AssertEquals(t, testMetricCommentRegexp.MatchString(line), true)
+			continue
+		}
+		match := testMetricLineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("Invalid metric line [%s]", line)
+		}
+		value, err := strconv.ParseUint(match[2], 10, 64)
+		testutil.AssertNoError(t, err, "Error parsing metric value")
+		values[match[1]] = value
+	}
+	return values
+}
+
+func TestIndexes_WriteIndexMetrics(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var buf bytes.Buffer
+	testutil.AssertNoError(t, writeIndexMetrics(&buf, testBlockchainWrapper.blockchain), "Error writing metrics")
+	before := parseTestMetrics(t, buf.String())
+	for _, name := range []string{"fabric_ledger_indexed_blocks_total", "fabric_ledger_indexed_transactions_total",
+		"fabric_ledger_index_lookup_hits_total", "fabric_ledger_index_lookup_misses_total", "fabric_ledger_index_lag_blocks"} {
+		_, ok := before[name]
+		testutil.AssertEquals(t, ok, true)
+	}
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash0"))
+	_, err := testBlockchainWrapper.blockchain.getTransactionByUUID(uuid1)
+	testutil.AssertNoError(t, err, "Error fetching transaction")
+	_, err = testBlockchainWrapper.blockchain.getTransactionByUUID("unknownUUID")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	_, err = testBlockchainWrapper.blockchain.getBlockByHash([]byte("unknownHash"))
+	testutil.AssertError(t, err, "Expected an error for an unknown block hash")
+
+	buf.Reset()
+	testutil.AssertNoError(t, writeIndexMetrics(&buf, testBlockchainWrapper.blockchain), "Error writing metrics")
+	after := parseTestMetrics(t, buf.String())
+	testutil.AssertEquals(t, after["fabric_ledger_indexed_blocks_total"]-before["fabric_ledger_indexed_blocks_total"], uint64(1))
+	testutil.AssertEquals(t, after["fabric_ledger_indexed_transactions_total"]-before["fabric_ledger_indexed_transactions_total"], uint64(2))
+	testutil.AssertEquals(t, after["fabric_ledger_index_lookup_hits_total"]-before["fabric_ledger_index_lookup_hits_total"], uint64(1))
+	testutil.AssertEquals(t, after["fabric_ledger_index_lookup_misses_total"]-before["fabric_ledger_index_lookup_misses_total"], uint64(2))
+	testutil.AssertEquals(t, after["fabric_ledger_index_lag_blocks"], uint64(0))
+}
+
+func TestIndexes_AverageIndexTimePerBlock(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultTrackBuildTime := indexTrackBuildTime
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexTrackBuildTime = defaultTrackBuildTime
+		atomic.StoreUint64(&indexMetrics.avgBuildTime, 0)
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// nothing is measured unless indexTrackBuildTime is set
+	indexTrackBuildTime = false
+	atomic.StoreUint64(&indexMetrics.avgBuildTime, 0)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(nil, nil), []byte("stateHash0"))
+	testutil.AssertEquals(t, getAverageIndexTimePerBlock(), time.Duration(0))
+
+	indexTrackBuildTime = true
+	for i := 1; i <= 5; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+		testutil.AssertEquals(t, getAverageIndexTimePerBlock() > 0, true)
+	}
+
+	// the average moves towards the latest build time
+	atomic.StoreUint64(&indexMetrics.avgBuildTime, uint64(80*time.Millisecond))
+	indexMetrics.blockBuildTimed(16 * time.Millisecond)
+	testutil.AssertEquals(t, getAverageIndexTimePerBlock(), 72*time.Millisecond)
+	// a build time of zero counts as 1ns
+	indexMetrics.blockBuildTimed(0)
+	testutil.AssertEquals(t, getAverageIndexTimePerBlock(), 63*time.Millisecond+1)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/db"
+)
+
+// indexTxUUIDPartitions is the number of partitions that the txUUID index is spread across. With more than one
+// partition, the txUUID keys carry a partition byte (a hash of the txUUID) after the key type prefix, so that
+// the keys of very large indexes are split into ranges that are compacted and scanned independently
+// (see fetchIndexedTxUUIDs). The value is read when the keys are encoded; values below 1 mean a single partition,
+// which keeps the keys compatible with the ones written before partitioning was introduced, and values above
+// 256 mean 256 partitions. The setting should be made before the blockchain is constructed and should not be
+// changed for an existing db, as the keys written earlier are not moved to their partition
+var indexTxUUIDPartitions = 1
+
+func txUUIDPartitionCount() int {
+	switch {
+	case indexTxUUIDPartitions < 1:
+		return 1
+	case indexTxUUIDPartitions > 256:
+		return 256
+	}
+	return indexTxUUIDPartitions
+}
+
+// txUUIDPartition returns the partition of the txUUID index that holds the key of the given txUUID
+func txUUIDPartition(txUUID string) byte {
+	h := fnv.New32a()
+	h.Write([]byte(txUUID))
+	return byte(h.Sum32() % uint32(txUUIDPartitionCount()))
+}
+
+// encodeTxUUIDPartitionKeyPrefix returns the prefix shared by the txUUID keys of the given partition.
+// With a single partition, this is the prefix of the whole txUUID index
+func encodeTxUUIDPartitionKeyPrefix(partition byte) []byte {
+	prefix := newIndexKey(prefixTxUUIDKey)
+	if txUUIDPartitionCount() > 1 {
+		prefix = append(prefix, partition)
+	}
+	return prefix
+}
+
+// fetchIndexedTxUUIDs returns the uuids of the indexed transactions in ascending order. The partitions of the
+// txUUID index are scanned with up to indexQueryConcurrency scans in parallel and their uuids are merged
+func fetchIndexedTxUUIDs(limits scanLimits) ([]string, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	numPartitions := txUUIDPartitionCount()
+	partitionUUIDs := make([][]string, numPartitions)
+	partitionTruncated := make([]bool, numPartitions)
+	partitionErrs := make([]error, numPartitions)
+
+	workers := indexQueryConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+	for partition := 0; partition < numPartitions; partition++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(partition int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			partitionUUIDs[partition], partitionTruncated[partition], partitionErrs[partition] =
+				scanTxUUIDPartition(byte(partition), limits)
+		}(partition)
+	}
+	wg.Wait()
+
+	// each partition holds its smallest uuids, hence the smallest maxResults of the merged uuids are complete
+	var result []string
+	truncated := false
+	for partition := 0; partition < numPartitions; partition++ {
+		if partitionErrs[partition] != nil {
+			return nil, false, partitionErrs[partition]
+		}
+		result = append(result, partitionUUIDs[partition]...)
+		truncated = truncated || partitionTruncated[partition]
+	}
+	sort.Strings(result)
+	if len(result) > limits.maxResults {
+		result = result[:limits.maxResults]
+		truncated = true
+	}
+	return result, truncated, nil
+}
+
+// scanTxUUIDPartition returns the uuids of the given partition of the txUUID index in ascending order
+func scanTxUUIDPartition(partition byte, limits scanLimits) ([]string, bool, error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []string
+	prefix := encodeTxUUIDPartitionKeyPrefix(partition)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		result = append(result, string(itr.Key().Data()[len(prefix):]))
+	}
+	return result, false, nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_TxUUIDPartitions(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultPartitions := indexTxUUIDPartitions
+	defaultConcurrency := indexQueryConcurrency
+	indexBlockDataSynchronously = true
+	indexQueryConcurrency = 3
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexTxUUIDPartitions = defaultPartitions
+		indexQueryConcurrency = defaultConcurrency
+	}()
+
+	for _, partitions := range []int{1, 4, 16} {
+		indexTxUUIDPartitions = partitions
+		testDBWrapper.CleanDB(t)
+		testBlockchainWrapper := newTestBlockchainWrapper(t)
+		var uuids []string
+		for i := 0; i < 6; i++ {
+			tx1, uuid1 := buildTestTx(t)
+			tx2, uuid2 := buildTestTx(t)
+			testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+			uuids = append(uuids, uuid1, uuid2)
+		}
+
+		for i, uuid := range uuids {
+			txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid)
+			testutil.AssertNoError(t, err, fmt.Sprintf("Error while fetching a transaction with [%d] partitions", partitions))
+			testutil.AssertEquals(t, txLocation, &TransactionLocation{uint64(i / 2), uint64(i % 2)})
+		}
+		_, err := fetchTransactionLocationByUUIDFromDB("unknownUUID")
+		testutil.AssertEquals(t, err, ErrResourceNotFound)
+
+		locations, err := fetchTransactionLocationsByUUIDs([]string{uuids[7], uuids[2], "unknownUUID"})
+		testutil.AssertNoError(t, err, "Error while fetching transaction locations")
+		testutil.AssertEquals(t, locations.BlockNumbers, []uint64{1, 3})
+		testutil.AssertEquals(t, locations.NotFound, []string{"unknownUUID"})
+
+		sortedUUIDs := append([]string(nil), uuids...)
+		sort.Strings(sortedUUIDs)
+		indexedUUIDs, truncated, err := fetchIndexedTxUUIDs(testScanLimits)
+		testutil.AssertNoError(t, err, "Error while scanning the txUUID index")
+		testutil.AssertEquals(t, truncated, false)
+		testutil.AssertEquals(t, indexedUUIDs, sortedUUIDs)
+		indexedUUIDs, truncated, err = fetchIndexedTxUUIDs(newScanLimits(5))
+		testutil.AssertNoError(t, err, "Error while scanning the txUUID index")
+		testutil.AssertEquals(t, truncated, true)
+		testutil.AssertEquals(t, indexedUUIDs, sortedUUIDs[:5])
+
+		readable, err := decodeIndexKey(encodeTxUUIDKey(uuids[0]))
+		testutil.AssertNoError(t, err, "Error while decoding a txUUID key")
+		if partitions == 1 {
+			testutil.AssertEquals(t, encodeTxUUIDKey(uuids[0]), append([]byte{prefixTxUUIDKey}, uuids[0]...))
+			testutil.AssertEquals(t, readable, fmt.Sprintf("txUUID txUUID=%q", uuids[0]))
+		} else {
+			partition := txUUIDPartition(uuids[0])
+			testutil.AssertEquals(t, int(partition) < partitions, true)
+			testutil.AssertEquals(t, encodeTxUUIDKey(uuids[0]), append([]byte{prefixTxUUIDKey, partition}, uuids[0]...))
+			testutil.AssertEquals(t, readable, fmt.Sprintf("txUUID partition=%d txUUID=%q", partition, uuids[0]))
+		}
+		testBlockchainWrapper.blockchain.indexer.stop()
+	}
+}
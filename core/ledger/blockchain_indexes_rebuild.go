@@ -0,0 +1,291 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexRebuildChunkBlocks is the number of blocks whose rebuilt entries are committed in one WriteBatch, and the
+// number of entries deleted in one WriteBatch when the existing entries are cleared.
+// Smaller chunks bound the memory used by a rebuild at the cost of more commits
+var indexRebuildChunkBlocks = uint64(100)
+
+// indexAddressRebuildLock keeps the address queries out of a rebuild that deletes the address entries before
+// writing them again (see rebuildAddressIndex), so that the queries wait for the rebuilt entries rather than
+// see an empty or partial address index. The queries hold the read lock and the rebuild holds the write lock
+var indexAddressRebuildLock sync.RWMutex
+
+// indexWriteLock keeps the writes of index entries out of the swap of the address column family. The writers hold
+// the read lock from the moment the column family of their entries is chosen (see indexCFForKey) until their batch
+// is committed, and rebuildAddressIndexAndSwap holds the write lock across its final catch-up and the swap, so that no
+// entry is committed to the column family that is swapped out after the rebuild has read the blocks.
+// The lock is always released by the call that takes it. The synchronous indexing, whose batch is committed by the
+// caller later on, holds it only while adding the entries, and adds the address entries of the block again if the
+// column family was swapped before the batch was committed (see addAddressIndexesAfterSwap)
+var indexWriteLock sync.RWMutex
+
+// rebuildAddressIndex regenerates the entries that record the transactions executed by each address
+// ((address,blockNumber), (blockNumber,address) or blockNumber -> address ids, and address -> latest block) from the blocks, for use when only
+// these entries are corrupted. The existing entries are deleted first and the other indexes are not rewritten.
+// The blocks from the prune point up to the highest indexed block are read; the executing addresses are taken
+// from the blocks rather than from the txUUID index, as a uuid indexed again by a later block only points to
+// that block. The entries are committed in chunks of indexRebuildChunkBlocks blocks, and an interrupted rebuild
+// can simply be run again. It returns the number of blocks processed.
+// If indexSplitAddressCF is set (and indexAddressLatestBlockOnly is not), the entries are instead built in the
+// standby address column family while the active one keeps serving the queries, and the standby one is swapped
+// in once complete (see rebuildAddressIndexAndSwap). Otherwise the address queries wait for the rebuild to complete
+func rebuildAddressIndex() (uint64, error) {
+	if indexRebuildChunkBlocks == 0 {
+		return 0, fmt.Errorf("Rebuild chunk size should be greater than zero")
+	}
+	indexMaintenanceLock.Lock()
+	defer indexMaintenanceLock.Unlock()
+	if indexSplitAddressCF && !indexAddressLatestBlockOnly {
+		return rebuildAddressIndexAndSwap()
+	}
+	indexAddressRebuildLock.Lock()
+	defer indexAddressRebuildLock.Unlock()
+	if err := deleteAddressIndexEntries(); err != nil {
+		return 0, err
+	}
+	highestBlockNumber, found, err := fetchHighestIndexedBlockNumber()
+	if err != nil || !found {
+		return 0, err
+	}
+	prunedBelow, _, err := pruneStatus()
+	if err != nil {
+		return 0, err
+	}
+	numBlocks, err := addAddressIndexesInChunks(prunedBelow, highestBlockNumber, indexCFForKey)
+	if err != nil {
+		return numBlocks, err
+	}
+	indexLogger.Debugf("Rebuilt the address index from [%d] blocks", numBlocks)
+	return numBlocks, nil
+}
+
+// rebuildAddressIndexAndSwap builds the split address entries in the standby address column family and then
+// makes it the active one, so that the queries are served by the old entries until the new ones are complete.
+// The blocks indexed during the rebuild add their entries to the active column family, so the rebuild catches
+// up with the highest indexed block before the swap; the last catch-up is done under indexWriteLock, which holds
+// off the indexing until the swap is done. The old column family is cleared after the swap, along
+// with any address -> latest block entries left from indexAddressLatestBlockOnly
+func rebuildAddressIndexAndSwap() (uint64, error) {
+	alternate := !isAlternateAddressCFActive()
+	standbyCF := addressColumnFamily(alternate)
+	// entries left by an interrupted rebuild
+	if err := clearColumnFamily(standbyCF); err != nil {
+		return 0, err
+	}
+	prunedBelow, _, err := pruneStatus()
+	if err != nil {
+		return 0, err
+	}
+	cfForKey := func(key []byte) *gorocksdb.ColumnFamilyHandle {
+		if len(key) >= indexKeyHeaderLength() && isAddressIndexPrefix(key[indexKeyHeaderLength()-1]) {
+			return standbyCF
+		}
+		return indexCFForKey(key)
+	}
+
+	var numBlocks uint64
+	nextBlock := prunedBelow
+	// catchUp adds the entries of the blocks indexed since the last call and returns false if there were none
+	catchUp := func() (bool, error) {
+		highestBlockNumber, found, err := fetchHighestIndexedBlockNumber()
+		if err != nil {
+			return false, err
+		}
+		if !found || highestBlockNumber < nextBlock {
+			return false, nil
+		}
+		chunkBlocks, err := addAddressIndexesInChunks(nextBlock, highestBlockNumber, cfForKey)
+		numBlocks += chunkBlocks
+		if err != nil {
+			return false, err
+		}
+		nextBlock = highestBlockNumber + 1
+		return true, nil
+	}
+	for {
+		added, err := catchUp()
+		if err != nil {
+			return numBlocks, err
+		}
+		if !added {
+			break
+		}
+	}
+	err = func() error {
+		indexWriteLock.Lock()
+		defer indexWriteLock.Unlock()
+		if _, err := catchUp(); err != nil {
+			return err
+		}
+		return setActiveAddressCF(alternate)
+	}()
+	if err != nil {
+		return numBlocks, err
+	}
+	if err := clearColumnFamily(addressColumnFamily(!alternate)); err != nil {
+		// the entries are cleared again before the next rebuild uses the column family
+		indexLogger.Warningf("Error clearing the previous address column family after the swap: %s", err)
+	}
+	if err := deleteIndexEntries(prefixAddressLatestBlockKey); err != nil {
+		return numBlocks, err
+	}
+	indexLogger.Debugf("Rebuilt the address index from [%d] blocks and swapped it in", numBlocks)
+	return numBlocks, nil
+}
+
+// addAddressIndexesAfterSwap commits the address entries of a committed block to the active address column family.
+// It is used for a block whose entries were committed to the column family that has been swapped out since they
+// were added. The entries are written again as they are, so a block whose entries were also added by the catch-up
+// of the rebuild is not affected
+func addAddressIndexesAfterSwap(blockNumber uint64) error {
+	indexWriteLock.RLock()
+	defer indexWriteLock.RUnlock()
+	_, err := addAddressIndexesInChunks(blockNumber, blockNumber, indexCFForKey)
+	return err
+}
+
+// addAddressIndexesInChunks commits the address entries of the blocks [startBlock, endBlock] in chunks of
+// indexRebuildChunkBlocks blocks, writing each entry to the column family returned by cfForKey.
+// It returns the number of blocks found
+func addAddressIndexesInChunks(startBlock uint64, endBlock uint64,
+	cfForKey func(key []byte) *gorocksdb.ColumnFamilyHandle) (uint64, error) {
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	var numBlocks uint64
+	for chunkStart := startBlock; chunkStart <= endBlock; chunkStart += indexRebuildChunkBlocks {
+		chunkEnd := chunkStart + indexRebuildChunkBlocks - 1
+		if chunkEnd > endBlock || chunkEnd < chunkStart {
+			chunkEnd = endBlock
+		}
+		writeBatch := gorocksdb.NewWriteBatch()
+		chunkBlocks, err := addAddressIndexesForBlocks(chunkStart, chunkEnd, writeBatch, cfForKey)
+		if err == nil {
+			err = openchainDB.DB.Write(opt, writeBatch)
+		}
+		writeBatch.Destroy()
+		if err != nil {
+			return numBlocks, err
+		}
+		numBlocks += chunkBlocks
+		if chunkEnd == endBlock {
+			break
+		}
+	}
+	return numBlocks, nil
+}
+
+// addAddressIndexesForBlocks adds to the writeBatch the address entries of the blocks [startBlock, endBlock]
+// in the column families returned by cfForKey and returns the number of blocks found
+func addAddressIndexesForBlocks(startBlock uint64, endBlock uint64, writeBatch *gorocksdb.WriteBatch,
+	cfForKey func(key []byte) *gorocksdb.ColumnFamilyHandle) (uint64, error) {
+	putIndex := func(key []byte, value []byte) {
+		writeBatch.PutCF(cfForKey(key), key, value)
+	}
+	var numBlocks uint64
+	batchIDs := make(batchInternIDs)
+	for blockNumber := startBlock; blockNumber <= endBlock; blockNumber++ {
+		block, err := fetchBlockFromDB(blockNumber)
+		if err != nil {
+			return numBlocks, err
+		}
+		if block == nil {
+			continue
+		}
+		addressToTxIndexesMap := make(map[string][]uint64)
+		for txIndex, tx := range block.GetTransactions() {
+			for _, txExecutingAddress := range getTxExecutingAddresses(tx) {
+				addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
+			}
+		}
+		blockAddresses := make([]string, 0, len(addressToTxIndexesMap))
+		for address, txIndexes := range addressToTxIndexesMap {
+			if err := putAddressIndexes(address, blockNumber, txIndexes, putIndex); err != nil {
+				return numBlocks, err
+			}
+			blockAddresses = append(blockAddresses, address)
+		}
+		if err := putBlockAddressIDs(blockNumber, blockAddresses, batchIDs, putIndex); err != nil {
+			return numBlocks, err
+		}
+		numBlocks++
+	}
+	return numBlocks, nil
+}
+
+// deleteAddressIndexEntries deletes all the (address,blockNumber), their continuations, (blockNumber,address),
+// blockNumber -> address ids and address -> latest block entries. The address interning entries are kept
+func deleteAddressIndexEntries() error {
+	return deleteIndexEntries(prefixAddressBlockNumCompositeKey, prefixAddressTxIndexesContinuationKey,
+		prefixBlockNumAddressCompositeKey, prefixBlockAddressIDsKey, prefixAddressLatestBlockKey)
+}
+
+// deleteIndexEntries deletes all the index entries with the given prefixes
+func deleteIndexEntries(prefixes ...byte) error {
+	for _, prefixByte := range prefixes {
+		if err := deleteKeysInChunks(indexCFForPrefix(prefixByte), newIndexKey(prefixByte)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearColumnFamily deletes all the entries of the given column family
+func clearColumnFamily(cf *gorocksdb.ColumnFamilyHandle) error {
+	return deleteKeysInChunks(cf, nil)
+}
+
+// deleteKeysInChunks deletes the keys of the column family that start with the prefix, committing the deletes
+// in chunks of indexRebuildChunkBlocks keys so that the WriteBatch does not grow with the number of keys.
+// A failure leaves the chunks already committed deleted
+func deleteKeysInChunks(cf *gorocksdb.ColumnFamilyHandle, prefix []byte) error {
+	if indexRebuildChunkBlocks == 0 {
+		return fmt.Errorf("Rebuild chunk size should be greater than zero")
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	itr := openchainDB.GetIterator(cf)
+	defer itr.Close()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer func() { writeBatch.Destroy() }()
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		writeBatch.DeleteCF(cf, statemgmt.Copy(itr.Key().Data()))
+		if uint64(writeBatch.Count()) == indexRebuildChunkBlocks {
+			if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+				return err
+			}
+			writeBatch.Destroy()
+			writeBatch = gorocksdb.NewWriteBatch()
+		}
+	}
+	if err := itr.Err(); err != nil {
+		return err
+	}
+	return openchainDB.DB.Write(opt, writeBatch)
+}
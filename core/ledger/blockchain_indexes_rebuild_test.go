@@ -0,0 +1,330 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+	"golang.org/x/net/context"
+)
+
+func TestIndexes_RebuildAddressIndex(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getTxExecutingAddresses
+	executingAddresses := make(map[string]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 3; i++ {
+		var transactions []*protos.Transaction
+		for j := 0; j < 3; j++ {
+			tx, uuid := buildTestTx(t)
+			executingAddresses[uuid] = fmt.Sprintf("address%d", (i+j)%2)
+			transactions = append(transactions, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	addressEntryPrefixes := map[byte]bool{prefixAddressBlockNumCompositeKey: true, prefixBlockNumAddressCompositeKey: true}
+	otherEntries := func() map[string]string {
+		entries := make(map[string]string)
+		itr := db.GetDBHandle().GetIndexesCFIterator()
+		defer itr.Close()
+		for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+			key := itr.Key().Data()
+			if !addressEntryPrefixes[key[indexKeyHeaderLength()-1]] {
+				entries[string(key)] = string(itr.Value().Data())
+			}
+		}
+		return entries
+	}
+	fetchAll := func() ([]*TransactionLocation, []*TransactionLocation, []string) {
+		txLocations0, _, err := fetchTransactionIndexesByAddress("address0", testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+		txLocations1, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+		addresses, _, err := fetchAddressesInBlock(1, testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+		return txLocations0, txLocations1, addresses
+	}
+	txLocations0, txLocations1, addresses := fetchAll()
+	testutil.AssertEquals(t, len(txLocations0)+len(txLocations1), 9)
+	entriesBefore := otherEntries()
+
+	testutil.AssertNoError(t, deleteAddressIndexEntries(), "Error while clearing the address entries")
+	clearedTxLocations0, clearedTxLocations1, clearedAddresses := fetchAll()
+	testutil.AssertEquals(t, len(clearedTxLocations0)+len(clearedTxLocations1)+len(clearedAddresses), 0)
+
+	numBlocks, err := rebuildAddressIndex()
+	testutil.AssertNoError(t, err, "Error while rebuilding the address index")
+	testutil.AssertEquals(t, numBlocks, uint64(3))
+	rebuiltTxLocations0, rebuiltTxLocations1, rebuiltAddresses := fetchAll()
+	testutil.AssertEquals(t, rebuiltTxLocations0, txLocations0)
+	testutil.AssertEquals(t, rebuiltTxLocations1, txLocations1)
+	testutil.AssertEquals(t, rebuiltAddresses, addresses)
+	testutil.AssertEquals(t, otherEntries(), entriesBefore)
+}
+
+func TestIndexes_RebuildAddressIndexChunkSize(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultChunkBlocks := indexRebuildChunkBlocks
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexRebuildChunkBlocks = defaultChunkBlocks
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 5; i++ {
+		tx1, _ := buildTestTx(t)
+		tx2, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	allEntries := func() map[string]string {
+		entries := make(map[string]string)
+		itr := db.GetDBHandle().GetIndexesCFIterator()
+		defer itr.Close()
+		for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+			entries[string(itr.Key().Data())] = string(itr.Value().Data())
+		}
+		return entries
+	}
+	indexedEntries := allEntries()
+
+	for _, chunkBlocks := range []uint64{1, 2, 100} {
+		indexRebuildChunkBlocks = chunkBlocks
+		testutil.AssertNoError(t, deleteAddressIndexEntries(), "Error while clearing the address entries")
+		numBlocks, err := rebuildAddressIndex()
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error while rebuilding the address index with chunk size [%d]", chunkBlocks))
+		testutil.AssertEquals(t, numBlocks, uint64(5))
+		testutil.AssertEquals(t, allEntries(), indexedEntries)
+	}
+
+	indexRebuildChunkBlocks = 0
+	_, err := rebuildAddressIndex()
+	testutil.AssertError(t, err, "Expected an error for a zero chunk size")
+}
+
+func TestIndexes_RebuildAddressIndexQueriesWait(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultChunkBlocks := indexRebuildChunkBlocks
+	indexBlockDataSynchronously = true
+	indexRebuildChunkBlocks = 1
+	defaultExtractor := getTxExecutingAddresses
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexRebuildChunkBlocks = defaultChunkBlocks
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 3; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	address := getTxExecutingAddresses(nil)[0]
+
+	// a query started once the entries are deleted waits for the rebuilt entries
+	queried := make(chan int, 1)
+	started := false
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		if !started {
+			started = true
+			go func() {
+				txLocations, _, err := fetchTransactionIndexesByAddress(address, testScanLimits)
+				testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+				queried <- len(txLocations)
+			}()
+			time.Sleep(50 * time.Millisecond)
+		}
+		return defaultExtractor(tx)
+	}
+	numBlocks, err := rebuildAddressIndex()
+	testutil.AssertNoError(t, err, "Error while rebuilding the address index")
+	testutil.AssertEquals(t, numBlocks, uint64(3))
+	testutil.AssertEquals(t, <-queried, 3)
+}
+
+func TestIndexes_RebuildAddressIndexSwap(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultSplit := indexSplitAddressCF
+	defaultChunkBlocks := indexRebuildChunkBlocks
+	indexBlockDataSynchronously = true
+	indexSplitAddressCF = true
+	indexRebuildChunkBlocks = 1
+	defaultExtractor := getTxExecutingAddresses
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{"oldAddress"}
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexSplitAddressCF = defaultSplit
+		indexRebuildChunkBlocks = defaultChunkBlocks
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var uuids []string
+	for i := 0; i < 3; i++ {
+		tx, uuid := buildTestTx(t)
+		uuids = append(uuids, uuid)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	countByAddress := func(address string) int {
+		txLocations, _, err := fetchTransactionIndexesByAddress(address, testScanLimits)
+		testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+		return len(txLocations)
+	}
+	testutil.AssertEquals(t, countByAddress("oldAddress"), 3)
+
+	// the rebuild maps the transactions to a new address. While it runs, the queries are served by the old
+	// entries, and a block added during the rebuild is caught up with before the swap
+	addingBlock := false
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		if !addingBlock {
+			testutil.AssertEquals(t, countByAddress("oldAddress"), 3)
+			if tx.Uuid == uuids[1] {
+				addingBlock = true
+				newTx, _ := buildTestTx(t)
+				testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{newTx}, nil), []byte("stateHash3"))
+				addingBlock = false
+			}
+		}
+		return []string{"newAddress"}
+	}
+	numBlocks, err := rebuildAddressIndex()
+	testutil.AssertNoError(t, err, "Error while rebuilding the address index")
+	testutil.AssertEquals(t, numBlocks, uint64(4))
+	testutil.AssertEquals(t, isAlternateAddressCFActive(), true)
+	testutil.AssertEquals(t, countByAddress("oldAddress"), 0)
+	testutil.AssertEquals(t, countByAddress("newAddress"), 4)
+
+	// the previous column family is cleared
+	itr := db.GetDBHandle().GetAddressIndexesCFIterator()
+	itr.SeekToFirst()
+	testutil.AssertEquals(t, itr.Valid(), false)
+	itr.Close()
+
+	// the active column family is read again once the db is reopened
+	testDBWrapper.CloseDB(t)
+	testutil.AssertEquals(t, isAlternateAddressCFActive(), true)
+	testutil.AssertEquals(t, countByAddress("newAddress"), 4)
+}
+
+func TestIndexes_RebuildAddressIndexSwapPendingBatch(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultSplit := indexSplitAddressCF
+	indexBlockDataSynchronously = true
+	indexSplitAddressCF = true
+	defaultExtractor := getTxExecutingAddresses
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{"address1"}
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexSplitAddressCF = defaultSplit
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	for i := 0; i < 2; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	// the entries of a block are built before the rebuild starts and committed while it runs
+	tx, _ := buildTestTx(t)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	_, err := testBlockchainWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash2"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding a block")
+	rebuilt := make(chan error)
+	go func() {
+		_, err := rebuildAddressIndex()
+		rebuilt <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	testDBWrapper.WriteToDB(t, writeBatch)
+	testBlockchainWrapper.blockchain.blockPersistenceStatus(true)
+	testutil.AssertNoError(t, <-rebuilt, "Error while rebuilding the address index")
+
+	testutil.AssertEquals(t, isAlternateAddressCFActive(), true)
+	txLocations, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txLocations), 3)
+}
+
+func TestIndexes_RebuildAddressIndexSwapAbandonedBatch(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultSplit := indexSplitAddressCF
+	indexBlockDataSynchronously = true
+	indexSplitAddressCF = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexSplitAddressCF = defaultSplit
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	block, _ := buildTestBlock(t)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash0"))
+
+	// a caller that gives up on the batch of a block without reporting its status does not hold off the rebuild
+	tx, _ := buildTestTx(t)
+	writeBatch := gorocksdb.NewWriteBatch()
+	_, err := testBlockchainWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash1"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding a block")
+	writeBatch.Destroy()
+	rebuilt := make(chan error)
+	go func() {
+		_, err := rebuildAddressIndex()
+		rebuilt <- err
+	}()
+	select {
+	case err := <-rebuilt:
+		testutil.AssertNoError(t, err, "Error while rebuilding the address index")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The rebuild is held off by the abandoned batch")
+	}
+	testutil.AssertEquals(t, isAlternateAddressCFActive(), true)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+)
+
+// ErrIndexSchemaMismatch is returned when the stored index (or an index export) was written with
+// a schema version other than indexSchemaVersion. Such an index has to be rebuilt before it can be used
+type ErrIndexSchemaMismatch struct {
+	StoredVersion   uint64
+	ExpectedVersion uint64
+}
+
+func (e *ErrIndexSchemaMismatch) Error() string {
+	return fmt.Sprintf("Unsupported index schema version [%d]. Expected version [%d]", e.StoredVersion, e.ExpectedVersion)
+}
+
+// the byte orders of the index keys, as stored after the schema version
+const (
+	indexKeysStoredBigEndian    = byte(0)
+	indexKeysStoredLittleEndian = byte(1)
+)
+
+// checkIndexSchemaVersion returns an *ErrIndexSchemaMismatch if the schema version stored in the indexes
+// column family differs from indexSchemaVersion, and an error if the byte order of the index keys stored along
+// with it differs from indexByteOrder. If no version is stored, the current version and byte order are stored for an
+// empty index, while an index that holds blocks was written before the version was stored and is reported
+// with the version 0. A stored version without a byte order is taken as big-endian
+func checkIndexSchemaVersion() error {
+	openchainDB := db.GetDBHandle()
+	storedVersionBytes, err := openchainDB.GetFromIndexesCF(encodeIndexSchemaVersionKey())
+	if err != nil {
+		return err
+	}
+	if storedVersionBytes == nil {
+		_, found, err := fetchHighestIndexedBlockNumber()
+		if err != nil {
+			return err
+		}
+		if found {
+			return &ErrIndexSchemaMismatch{0, indexSchemaVersion}
+		}
+		return openchainDB.Put(openchainDB.IndexesCF, encodeIndexSchemaVersionKey(), encodeIndexSchemaVersion())
+	}
+	storedVersion, n := proto.DecodeVarint(storedVersionBytes)
+	if n == 0 {
+		return fmt.Errorf("Error while decoding the stored index schema version [%x]", storedVersionBytes)
+	}
+	if storedVersion != indexSchemaVersion {
+		return &ErrIndexSchemaMismatch{storedVersion, indexSchemaVersion}
+	}
+	storedByteOrder := binary.ByteOrder(binary.BigEndian)
+	if len(storedVersionBytes) > n && storedVersionBytes[n] == indexKeysStoredLittleEndian {
+		storedByteOrder = binary.LittleEndian
+	}
+	if storedByteOrder != indexByteOrder {
+		return fmt.Errorf("The index keys are stored with byte order [%s]. The configured byte order is [%s]",
+			storedByteOrder, indexByteOrder)
+	}
+	return nil
+}
+
+// encodeIndexSchemaVersion encodes indexSchemaVersion followed by the byte order of the index keys
+func encodeIndexSchemaVersion() []byte {
+	byteOrder := indexKeysStoredBigEndian
+	if indexByteOrder == binary.ByteOrder(binary.LittleEndian) {
+		byteOrder = indexKeysStoredLittleEndian
+	}
+	return append(encodeBlockNumber(indexSchemaVersion), byteOrder)
+}
+
+func encodeIndexSchemaVersionKey() []byte {
+	return newIndexKey(prefixIndexSchemaVersionKey)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestIndexes_SchemaVersionMismatch(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	for _, synchronous := range []bool{true, false} {
+		indexBlockDataSynchronously = synchronous
+		testDBWrapper.CleanDB(t)
+		testBlockchainWrapper := newTestBlockchainWrapper(t)
+		testBlockchainWrapper.blockchain.indexer.stop()
+		openchainDB := db.GetDBHandle()
+		storedVersionBytes, _ := openchainDB.GetFromIndexesCF(encodeIndexSchemaVersionKey())
+		testutil.AssertEquals(t, storedVersionBytes, append(encodeBlockNumber(indexSchemaVersion), indexKeysStoredBigEndian))
+
+		// an index written with an older schema version
+		testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeIndexSchemaVersionKey(),
+			encodeBlockNumber(indexSchemaVersion-1)), "Error while storing the schema version")
+		_, err := newBlockchain()
+		testutil.AssertError(t, err, "Expected an error while starting the indexer on an older index schema")
+		mismatch, ok := err.(*ErrIndexSchemaMismatch)
+		testutil.AssertEquals(t, ok, true)
+		testutil.AssertEquals(t, mismatch.StoredVersion, indexSchemaVersion-1)
+		testutil.AssertEquals(t, mismatch.ExpectedVersion, indexSchemaVersion)
+	}
+}
+
+func TestIndexes_SchemaVersionMissing(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	block, _ := buildTestBlock(t)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash0"))
+	testBlockchainWrapper.blockchain.indexer.stop()
+
+	// an index that holds blocks but no schema version predates the version marker
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, encodeIndexSchemaVersionKey()),
+		"Error while deleting the schema version")
+	_, err := newBlockchain()
+	mismatch, ok := err.(*ErrIndexSchemaMismatch)
+	testutil.AssertEquals(t, ok, true)
+	testutil.AssertEquals(t, *mismatch, ErrIndexSchemaMismatch{0, indexSchemaVersion})
+}
+
+func TestIndexes_SchemaByteOrderMismatch(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultLittleEndian := indexKeysLittleEndian
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexKeysLittleEndian = defaultLittleEndian
+		setIndexByteOrderFromConfig()
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	testBlockchainWrapper.blockchain.indexer.stop()
+
+	// the index was created with big-endian keys
+	indexKeysLittleEndian = true
+	_, err := newBlockchain()
+	testutil.AssertError(t, err, "Expected an error while starting the indexer with the other byte order")
+
+	// a version stored without the byte order is taken as big-endian
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeIndexSchemaVersionKey(),
+		encodeBlockNumber(indexSchemaVersion)), "Error while storing the schema version")
+	_, err = newBlockchain()
+	testutil.AssertError(t, err, "Expected an error while starting the indexer with the other byte order")
+	indexKeysLittleEndian = false
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	testBlockchainWrapper.blockchain.indexer.stop()
+
+	// an index created with little-endian keys records it
+	testDBWrapper.CleanDB(t)
+	indexKeysLittleEndian = true
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	testBlockchainWrapper.blockchain.indexer.stop()
+	storedVersionBytes, _ := openchainDB.GetFromIndexesCF(encodeIndexSchemaVersionKey())
+	testutil.AssertEquals(t, storedVersionBytes, append(encodeBlockNumber(indexSchemaVersion), indexKeysStoredLittleEndian))
+}
+
+func TestIndexes_ImportSchemaVersionMismatch(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	var buffer bytes.Buffer
+	buffer.Write(indexExportMagic)
+	writeUvarint(&buffer, indexSchemaVersion+1)
+	err := importIndexes(&buffer)
+	mismatch, ok := err.(*ErrIndexSchemaMismatch)
+	testutil.AssertEquals(t, ok, true)
+	testutil.AssertEquals(t, *mismatch, ErrIndexSchemaMismatch{indexSchemaVersion + 1, indexSchemaVersion})
+}
@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// indexTxSignatureHashes, when true, indexes the hash of the signature of each signed transaction as
+// (signatureHash,blockNumber,txIndex), so that a signature used by more than one transaction can be detected
+// (see isTxSignatureReused). The blocks indexed while it is off have no signature entries
+var indexTxSignatureHashes = false
+
+// txSignatureHash returns the indexHasher hash of the signature of the transaction, or nil if the transaction is
+// not signed
+func txSignatureHash(tx *protos.Transaction) []byte {
+	if len(tx.Signature) == 0 {
+		return nil
+	}
+	return indexHasher.Hash(tx.Signature)
+}
+
+// fetchTransactionsBySignatureHash returns, in chain order, the locations of the transactions whose signature
+// has the given hash (see txSignatureHash)
+func fetchTransactionsBySignatureHash(sigHash []byte, limits scanLimits) ([]*TransactionLocation, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []*TransactionLocation
+	prefix := encodeTxSignatureHashKeyPrefix(sigHash)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		blockNumber, err := decodeUint64At(itr.Key().Data(), len(prefix))
+		if err != nil {
+			return nil, false, err
+		}
+		txIndex, err := decodeUint64At(itr.Key().Data(), len(prefix)+8)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, &TransactionLocation{blockNumber, txIndex})
+	}
+	return result, false, nil
+}
+
+// isTxSignatureReused returns true if more than one indexed transaction has a signature with the given hash
+func isTxSignatureReused(sigHash []byte) (bool, error) {
+	txLocations, _, err := fetchTransactionsBySignatureHash(sigHash, newScanLimits(2))
+	if err != nil {
+		return false, err
+	}
+	return len(txLocations) > 1, nil
+}
+
+// encode TxSignatureHashCompositeKey. The block number and the tx index are big-endian encoded so that the keys of
+// a signature hash are in chain order
+func encodeTxSignatureHashCompositeKey(sigHash []byte, blockNumber uint64, txIndexInBlock uint64) []byte {
+	key := encodeTxSignatureHashKeyPrefix(sigHash)
+	key = append(key, encodeIndexUint64(blockNumber)...)
+	return append(key, encodeIndexUint64(txIndexInBlock)...)
+}
+
+func encodeTxSignatureHashKeyPrefix(sigHash []byte) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixTxSignatureHashCompositeKey))
+	b.EncodeRawBytes(sigHash)
+	return b.Bytes()
+}
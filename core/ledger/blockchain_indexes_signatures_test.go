@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_FetchTransactionsBySignatureHash(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultSignatureSetting := indexTxSignatureHashes
+	indexBlockDataSynchronously = true
+	indexTxSignatureHashes = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexTxSignatureHashes = defaultSignatureSetting
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	signedTx := func(signature string) *protos.Transaction {
+		tx, _ := buildTestTx(t)
+		if signature != "" {
+			tx.Signature = []byte(signature)
+		}
+		return tx
+	}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{signedTx("signature1"), signedTx("")}, nil),
+		[]byte("stateHash0"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{signedTx("signature2"), signedTx("signature1")}, nil),
+		[]byte("stateHash1"))
+
+	// the two transactions that share a signature are returned and flagged
+	sigHash := txSignatureHash(signedTx("signature1"))
+	txLocations, truncated, err := fetchTransactionsBySignatureHash(sigHash, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by signature hash")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}, {1, 1}})
+	reused, err := isTxSignatureReused(sigHash)
+	testutil.AssertNoError(t, err, "Error while checking the signature reuse")
+	testutil.AssertEquals(t, reused, true)
+
+	sigHash = txSignatureHash(signedTx("signature2"))
+	txLocations, _, err = fetchTransactionsBySignatureHash(sigHash, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by signature hash")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{1, 0}})
+	reused, err = isTxSignatureReused(sigHash)
+	testutil.AssertNoError(t, err, "Error while checking the signature reuse")
+	testutil.AssertEquals(t, reused, false)
+
+	// the unsigned transaction is not indexed
+	testutil.AssertNil(t, txSignatureHash(signedTx("")))
+
+	// the signature is hashed with the indexHasher
+	defaultHasher := indexHasher
+	indexHasher = prefixHasher{}
+	testutil.AssertEquals(t, txSignatureHash(signedTx("signature1")), prefixHasher{}.Hash([]byte("signature1")))
+	indexHasher = defaultHasher
+
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	numEntries := 0
+	prefix := newIndexKey(prefixTxSignatureHashCompositeKey)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		numEntries++
+	}
+	testutil.AssertEquals(t, numEntries, 3)
+}
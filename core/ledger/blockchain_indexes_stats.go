@@ -0,0 +1,153 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// indexStatsSampleInterval is the interval at which the indexer samples its statistics into the history
+// returned by getIndexStatsHistory. Zero disables the sampling
+var indexStatsSampleInterval = time.Duration(0)
+
+// indexStatsHistorySize is the number of samples kept in the history. The oldest sample is dropped when it is full
+var indexStatsHistorySize = 60
+
+// indexStatsSample is a snapshot of the indexer statistics. The rate of indexing between two samples is the
+// difference of their counters, which helps diagnosing slowdowns of the indexing
+type indexStatsSample struct {
+	Timestamp           time.Time `json:"timestamp"`
+	IndexedBlocks       uint64    `json:"indexedBlocks"`
+	IndexedTransactions uint64    `json:"indexedTransactions"`
+	IndexLag            uint64    `json:"indexLag"`
+}
+
+// indexStatsSampler periodically records an indexStatsSample into a ring buffer
+type indexStatsSampler struct {
+	interval time.Duration
+	lag      func() (uint64, error)
+	lock     sync.Mutex
+	samples  []indexStatsSample
+	next     int
+	count    int
+	started  bool
+	stopOnce sync.Once
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+func newIndexStatsSampler(interval time.Duration, historySize int) *indexStatsSampler {
+	return &indexStatsSampler{interval: interval, samples: make([]indexStatsSample, historySize),
+		stopChan: make(chan struct{}), doneChan: make(chan struct{})}
+}
+
+// newIndexStatsSamplerFromConfig returns a sampler as per indexStatsSampleInterval and indexStatsHistorySize,
+// or nil if disabled
+func newIndexStatsSamplerFromConfig() *indexStatsSampler {
+	if indexStatsSampleInterval <= 0 || indexStatsHistorySize <= 0 {
+		return nil
+	}
+	return newIndexStatsSampler(indexStatsSampleInterval, indexStatsHistorySize)
+}
+
+// start starts sampling. lag returns the current index lag (see blockchain.indexLag)
+func (sampler *indexStatsSampler) start(lag func() (uint64, error)) {
+	if sampler == nil {
+		return
+	}
+	sampler.lag = lag
+	sampler.started = true
+	go func() {
+		defer close(sampler.doneChan)
+		ticker := time.NewTicker(sampler.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sampler.stopChan:
+				return
+			case <-ticker.C:
+				sampler.sample()
+			}
+		}
+	}()
+}
+
+// sample records a sample of the current statistics
+func (sampler *indexStatsSampler) sample() {
+	sample := indexStatsSample{
+		Timestamp:           time.Now(),
+		IndexedBlocks:       atomic.LoadUint64(&indexMetrics.indexedBlocks),
+		IndexedTransactions: atomic.LoadUint64(&indexMetrics.indexedTxs),
+	}
+	if sampler.lag != nil {
+		lag, err := sampler.lag()
+		if err != nil {
+			indexLogger.Warningf("Could not sample the index lag: %s", err)
+		}
+		sample.IndexLag = lag
+	}
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+	sampler.samples[sampler.next] = sample
+	sampler.next = (sampler.next + 1) % len(sampler.samples)
+	if sampler.count < len(sampler.samples) {
+		sampler.count++
+	}
+}
+
+// history returns the recorded samples, oldest first
+func (sampler *indexStatsSampler) history() []indexStatsSample {
+	if sampler == nil {
+		return nil
+	}
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+	history := make([]indexStatsSample, 0, sampler.count)
+	for i := sampler.count; i > 0; i-- {
+		history = append(history, sampler.samples[(sampler.next-i+len(sampler.samples))%len(sampler.samples)])
+	}
+	return history
+}
+
+// stop stops the sampling. It is safe to call stop more than once
+func (sampler *indexStatsSampler) stop() {
+	if sampler == nil {
+		return
+	}
+	sampler.stopOnce.Do(func() {
+		close(sampler.stopChan)
+		if sampler.started {
+			<-sampler.doneChan
+		}
+	})
+}
+
+// indexStatsSampling is implemented by the indexers that sample their statistics
+type indexStatsSampling interface {
+	statsHistory() []indexStatsSample
+}
+
+// getIndexStatsHistory returns the sampled statistics of the indexer, oldest first.
+// The history is empty if the sampling is disabled (see indexStatsSampleInterval)
+func (blockchain *blockchain) getIndexStatsHistory() []indexStatsSample {
+	if sampling, ok := blockchain.indexer.(indexStatsSampling); ok {
+		return sampling.statsHistory()
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_StatsSamplerHistory(t *testing.T) {
+	lag := uint64(0)
+	sampler := newIndexStatsSampler(time.Hour, 3)
+	sampler.lag = func() (uint64, error) { return lag, nil }
+	testutil.AssertEquals(t, len(sampler.history()), 0)
+
+	for i := 0; i < 5; i++ {
+		indexMetrics.blockIndexed(2)
+		lag = uint64(i)
+		sampler.sample()
+	}
+
+	// the buffer holds the last 3 samples, oldest first
+	history := sampler.history()
+	testutil.AssertEquals(t, len(history), 3)
+	for i, sample := range history {
+		testutil.AssertEquals(t, sample.IndexLag, uint64(i+2))
+		if i > 0 {
+			testutil.AssertEquals(t, sample.IndexedBlocks-history[i-1].IndexedBlocks, uint64(1))
+			testutil.AssertEquals(t, sample.IndexedTransactions-history[i-1].IndexedTransactions, uint64(2))
+			testutil.AssertEquals(t, sample.Timestamp.Before(history[i-1].Timestamp), false)
+		}
+	}
+
+	var nilSampler *indexStatsSampler
+	testutil.AssertNil(t, nilSampler.history())
+	nilSampler.stop()
+}
+
+func TestIndexes_StatsSamplerIndexer(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultInterval := indexStatsSampleInterval
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexStatsSampleInterval = defaultInterval
+	}()
+
+	testDBWrapper.CleanDB(t)
+	indexStatsSampleInterval = 0
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	testutil.AssertNil(t, testBlockchainWrapper.blockchain.getIndexStatsHistory())
+	testBlockchainWrapper.blockchain.indexer.stop()
+
+	numGoroutines := runtime.NumGoroutine()
+	indexStatsSampleInterval = time.Millisecond
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	for i := 0; i < 3; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	for i := 0; i < 100 && len(testBlockchainWrapper.blockchain.getIndexStatsHistory()) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	history := testBlockchainWrapper.blockchain.getIndexStatsHistory()
+	testutil.AssertEquals(t, len(history) >= 2, true)
+	testutil.AssertEquals(t, history[len(history)-1].IndexLag, uint64(0))
+
+	// stopping the indexer stops the sampler
+	testBlockchainWrapper.blockchain.indexer.stop()
+	for i := 0; i < 100 && runtime.NumGoroutine() > numGoroutines; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	testutil.AssertEquals(t, runtime.NumGoroutine(), numGoroutines)
+	numSamples := len(testBlockchainWrapper.blockchain.getIndexStatsHistory())
+	time.Sleep(5 * time.Millisecond)
+	testutil.AssertEquals(t, len(testBlockchainWrapper.blockchain.getIndexStatsHistory()), numSamples)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// TagExtractor returns the application defined tags of a transaction. Each tag is indexed as
+// (tag,blockNumber,txIndex) so that the transactions can be looked up by tag (see fetchTransactionsByTag)
+type TagExtractor func(tx *protos.Transaction) []string
+
+// getTxTags returns the tags of the given transaction. No transaction is tagged unless an extractor is registered
+var getTxTags TagExtractor = func(tx *protos.Transaction) []string {
+	return nil
+}
+
+// RegisterTagExtractor sets the extractor of the tags that are indexed for each transaction. It should be called
+// before the ledger, and hence its indexer, is created, as the blocks indexed before the call are not tagged.
+// A nil extractor disables the tagging
+func RegisterTagExtractor(extractor TagExtractor) {
+	if extractor == nil {
+		extractor = func(tx *protos.Transaction) []string { return nil }
+	}
+	getTxTags = extractor
+}
+
+// fetchTransactionsByTag returns, in chain order, the locations of the transactions tagged with the given tag
+func fetchTransactionsByTag(tag string, limits scanLimits) ([]*TransactionLocation, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []*TransactionLocation
+	prefix := encodeTxTagKeyPrefix(tag)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		blockNumber, err := decodeUint64At(itr.Key().Data(), len(prefix))
+		if err != nil {
+			return nil, false, err
+		}
+		txIndex, err := decodeUint64At(itr.Key().Data(), len(prefix)+8)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, &TransactionLocation{blockNumber, txIndex})
+	}
+	return result, false, nil
+}
+
+// encode TxTagCompositeKey. The block number and the tx index are big-endian encoded so that the keys of a tag are in chain order
+func encodeTxTagCompositeKey(tag string, blockNumber uint64, txIndexInBlock uint64) []byte {
+	key := encodeTxTagKeyPrefix(tag)
+	key = append(key, encodeIndexUint64(blockNumber)...)
+	return append(key, encodeIndexUint64(txIndexInBlock)...)
+}
+
+func encodeTxTagKeyPrefix(tag string) []byte {
+	b := proto.NewBuffer(newIndexKey(prefixTxTagCompositeKey))
+	b.EncodeRawBytes([]byte(tag))
+	return b.Bytes()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_FetchTransactionsByTag(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getTxTags
+	txTags := make(map[string][]string)
+	RegisterTagExtractor(func(tx *protos.Transaction) []string {
+		return txTags[tx.Uuid]
+	})
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxTags = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	blockTags := [][][]string{
+		{{"invoice"}, {}},
+		{{"invoice", "priority"}},
+		{{}, {"priority"}, {"invoice"}},
+	}
+	for i, tags := range blockTags {
+		var transactions []*protos.Transaction
+		for _, tagsOfTx := range tags {
+			tx, uuid := buildTestTx(t)
+			txTags[uuid] = tagsOfTx
+			transactions = append(transactions, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	txLocations, truncated, err := fetchTransactionsByTag("invoice", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by tag")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}, {1, 0}, {2, 2}})
+
+	txLocations, _, err = fetchTransactionsByTag("priority", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by tag")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{1, 0}, {2, 1}})
+
+	txLocations, truncated, err = fetchTransactionsByTag("invoice", newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by tag")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}, {1, 0}})
+
+	txLocations, _, err = fetchTransactionsByTag("unknown", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by tag")
+	testutil.AssertNil(t, txLocations)
+
+	// a tag that is a prefix of another tag does not match the transactions of the other tag
+	txLocations, _, err = fetchTransactionsByTag("inv", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by tag")
+	testutil.AssertNil(t, txLocations)
+
+	// the tag entries of a block are removed along with its other entries
+	_, err = pruneIndexesBelow(2, 2, 0)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	txLocations, _, err = fetchTransactionsByTag("invoice", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by tag")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{2, 2}})
+
+	RegisterTagExtractor(nil)
+	testutil.AssertNil(t, getTxTags(&protos.Transaction{}))
+}
@@ -17,10 +17,21 @@ limitations under the License.
 package ledger
 
 import (
+	"fmt"
+	google_protobuf "google/protobuf"
+	"math"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/protos"
+	"github.com/op/go-logging"
+	"github.com/tecbot/gorocksdb"
+	"golang.org/x/net/context"
 )
 
 func TestIndexes_GetBlockByBlockNumber(t *testing.T) {
@@ -159,3 +170,2169 @@ func testIndexesGetTransactionByUUID(t *testing.T) {
 	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid3), tx3)
 	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid4), tx4)
 }
+
+func TestIndexes_ListAllAuthorizedChaincodes(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	deployTx1, err := protos.NewTransaction(protos.ChaincodeID{Path: "Contract1"}, testutil.GenerateUUID(t), "NewContract", []string{})
+	testutil.AssertNoError(t, err, "Error while building transaction")
+	deployTx2, err := protos.NewTransaction(protos.ChaincodeID{Path: "Contract2"}, testutil.GenerateUUID(t), "NewContract", []string{})
+	testutil.AssertNoError(t, err, "Error while building transaction")
+	deployTx1.Type = protos.Transaction_CHAINCODE_DEPLOY
+	deployTx2.Type = protos.Transaction_CHAINCODE_DEPLOY
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{deployTx1}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{deployTx2}, nil), []byte("stateHash2"))
+
+	// invoking an already deployed chaincode should not inflate the number of authorized addresses
+	invokeTx1, err := protos.NewTransaction(protos.ChaincodeID{Path: "Contract1"}, testutil.GenerateUUID(t), "setX", []string{})
+	testutil.AssertNoError(t, err, "Error while building transaction")
+	invokeTx1.Type = protos.Transaction_CHAINCODE_INVOKE
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{invokeTx1}, nil), []byte("stateHash3"))
+
+	chaincodes, _, err := listAllAuthorizedChaincodes(testScanLimits)
+	testutil.AssertNoError(t, err, "Error while listing authorized chaincodes")
+	testutil.AssertEquals(t, len(chaincodes), 2)
+	paths := make(map[string]uint64)
+	for _, chaincode := range chaincodes {
+		paths[chaincode.chaincodeID.Path] = chaincode.addressCount
+	}
+	testutil.AssertEquals(t, paths, map[string]uint64{"Contract1": 2, "Contract2": 2})
+}
+
+func TestIndexes_FetchChaincodeHistory(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// deploy Contract1 and then update it twice, with a deployment of another chaincode and an invoke in between
+	for i, chaincodeID := range []protos.ChaincodeID{{Path: "Contract1", Name: "v1"}, {Path: "Contract2", Name: "v1"},
+		{Path: "Contract1", Name: "v2"}, {Path: "Contract1", Name: "v3"}} {
+		deployTx, err := protos.NewTransaction(chaincodeID, testutil.GenerateUUID(t), "NewContract", []string{})
+		testutil.AssertNoError(t, err, "Error while building transaction")
+		deployTx.Type = protos.Transaction_CHAINCODE_DEPLOY
+		invokeTx, err := protos.NewTransaction(chaincodeID, testutil.GenerateUUID(t), "setX", []string{})
+		testutil.AssertNoError(t, err, "Error while building transaction")
+		invokeTx.Type = protos.Transaction_CHAINCODE_INVOKE
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{invokeTx, deployTx}, nil),
+			[]byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	history, truncated, err := fetchChaincodeHistory(&protos.ChaincodeID{Path: "Contract1"}, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching chaincode history")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, history, []*chaincodeDeployment{{0, 1, "v1"}, {2, 1, "v2"}, {3, 1, "v3"}})
+
+	history, _, err = fetchChaincodeHistory(&protos.ChaincodeID{Path: "Contract2"}, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching chaincode history")
+	testutil.AssertEquals(t, history, []*chaincodeDeployment{{1, 1, "v1"}})
+
+	history, _, err = fetchChaincodeHistory(&protos.ChaincodeID{Path: "Contract3"}, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching chaincode history")
+	testutil.AssertEquals(t, len(history), 0)
+}
+
+func TestIndexes_FetchTransactionsByChaincodePaged(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// five transactions on the busy chaincode spread over three blocks, interleaved with transactions on another chaincode
+	var expected []*protos.Transaction
+	for i, chaincodeNames := range [][]string{{"busy", "other", "busy"}, {"other"}, {"busy", "busy", "other", "busy"}} {
+		var transactions []*protos.Transaction
+		for _, chaincodeName := range chaincodeNames {
+			tx, err := protos.NewTransaction(protos.ChaincodeID{Name: chaincodeName}, testutil.GenerateUUID(t), "setX", []string{})
+			testutil.AssertNoError(t, err, "Error while building transaction")
+			tx.Type = protos.Transaction_CHAINCODE_INVOKE
+			transactions = append(transactions, tx)
+			if chaincodeName == "busy" {
+				expected = append(expected, tx)
+			}
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	chaincodeID := &protos.ChaincodeID{Name: "busy"}
+	page, token, err := fetchTransactionsByChaincodePaged(chaincodeID, nil, 3)
+	testutil.AssertNoError(t, err, "Error while fetching the first page")
+	testutil.AssertEquals(t, page, expected[:3])
+	testutil.AssertEquals(t, token, encodeChaincodeTxCompositeKey("busy", 2, 0))
+
+	page, token, err = fetchTransactionsByChaincodePaged(chaincodeID, token, 3)
+	testutil.AssertNoError(t, err, "Error while fetching the second page")
+	testutil.AssertEquals(t, page, expected[3:])
+	testutil.AssertNil(t, token)
+
+	// a page that ends with the last transaction still returns no token
+	page, token, err = fetchTransactionsByChaincodePaged(chaincodeID, nil, 5)
+	testutil.AssertNoError(t, err, "Error while fetching transactions")
+	testutil.AssertEquals(t, page, expected)
+	testutil.AssertNil(t, token)
+
+	_, _, err = fetchTransactionsByChaincodePaged(&protos.ChaincodeID{Name: "other"}, encodeChaincodeTxCompositeKey("busy", 2, 0), 3)
+	testutil.AssertError(t, err, "Expected an error for a token of another chaincode")
+	_, _, err = fetchTransactionsByChaincodePaged(chaincodeID, nil, 0)
+	testutil.AssertError(t, err, "Expected an error for a zero page size")
+}
+
+func TestIndexes_EncodeDecodeBlockNumTxIndexBoundaries(t *testing.T) {
+	testCases := []struct {
+		blockNumber uint64
+		txIndex     uint64
+	}{
+		{0, 0},
+		{1, math.MaxUint64},
+		{math.MaxUint64, 1},
+		{math.MaxUint64 - 1, math.MaxUint64 - 1},
+		{math.MaxUint64, math.MaxUint64},
+	}
+	for _, testCase := range testCases {
+		encodedBytes := encodeBlockNumTxIndex(testCase.blockNumber, testCase.txIndex)
+		blockNumber, txIndex, err := decodeBlockNumTxIndex(encodedBytes)
+		testutil.AssertNoError(t, err, "Error while decoding block number and tx index")
+		testutil.AssertEquals(t, blockNumber, testCase.blockNumber)
+		testutil.AssertEquals(t, txIndex, testCase.txIndex)
+		blockNumber, err = decodeBlockNumber(encodeBlockNumber(testCase.blockNumber))
+		testutil.AssertNoError(t, err, "Error while decoding block number")
+		testutil.AssertEquals(t, blockNumber, testCase.blockNumber)
+	}
+	// a varint for math.MaxUint64 takes 10 bytes
+	encodedBytes := encodeBlockNumTxIndex(math.MaxUint64, math.MaxUint64)
+	testutil.AssertEquals(t, len(encodedBytes), 20)
+	_, _, err := decodeBlockNumTxIndex(encodedBytes[:15])
+	testutil.AssertError(t, err, "Error expected while decoding truncated bytes")
+}
+
+func TestIndexes_DecodeCorruptEntries(t *testing.T) {
+	truncated := []byte{0x80}
+	_, err := decodeBlockNumber(nil)
+	testutil.AssertError(t, err, "Expected an error decoding an empty block number")
+	_, err = decodeBlockNumber(truncated)
+	testutil.AssertError(t, err, "Expected an error decoding a truncated block number")
+	_, _, err = decodeBlockNumTxIndex(truncated)
+	testutil.AssertError(t, err, "Expected an error decoding a truncated block number")
+	_, _, err = decodeBlockNumTxIndex([]byte{1})
+	testutil.AssertError(t, err, "Expected an error decoding a missing tx index")
+	_, err = decodeListTxIndexes([]byte{1, 0x80})
+	testutil.AssertError(t, err, "Expected an error decoding a truncated list of tx indexes")
+	_, err = decodeAddressList([]byte{5, 'a'})
+	testutil.AssertError(t, err, "Expected an error decoding a truncated list of addresses")
+	_, _, err = decodePruneCursor(truncated)
+	testutil.AssertError(t, err, "Expected an error decoding a truncated prune cursor")
+	_, err = decodeIndexTombstone([]byte{1})
+	testutil.AssertError(t, err, "Expected an error decoding a truncated tombstone")
+
+	_, _, err = decodeAddressBlockNumCompositeKey(nil)
+	testutil.AssertError(t, err, "Expected an error decoding an empty key")
+	_, _, err = decodeAddressBlockNumCompositeKey(append(newIndexKey(prefixAddressBlockNumCompositeKey), 5, 'a'))
+	testutil.AssertError(t, err, "Expected an error decoding a truncated address")
+	_, _, err = decodeTxReferenceCompositeKey(append(newIndexKey(prefixTxReferenceCompositeKey), 1, 'a'))
+	testutil.AssertError(t, err, "Expected an error decoding a missing tx uuid")
+	_, _, err = decodeAddressChaincodeIDCompositeKey(append(newIndexKey(prefixAddressChaincodeIDCompositeKey), truncated...))
+	testutil.AssertError(t, err, "Expected an error decoding a truncated address")
+	_, err = decodeTxSizeKey(append(newIndexKey(prefixTxSizeKey), 1, 2))
+	testutil.AssertError(t, err, "Expected an error decoding a truncated tx size")
+	_, _, _, err = decodeTxTypeCompositeKey(append(newIndexKey(prefixTxTypeCompositeKey), 0, 0, 0, 1))
+	testutil.AssertError(t, err, "Expected an error decoding a truncated tx type key")
+	_, _, err = decodeTxCountBlockNumCompositeKey(encodeTxCountKeyPrefix(1))
+	testutil.AssertError(t, err, "Expected an error decoding a missing block number")
+	_, err = decodeBlockNumberKey(append(newIndexKey(prefixBlockNumberKey), 1))
+	testutil.AssertError(t, err, "Expected an error decoding a truncated block number key")
+	_, err = decodeUint64At([]byte{1, 2, 3}, 1)
+	testutil.AssertError(t, err, "Expected an error decoding a truncated uint64")
+}
+
+// panickingKeyEncoder panics while decoding block hash keys, as a decoder could on an unexpected corruption
+type panickingKeyEncoder struct {
+	defaultKeyEncoder
+}
+
+func (panickingKeyEncoder) decodeBlockHashKey(key []byte) []byte {
+	panic("corrupted key")
+}
+
+func TestIndexes_BlockHashCursorCorruptEntries(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultEncoder := indexKeyEncoder
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexKeyEncoder = defaultEncoder
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	tx, _ := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash0"))
+
+	// a panic while decoding ends the enumeration with an error
+	indexKeyEncoder = panickingKeyEncoder{}
+	cursor := newBlockHashCursor()
+	_, _, ok := cursor.Next()
+	testutil.AssertEquals(t, ok, false)
+	testutil.AssertError(t, cursor.Err(), "Expected an error from the recovered panic")
+	testutil.AssertEquals(t, strings.Contains(cursor.Err().Error(), "corrupted key"), true)
+	cursor.Close()
+	indexKeyEncoder = defaultEncoder
+
+	// a corrupted block number value ends the enumeration with an error
+	blockHash, _ := block.GetHash()
+	testutil.AssertNoError(t, db.GetDBHandle().Put(db.GetDBHandle().IndexesCF, encodeBlockHashKey(blockHash), []byte{0x80}),
+		"Error while corrupting the index entry")
+	cursor = newBlockHashCursor()
+	defer cursor.Close()
+	_, _, ok = cursor.Next()
+	testutil.AssertEquals(t, ok, false)
+	testutil.AssertError(t, cursor.Err(), "Expected an error decoding the corrupted block number")
+	_, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertError(t, err, "Expected an error decoding the corrupted block number")
+}
+
+func TestIndexes_FetchTransactionsBySizeRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	smallTx, _ := buildTestTx(t)
+	smallTx.Payload = make([]byte, 10)
+	mediumTx, _ := buildTestTx(t)
+	mediumTx.Payload = make([]byte, 1000)
+	largeTx, _ := buildTestTx(t)
+	largeTx.Payload = make([]byte, 100000)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{smallTx, largeTx}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{mediumTx}, nil), []byte("stateHash2"))
+
+	txs, _, err := fetchTransactionsBySizeRange(100000, math.MaxUint64, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 1}})
+
+	txs, _, err = fetchTransactionsBySizeRange(0, 100000, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 0}, {1, 0}})
+
+	txs, _, err = fetchTransactionsBySizeRange(1000, 2000, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{1, 0}})
+
+	txs, _, err = fetchTransactionsBySizeRange(200000, math.MaxUint64, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, len(txs), 0)
+}
+
+func TestIndexes_FormatTransactionLocation(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, _ := buildTestTx(t)
+	tx2, _ := buildTestTx(t)
+	tx3, uuid3 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx2, tx3}, nil), []byte("stateHash2"))
+
+	location, err := formatTransactionLocation(uuid3)
+	testutil.AssertNoError(t, err, "Error while formatting transaction location")
+	testutil.AssertEquals(t, location, "block 1, index 1, uuid "+uuid3)
+
+	location, err = formatTransactionLocation("NotAnActualUUID")
+	testutil.AssertNoError(t, err, "Error while formatting transaction location")
+	testutil.AssertEquals(t, location, "uuid NotAnActualUUID not found in index")
+}
+
+func TestIndexes_FetchDependentTransactions(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getTxReferencedUUIDs
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxReferencedUUIDs = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// for the test, a transaction refers to the uuid carried in its metadata
+	getTxReferencedUUIDs = func(tx *protos.Transaction) []string {
+		if len(tx.Metadata) == 0 {
+			return nil
+		}
+		return []string{string(tx.Metadata)}
+	}
+
+	tx1, uuid1 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+	tx2, uuid2 := buildTestTx(t)
+	tx2.Metadata = []byte(uuid1)
+	tx3, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx2, tx3}, nil), []byte("stateHash2"))
+
+	dependents, _, err := fetchDependentTransactions(uuid1, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching dependent transactions")
+	testutil.AssertEquals(t, dependents, []string{uuid2})
+
+	dependents, _, err = fetchDependentTransactions(uuid2, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching dependent transactions")
+	testutil.AssertEquals(t, len(dependents), 0)
+}
+
+func TestIndexes_KeyNamespace(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultNamespace := indexKeyNamespace
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexKeyNamespace = defaultNamespace
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	indexKeyNamespace = byte(0x80)
+	tx1, uuid1 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+	testutil.AssertEquals(t, encodeTxUUIDKey(uuid1), append([]byte{0x80, prefixTxUUIDKey}, []byte(uuid1)...))
+
+	indexKeyNamespace = byte(0)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx2}, nil), []byte("stateHash2"))
+	testutil.AssertEquals(t, encodeTxUUIDKey(uuid2), append([]byte{prefixTxUUIDKey}, []byte(uuid2)...))
+
+	// default namespace sees only the entries written under the default namespace
+	_, _, err := fetchTransactionIndexByUUIDFromDB(uuid1)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	blockNumber, txIndex, err := fetchTransactionIndexByUUIDFromDB(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching transaction index")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+	testutil.AssertEquals(t, txIndex, uint64(0))
+
+	// custom namespace sees only the entries written under the custom namespace
+	indexKeyNamespace = byte(0x80)
+	_, _, err = fetchTransactionIndexByUUIDFromDB(uuid2)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	blockNumber, txIndex, err = fetchTransactionIndexByUUIDFromDB(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching transaction index")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+	testutil.AssertEquals(t, txIndex, uint64(0))
+	txs, _, err := fetchTransactionsBySizeRange(0, math.MaxUint64, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 0}})
+}
+
+func TestIndexes_BlockHashCursor(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	blocks, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+	if err != nil {
+		t.Fatalf("Error populating block chain with sample data: %s", err)
+	}
+	expected := make(map[string]uint64)
+	for i, block := range blocks {
+		blockHash, _ := block.GetHash()
+		expected[string(blockHash)] = uint64(i)
+	}
+
+	cursor := newBlockHashCursor()
+	actual := make(map[string]uint64)
+	for {
+		blockHash, blockNumber, ok := cursor.Next()
+		if !ok {
+			break
+		}
+		actual[string(blockHash)] = blockNumber
+	}
+	testutil.AssertEquals(t, actual, expected)
+
+	// further calls keep reporting the end of the entries and Close can be called repeatedly
+	_, _, ok := cursor.Next()
+	testutil.AssertEquals(t, ok, false)
+	cursor.Close()
+	cursor.Close()
+	_, _, ok = cursor.Next()
+	testutil.AssertEquals(t, ok, false)
+}
+
+func TestIndexes_BlockSummaryIterator(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var expected []*BlockSummary
+	for i, numTxs := range []int{2, 0, 1, 3} {
+		var txs []*protos.Transaction
+		for j := 0; j < numTxs; j++ {
+			tx, _ := buildTestTx(t)
+			txs = append(txs, tx)
+		}
+		block := protos.NewBlock(txs, nil)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+		blockHash, _ := testBlockchainWrapper.getBlock(uint64(i)).GetHash()
+		expected = append(expected, &BlockSummary{uint64(i), blockHash, uint64(numTxs)})
+	}
+
+	// the iteration stops at the end of the blockNumber -> blockHash entries even though entries with higher prefixes exist
+	iterator := newBlockSummaryIterator()
+	defer iterator.Close()
+	var actual []*BlockSummary
+	for {
+		summary, ok := iterator.Next()
+		if !ok {
+			break
+		}
+		actual = append(actual, summary)
+	}
+	testutil.AssertNoError(t, iterator.Err(), "Error while iterating block summaries")
+	testutil.AssertEquals(t, actual, expected)
+	_, ok := iterator.Next()
+	testutil.AssertEquals(t, ok, false)
+}
+
+func TestIndexes_FetchTransactionsInRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var txs []*protos.Transaction
+	for i := 0; i < 10; i++ {
+		tx, _ := buildTestTx(t)
+		txs = append(txs, tx)
+	}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(txs, nil), []byte("stateHash1"))
+
+	txCount, found, err := fetchBlockTxCount(0)
+	testutil.AssertNoError(t, err, "Error while fetching transaction count of block")
+	testutil.AssertEquals(t, found, true)
+	testutil.AssertEquals(t, txCount, uint64(10))
+
+	rangeTxs, err := fetchTransactionsInRange(0, 3, 7)
+	testutil.AssertNoError(t, err, "Error while fetching transactions in range")
+	testutil.AssertEquals(t, len(rangeTxs), 4)
+	for i, tx := range rangeTxs {
+		testutil.AssertEquals(t, tx.Uuid, txs[3+i].Uuid)
+	}
+	rangeTxs, err = fetchTransactionsInRange(0, 10, 10)
+	testutil.AssertNoError(t, err, "Error while fetching empty range")
+	testutil.AssertEquals(t, len(rangeTxs), 0)
+
+	_, err = fetchTransactionsInRange(0, 5, 11)
+	testutil.AssertError(t, err, "Expected error for a range beyond the transactions of the block")
+	_, err = fetchTransactionsInRange(0, 7, 3)
+	testutil.AssertError(t, err, "Expected error for an inverted range")
+	_, err = fetchTransactionsInRange(1, 0, 1)
+	testutil.AssertError(t, err, "Expected error for a block that does not exist")
+}
+
+func TestIndexes_SkipAlreadyIndexedBlock(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	tx, _ := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	err := addIndexDataForPersistence(block, 0, []byte("blockHash0"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding index data")
+	testDBWrapper.WriteToDB(t, writeBatch)
+
+	// indexing the same block again is a no-op
+	secondWriteBatch := gorocksdb.NewWriteBatch()
+	defer secondWriteBatch.Destroy()
+	err = addIndexDataForPersistence(block, 0, []byte("blockHash0"), secondWriteBatch)
+	testutil.AssertNoError(t, err, "Error while adding index data")
+	testutil.AssertEquals(t, secondWriteBatch.Count(), 0)
+
+	// the same hash at a different block number is indexed
+	err = addIndexDataForPersistence(block, 1, []byte("blockHash0"), secondWriteBatch)
+	testutil.AssertNoError(t, err, "Error while adding index data")
+	testutil.AssertEquals(t, secondWriteBatch.Count() > 0, true)
+}
+
+func TestIndexes_CreateIndexesSyncInvalidInputs(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	indexer := newBlockchainIndexerSync()
+	tx, _ := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+
+	err := indexer.createIndexesSync(block, 0, []byte("blockHash0"), nil)
+	testutil.AssertError(t, err, "Expected error for a nil write batch")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "write batch is nil"), true)
+	err = indexer.createIndexesSync(nil, 0, []byte("blockHash0"), writeBatch)
+	testutil.AssertError(t, err, "Expected error for a nil block")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "block is nil"), true)
+	err = indexer.createIndexesSync(block, 0, nil, writeBatch)
+	testutil.AssertError(t, err, "Expected error for a nil block hash")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "block hash is empty"), true)
+	_, err = getTxUUIDForIndex(nil)
+	testutil.AssertError(t, err, "Expected error for a nil transaction")
+	err = indexer.createIndexesSync(protos.NewBlock([]*protos.Transaction{tx, nil}, nil), 0, []byte("blockHash0"), writeBatch)
+	testutil.AssertError(t, err, "Expected error for a block with a nil transaction")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "transaction at index [1] is nil"), true)
+	testutil.AssertEquals(t, writeBatch.Count(), 0)
+}
+
+func TestIndexes_UnmarshallableBlock(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	block, _ := buildTestBlock(t)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash0"))
+	indexEntries := func() map[string]string {
+		entries := make(map[string]string)
+		itr := db.GetDBHandle().GetIndexesCFIterator()
+		defer itr.Close()
+		for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+			entries[string(itr.Key().Data())] = string(itr.Value().Data())
+		}
+		return entries
+	}
+	entriesBefore := indexEntries()
+
+	// a block with a nil transaction does not marshal, so it cannot be hashed
+	tx, _ := buildTestTx(t)
+	malformedBlock := protos.NewBlock([]*protos.Transaction{tx, nil}, nil)
+	_, err := computeBlockHash(malformedBlock)
+	testutil.AssertError(t, err, "Expected an error hashing a block that does not marshal")
+
+	// the paths that index a block hash it first, and hence fail before adding any entry
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	_, err = testBlockchainWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(), malformedBlock,
+		[]byte("stateHash1"), writeBatch)
+	testutil.AssertError(t, err, "Expected an error indexing a block that does not marshal")
+	testutil.AssertEquals(t, writeBatch.Count(), 0)
+
+	err = indexBlocks([]*protos.Block{malformedBlock}, 1)
+	testutil.AssertError(t, err, "Expected an error bulk indexing a block that does not marshal")
+	testutil.AssertEquals(t, indexEntries(), entriesBefore)
+}
+
+func BenchmarkIndexes_AddIndexDataForNewBlock(b *testing.B) {
+	block := setupBenchmarkIndexedBlock(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writeBatch := gorocksdb.NewWriteBatch()
+		addIndexDataForPersistence(block, 1, []byte(fmt.Sprintf("blockHash%d", i)), writeBatch)
+		writeBatch.Destroy()
+	}
+}
+
+func BenchmarkIndexes_AddIndexDataForIndexedBlock(b *testing.B) {
+	block := setupBenchmarkIndexedBlock(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writeBatch := gorocksdb.NewWriteBatch()
+		addIndexDataForPersistence(block, 0, []byte("blockHash0"), writeBatch)
+		writeBatch.Destroy()
+	}
+}
+
+// setupBenchmarkIndexedBlock indexes a block of 100 transactions at block number 0 with the hash "blockHash0"
+func setupBenchmarkIndexedBlock(b *testing.B) *protos.Block {
+	testDBWrapper.CleanDB(b)
+	disableLogging()
+	var txs []*protos.Transaction
+	for i := 0; i < 100; i++ {
+		tx, _ := buildTestTx(b)
+		txs = append(txs, tx)
+	}
+	block := protos.NewBlock(txs, nil)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	if err := addIndexDataForPersistence(block, 0, []byte("blockHash0"), writeBatch); err != nil {
+		b.Fatalf("Error while adding index data: %s", err)
+	}
+	testDBWrapper.WriteToDB(b, writeBatch)
+	return block
+}
+
+func TestIndexes_IndexingAfterDBReopen(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, uuid1 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+	indexesCF := db.GetDBHandle().IndexesCF
+
+	// closing the db releases the column family handles and the next access reopens it with new handles
+	testDBWrapper.CloseDB(t)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx2}, nil), []byte("stateHash2"))
+	testutil.AssertEquals(t, db.GetDBHandle().IndexesCF != indexesCF, true)
+
+	txLocation, err := testBlockchainWrapper.blockchain.indexer.fetchTransactionLocationByUUID(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{0, 0})
+	txLocation, err = testBlockchainWrapper.blockchain.indexer.fetchTransactionLocationByUUID(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{1, 0})
+}
+
+func TestIndexes_VerifyTransactionInBlock(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx2}, nil), []byte("stateHash2"))
+
+	inBlock, err := verifyTransactionInBlock(uuid2, 1)
+	testutil.AssertNoError(t, err, "Error while verifying transaction in block")
+	testutil.AssertEquals(t, inBlock, true)
+
+	inBlock, err = verifyTransactionInBlock(uuid1, 1)
+	testutil.AssertNoError(t, err, "Error while verifying transaction in block")
+	testutil.AssertEquals(t, inBlock, false)
+
+	inBlock, err = verifyTransactionInBlock("NotAnActualUUID", 0)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	testutil.AssertEquals(t, inBlock, false)
+}
+
+func TestIndexes_LogIndexWriteVolume(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	memoryBackend := logging.NewMemoryBackend(1024)
+	leveledBackend := logging.AddModuleLevel(memoryBackend)
+	leveledBackend.SetLevel(logging.DEBUG, "indexes")
+	indexLogger.SetBackend(leveledBackend)
+	defer func() {
+		defaultBackend := logging.AddModuleLevel(logging.NewLogBackend(os.Stderr, "", 0))
+		defaultBackend.SetLevel(logging.GetLevel("indexes"), "indexes")
+		indexLogger.SetBackend(defaultBackend)
+	}()
+
+	tx1, _ := buildTestTx(t)
+	tx2, _ := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	err := addIndexDataForPersistence(block, 5, []byte("blockHash"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding index data")
+
+	var numKeys, numBytes int
+	found := false
+	for node := memoryBackend.Head(); node != nil; node = node.Next() {
+		message := node.Record.Message()
+		if strings.HasPrefix(message, "Index data for block number [5]") {
+			fmt.Sscanf(message, "Index data for block number [5]: keys written = [%d], bytes written = [%d]", &numKeys, &numBytes)
+			found = true
+		}
+	}
+	testutil.AssertEquals(t, found, true)
+	testutil.AssertEquals(t, numKeys, writeBatch.Count())
+	if numBytes <= 0 {
+		t.Fatalf("Expected a positive number of bytes written, found [%d]", numBytes)
+	}
+}
+
+func TestIndexes_IndexedBlockRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	_, _, err := indexedBlockRange()
+	testutil.AssertSame(t, err, errIndexEmpty)
+
+	for i := 0; i < 5; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	minBlock, maxBlock, err := indexedBlockRange()
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block range")
+	testutil.AssertEquals(t, minBlock, uint64(0))
+	testutil.AssertEquals(t, maxBlock, uint64(4))
+
+	_, err = pruneIndexesBelow(3, 2, 0)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	minBlock, maxBlock, err = indexedBlockRange()
+	testutil.AssertNoError(t, err, "Error while fetching the indexed block range")
+	testutil.AssertEquals(t, minBlock, uint64(3))
+	testutil.AssertEquals(t, maxBlock, uint64(4))
+}
+
+func TestIndexes_ResumablePrune(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+
+	var blocks []*protos.Block
+	var uuids []string
+	for i := 0; i < 5; i++ {
+		tx, uuid := buildTestTx(t)
+		block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+		blocks = append(blocks, block)
+		uuids = append(uuids, uuid)
+	}
+
+	done, err := pruneIndexesBelow(4, 2, 1)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	testutil.AssertEquals(t, done, false)
+	prunedBelow, target, err := pruneStatus()
+	testutil.AssertNoError(t, err, "Error while fetching prune status")
+	testutil.AssertEquals(t, prunedBelow, uint64(2))
+	testutil.AssertEquals(t, target, uint64(4))
+
+	// simulate a restart before resuming the prune
+	testBlockchainWrapper.blockchain.indexer.stop()
+	testDBWrapper.CloseDB(t)
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	done, err = pruneIndexesBelow(4, 2, 0)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	testutil.AssertEquals(t, done, true)
+	prunedBelow, target, err = pruneStatus()
+	testutil.AssertNoError(t, err, "Error while fetching prune status")
+	testutil.AssertEquals(t, prunedBelow, uint64(4))
+	testutil.AssertEquals(t, target, uint64(4))
+
+	for i := 0; i < 4; i++ {
+		blockHash, _ := blocks[i].GetHash()
+		_, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+		testutil.AssertError(t, err, "Pruned block should not be found by hash")
+		_, _, err = fetchTransactionIndexByUUIDFromDB(uuids[i])
+		testutil.AssertSame(t, err, ErrResourceNotFound)
+	}
+	blockHash, _ := blocks[4].GetHash()
+	testutil.AssertEquals(t, testBlockchainWrapper.getBlockByHash(blockHash), blocks[4])
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuids[4]), blocks[4].Transactions[0])
+	txs, _, err := fetchTransactionsBySizeRange(0, math.MaxUint64, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by size")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{4, 0}})
+}
+
+func TestIndexes_FetchTypeBlockRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	for i := 0; i < 12; i++ {
+		tx, _ := buildTestTx(t)
+		tx.Type = protos.Transaction_CHAINCODE_INVOKE
+		transactions := []*protos.Transaction{tx}
+		if i == 3 || i == 9 {
+			deployTx, _ := buildTestTx(t)
+			deployTx.Type = protos.Transaction_CHAINCODE_DEPLOY
+			transactions = append(transactions, deployTx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	firstBlock, lastBlock, err := fetchTypeBlockRange(protos.Transaction_CHAINCODE_DEPLOY)
+	testutil.AssertNoError(t, err, "Error while fetching block range for type")
+	testutil.AssertEquals(t, firstBlock, uint64(3))
+	testutil.AssertEquals(t, lastBlock, uint64(9))
+
+	firstBlock, lastBlock, err = fetchTypeBlockRange(protos.Transaction_CHAINCODE_INVOKE)
+	testutil.AssertNoError(t, err, "Error while fetching block range for type")
+	testutil.AssertEquals(t, firstBlock, uint64(0))
+	testutil.AssertEquals(t, lastBlock, uint64(11))
+
+	_, _, err = fetchTypeBlockRange(protos.Transaction_CHAINCODE_TERMINATE)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+}
+
+func TestIndexes_FetchTransactionIndexesByTypeInBlock(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	txTypes := [][]protos.Transaction_Type{
+		{protos.Transaction_CHAINCODE_DEPLOY},
+		{protos.Transaction_CHAINCODE_INVOKE, protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE,
+			protos.Transaction_CHAINCODE_QUERY, protos.Transaction_CHAINCODE_INVOKE},
+		{protos.Transaction_CHAINCODE_INVOKE},
+	}
+	for i, blockTxTypes := range txTypes {
+		var transactions []*protos.Transaction
+		for _, txType := range blockTxTypes {
+			tx, _ := buildTestTx(t)
+			tx.Type = txType
+			transactions = append(transactions, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	txIndexes, truncated, err := fetchTransactionIndexesByTypeInBlock(1, protos.Transaction_CHAINCODE_INVOKE, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, txIndexes, []uint64{0, 2, 4})
+
+	txIndexes, _, err = fetchTransactionIndexesByTypeInBlock(1, protos.Transaction_CHAINCODE_DEPLOY, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type")
+	testutil.AssertEquals(t, txIndexes, []uint64{1})
+
+	txIndexes, _, err = fetchTransactionIndexesByTypeInBlock(1, protos.Transaction_CHAINCODE_TERMINATE, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type")
+	testutil.AssertNil(t, txIndexes)
+
+	txIndexes, truncated, err = fetchTransactionIndexesByTypeInBlock(1, protos.Transaction_CHAINCODE_INVOKE, newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, txIndexes, []uint64{0, 2})
+}
+
+func TestIndexes_FetchTransactionIndexesByTypeInRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	deploy, invoke := protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE
+	txTypes := [][]protos.Transaction_Type{
+		{deploy},
+		{invoke, deploy, deploy},
+		{invoke},
+		{deploy, invoke},
+		{invoke},
+		{deploy},
+	}
+	for i, blockTxTypes := range txTypes {
+		var transactions []*protos.Transaction
+		for _, txType := range blockTxTypes {
+			tx, _ := buildTestTx(t)
+			tx.Type = txType
+			transactions = append(transactions, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	txLocations, truncated, err := fetchTransactionIndexesByTypeInRange(deploy, 1, 4, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type in range")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{1, 1}, {1, 2}, {3, 0}})
+
+	txLocations, _, err = fetchTransactionIndexesByTypeInRange(deploy, 2, 2, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type in range")
+	testutil.AssertNil(t, txLocations)
+
+	txLocations, _, err = fetchTransactionIndexesByTypeInRange(deploy, 5, math.MaxUint64, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type in range")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{5, 0}})
+
+	txLocations, truncated, err = fetchTransactionIndexesByTypeInRange(deploy, 0, 5, newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching transaction indexes by type in range")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}, {1, 1}})
+
+	_, _, err = fetchTransactionIndexesByTypeInRange(deploy, 3, 1, testScanLimits)
+	testutil.AssertError(t, err, "Expected an error for an invalid block range")
+}
+
+func TestIndexes_TxTypeReverseCursor(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	deploy, invoke := protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE
+	txTypes := [][]protos.Transaction_Type{
+		{deploy},
+		{invoke, deploy, deploy},
+		{invoke},
+		{deploy, invoke},
+		{invoke},
+	}
+	for i, blockTxTypes := range txTypes {
+		var transactions []*protos.Transaction
+		for _, txType := range blockTxTypes {
+			tx, _ := buildTestTx(t)
+			tx.Type = txType
+			transactions = append(transactions, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(transactions, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	collect := func(txType protos.Transaction_Type) []*TransactionLocation {
+		cursor, err := newTxTypeReverseCursor(txType)
+		testutil.AssertNoError(t, err, "Error while creating the reverse cursor")
+		defer cursor.Close()
+		var txLocations []*TransactionLocation
+		for txLocation, ok := cursor.Next(); ok; txLocation, ok = cursor.Next() {
+			txLocations = append(txLocations, txLocation)
+		}
+		testutil.AssertNoError(t, cursor.Err(), "Error while iterating the reverse cursor")
+		return txLocations
+	}
+	testutil.AssertEquals(t, collect(deploy), []*TransactionLocation{{3, 0}, {1, 2}, {1, 1}, {0, 0}})
+	testutil.AssertEquals(t, collect(invoke), []*TransactionLocation{{4, 0}, {3, 1}, {2, 0}, {1, 0}})
+	testutil.AssertNil(t, collect(protos.Transaction_CHAINCODE_QUERY))
+
+	cursor, err := newTxTypeReverseCursor(deploy)
+	testutil.AssertNoError(t, err, "Error while creating the reverse cursor")
+	_, ok := cursor.Next()
+	testutil.AssertEquals(t, ok, true)
+	cursor.Close()
+	cursor.Close()
+	_, ok = cursor.Next()
+	testutil.AssertEquals(t, ok, false)
+
+	defaultLittleEndian := indexKeysLittleEndian
+	indexKeysLittleEndian = true
+	setIndexByteOrderFromConfig()
+	defer func() {
+		indexKeysLittleEndian = defaultLittleEndian
+		setIndexByteOrderFromConfig()
+	}()
+	_, err = newTxTypeReverseCursor(deploy)
+	testutil.AssertError(t, err, "Expected an error for little-endian index keys")
+}
+
+func TestIndexes_RepairOrphanedAddressEntries(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	_, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+	if err != nil {
+		t.Fatalf("Error populating block chain with sample data: %s", err)
+	}
+
+	openchainDB := db.GetDBHandle()
+	orphanedKey := encodeAddressBlockNumCompositeKey("address1", 100)
+	err = openchainDB.Put(openchainDB.IndexesCF, orphanedKey, encodeListTxIndexes([]uint64{0}))
+	testutil.AssertNoError(t, err, "Error while seeding orphaned entry")
+
+	repaired, err := repairOrphanedAddressEntries()
+	testutil.AssertNoError(t, err, "Error while repairing orphaned entries")
+	testutil.AssertEquals(t, repaired, uint64(1))
+	value, _ := openchainDB.GetFromIndexesCF(orphanedKey)
+	testutil.AssertNil(t, value)
+	value, _ = openchainDB.GetFromIndexesCF(encodeAddressBlockNumCompositeKey("address1", 2))
+	testutil.AssertNotNil(t, value)
+
+	repaired, err = repairOrphanedAddressEntries()
+	testutil.AssertNoError(t, err, "Error while repairing orphaned entries")
+	testutil.AssertEquals(t, repaired, uint64(0))
+}
+
+func TestIndexes_FetchTransactionIndexesByAddressAndTimeRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	buildTxAt := func(seconds int64) *protos.Transaction {
+		tx, _ := buildTestTx(t)
+		tx.Timestamp = &google_protobuf.Timestamp{Seconds: seconds}
+		return tx
+	}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{buildTxAt(1000), buildTxAt(2000)}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{buildTxAt(3000)}, nil), []byte("stateHash2"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{buildTxAt(4000), buildTxAt(5000)}, nil), []byte("stateHash3"))
+
+	txs, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txs), 5)
+
+	txs, _, err = fetchTransactionIndexesByAddressAndTimeRange("address1", 2000, 4500, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address and time range")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 1}, {1, 0}, {2, 0}})
+
+	txs, _, err = fetchTransactionIndexesByAddressAndTimeRange("address1", 6000, 7000, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address and time range")
+	testutil.AssertEquals(t, len(txs), 0)
+
+	txs, _, err = fetchTransactionIndexesByAddressAndTimeRange("unknownAddress", 0, 7000, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address and time range")
+	testutil.AssertEquals(t, len(txs), 0)
+
+	// the limit applies to the transactions within the time range
+	txs, truncated, err := fetchTransactionIndexesByAddressAndTimeRange("address1", 3000, 6000, newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address and time range")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{1, 0}, {2, 0}})
+	testutil.AssertEquals(t, truncated, true)
+
+	// an entry referring to a transaction beyond the end of its block is reported as an error
+	key := encodeAddressBlockNumCompositeKey("address2", 0)
+	err = db.GetDBHandle().Put(indexCFForKey(key), key, encodeIndexValue(encodeListTxIndexes([]uint64{5})))
+	testutil.AssertNoError(t, err, "Error while writing the index entry")
+	_, _, err = fetchTransactionIndexesByAddressAndTimeRange("address2", 0, 7000, testScanLimits)
+	testutil.AssertError(t, err, "Error expected for an out of range transaction index")
+}
+
+func TestIndexes_AppendAddressTxIndexesConcurrently(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	numGoroutines := 10
+	appendsPerGoroutine := 20
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < appendsPerGoroutine; j++ {
+				txIndex := uint64(i*appendsPerGoroutine + j)
+				if err := appendAddressTxIndexes("address1", 5, []uint64{txIndex}); err != nil {
+					t.Errorf("Error while appending tx index [%d]: %s", txIndex, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	txs, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txs), numGoroutines*appendsPerGoroutine)
+	seen := make(map[uint64]bool)
+	for _, tx := range txs {
+		testutil.AssertEquals(t, tx.BlockNumber, uint64(5))
+		seen[tx.TxIndex] = true
+	}
+	testutil.AssertEquals(t, len(seen), numGoroutines*appendsPerGoroutine)
+
+	// appending an existing tx index does not duplicate it
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 5, []uint64{0}), "Error while appending tx index")
+	txs, _, err = fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txs), numGoroutines*appendsPerGoroutine)
+}
+
+func TestIndexes_AppendToListValueConcurrently(t *testing.T) {
+	defaultMax := indexMaxAddressTxIndexes
+	indexMaxAddressTxIndexes = 4
+	defer func() { indexMaxAddressTxIndexes = defaultMax }()
+	testDBWrapper.CleanDB(t)
+
+	// each goroutine appends its own tx indexes and one shared by all of them, in descending order
+	numGoroutines := 8
+	appendsPerGoroutine := 10
+	key := encodeAddressBlockNumCompositeKey("address1", 3)
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := appendsPerGoroutine - 1; j >= 0; j-- {
+				txIndexes := []uint64{uint64(1000 + i*appendsPerGoroutine + j), uint64(j)}
+				if err := appendToListValue(key, txIndexes, nil); err != nil {
+					t.Errorf("Error while appending tx indexes %v: %s", txIndexes, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var expected []uint64
+	for j := 0; j < appendsPerGoroutine; j++ {
+		expected = append(expected, uint64(j))
+	}
+	for i := 0; i < numGoroutines*appendsPerGoroutine; i++ {
+		expected = append(expected, uint64(1000+i))
+	}
+	value, err := getIndexValue(key)
+	testutil.AssertNoError(t, err, "Error while reading tx indexes")
+	value, err = decodeIndexValue(value)
+	testutil.AssertNoError(t, err, "Error while decoding tx indexes")
+	head, err := decodeListTxIndexes(value)
+	testutil.AssertNoError(t, err, "Error while decoding tx indexes")
+	testutil.AssertEquals(t, head, expected[:indexMaxAddressTxIndexes])
+	itr := newIndexIterator(prefixAddressTxIndexesContinuationKey)
+	continuations, err := fetchAddressTxIndexesContinuations(itr, key)
+	itr.Close()
+	testutil.AssertNoError(t, err, "Error while reading continuation tx indexes")
+	testutil.AssertEquals(t, append(head, continuations...), expected)
+
+	// a key without continuations
+	otherKey := encodeTxCountBlockNumCompositeKey(10, 3)
+	testutil.AssertNoError(t, appendToListValue(otherKey, []uint64{9, 2, 9, 5, 1, 7}, nil), "Error while appending tx indexes")
+	testutil.AssertNoError(t, appendToListValue(otherKey, []uint64{5, 3}, nil), "Error while appending tx indexes")
+	value, err = getIndexValue(otherKey)
+	testutil.AssertNoError(t, err, "Error while reading tx indexes")
+	value, err = decodeIndexValue(value)
+	testutil.AssertNoError(t, err, "Error while decoding tx indexes")
+	testutil.AssertEquals(t, value, encodeListTxIndexes([]uint64{1, 2, 3, 5, 7, 9}))
+}
+
+func TestIndexes_StoredTxIndexesAscending(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 5, []uint64{7, 2}), "Error while appending tx indexes")
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 5, []uint64{300, 0, 5}), "Error while appending tx indexes")
+
+	value, err := db.GetDBHandle().GetFromIndexesCF(encodeAddressBlockNumCompositeKey("address1", 5))
+	testutil.AssertNoError(t, err, "Error while reading tx indexes")
+	value, err = decodeIndexValue(value)
+	testutil.AssertNoError(t, err, "Error while decoding tx indexes")
+	testutil.AssertEquals(t, value, []byte{0, 2, 5, 7, 0xac, 0x02})
+
+	listTx := []uint64{3, 1, 2}
+	testutil.AssertEquals(t, encodeListTxIndexes(listTx), []byte{1, 2, 3})
+	testutil.AssertEquals(t, listTx, []uint64{3, 1, 2})
+}
+
+func TestIndexes_DerivedTxUUID(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	txWithUUID, uuid := buildTestTx(t)
+	txWithoutUUID1, _ := buildTestTx(t)
+	txWithoutUUID1.Uuid = ""
+	txWithoutUUID2, _ := buildTestTx(t)
+	txWithoutUUID2.Uuid = ""
+	txWithoutUUID2.Payload = []byte("another payload")
+
+	derivedUUID1, err := getTxUUIDForIndex(txWithoutUUID1)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	derivedUUID2, err := getTxUUIDForIndex(txWithoutUUID2)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	testutil.AssertNotEquals(t, derivedUUID1, derivedUUID2)
+	testutil.AssertNotEquals(t, derivedUUID1, "")
+
+	// the derived uuid is stable and the explicit uuid is used as is
+	txCopy := *txWithoutUUID1
+	derivedUUID1Again, err := getTxUUIDForIndex(&txCopy)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	testutil.AssertEquals(t, derivedUUID1Again, derivedUUID1)
+	explicitUUID, err := getTxUUIDForIndex(txWithUUID)
+	testutil.AssertNoError(t, err, "Error getting tx uuid")
+	testutil.AssertEquals(t, explicitUUID, uuid)
+
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{txWithUUID, txWithoutUUID1, txWithoutUUID2}, nil), []byte("stateHash0"))
+	for txIndex, txUUID := range []string{uuid, derivedUUID1, derivedUUID2} {
+		txLocation, err := fetchTransactionLocationByUUIDFromDB(txUUID)
+		testutil.AssertNoError(t, err, "Error fetching transaction location")
+		testutil.AssertEquals(t, *txLocation, TransactionLocation{0, uint64(txIndex)})
+	}
+}
+
+func TestIndexes_CanonicalMarshalTransaction(t *testing.T) {
+	tx, _ := buildTestTx(t)
+	tx.Uuid = ""
+	txBytes1, err := canonicalMarshalTransaction(tx)
+	testutil.AssertNoError(t, err, "Error marshalling transaction")
+	txBytes2, err := canonicalMarshalTransaction(tx)
+	testutil.AssertNoError(t, err, "Error marshalling transaction")
+	testutil.AssertEquals(t, txBytes1, txBytes2)
+	derivedUUID1, err := getTxUUIDForIndex(tx)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	derivedUUID2, err := getTxUUIDForIndex(tx)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	testutil.AssertEquals(t, derivedUUID1, derivedUUID2)
+
+	// a nil and a zero timestamp serialize the same, and the transaction itself is left as is
+	txWithoutTimestamp := *tx
+	txWithoutTimestamp.Timestamp = nil
+	txWithZeroTimestamp := *tx
+	txWithZeroTimestamp.Timestamp = &google_protobuf.Timestamp{}
+	withoutTimestampBytes, err := canonicalMarshalTransaction(&txWithoutTimestamp)
+	testutil.AssertNoError(t, err, "Error marshalling transaction")
+	zeroTimestampBytes, err := canonicalMarshalTransaction(&txWithZeroTimestamp)
+	testutil.AssertNoError(t, err, "Error marshalling transaction")
+	testutil.AssertEquals(t, zeroTimestampBytes, withoutTimestampBytes)
+	testutil.AssertNotNil(t, txWithZeroTimestamp.Timestamp)
+	derivedUUID1, err = getTxUUIDForIndex(&txWithoutTimestamp)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	derivedUUID2, err = getTxUUIDForIndex(&txWithZeroTimestamp)
+	testutil.AssertNoError(t, err, "Error deriving tx uuid")
+	testutil.AssertEquals(t, derivedUUID1, derivedUUID2)
+}
+
+func TestIndexes_FetchBlocksByProposer(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getBlockProposer
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getBlockProposer = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// for the test, the proposer is carried in the consensus metadata of the block
+	getBlockProposer = func(block *protos.Block) string {
+		return string(block.ConsensusMetadata)
+	}
+
+	proposers := []string{"validator1", "validator2", "validator1", "", "validator2", "validator1"}
+	for i, proposer := range proposers {
+		tx, _ := buildTestTx(t)
+		block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+		block.ConsensusMetadata = []byte(proposer)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	blockNumbers, _, err := fetchBlocksByProposer("validator1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching blocks by proposer")
+	testutil.AssertEquals(t, blockNumbers, []uint64{0, 2, 5})
+
+	blockNumbers, _, err = fetchBlocksByProposer("validator2", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching blocks by proposer")
+	testutil.AssertEquals(t, blockNumbers, []uint64{1, 4})
+
+	blockNumbers, _, err = fetchBlocksByProposer("validator3", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching blocks by proposer")
+	testutil.AssertEquals(t, len(blockNumbers), 0)
+}
+
+func TestIndexes_FetchTransactionLocationByUUID(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+	tx2, _ := buildTestTx(t)
+	tx3, uuid3 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx2, tx3}, nil), []byte("stateHash2"))
+
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid3)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation.BlockNumber, uint64(1))
+	testutil.AssertEquals(t, txLocation.TxIndex, uint64(1))
+
+	blockNumber, txIndex, err := fetchTransactionIndexByUUIDFromDB(uuid3)
+	testutil.AssertNoError(t, err, "Error while fetching transaction index")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+	testutil.AssertEquals(t, txIndex, uint64(1))
+
+	_, err = fetchTransactionLocationByUUIDFromDB("unknown-uuid")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	_, _, err = fetchTransactionIndexByUUIDFromDB("unknown-uuid")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+}
+
+func TestIndexes_ValueChecksums(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultChecksums := indexValueChecksums
+	indexValueChecksums = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexValueChecksums = defaultChecksums
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil)
+	testBlockchainWrapper.addNewBlock(block, []byte("stateHash1"))
+	blockHash, _ := block.GetHash()
+
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{0, 1})
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+	txs, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 0}, {0, 1}})
+
+	// flip a byte of the stored values and verify that the reads detect the corruption
+	corrupt := func(key []byte) {
+		openchainDB := db.GetDBHandle()
+		value, err := openchainDB.GetFromIndexesCF(key)
+		testutil.AssertNoError(t, err, "Error while reading index value")
+		value[1] ^= 0xff
+		opt := gorocksdb.NewDefaultWriteOptions()
+		defer opt.Destroy()
+		testutil.AssertNoError(t, openchainDB.DB.PutCF(opt, openchainDB.IndexesCF, key, value), "Error while writing index value")
+	}
+	corrupt(encodeTxUUIDKey(uuid1))
+	_, err = fetchTransactionLocationByUUIDFromDB(uuid1)
+	testutil.AssertError(t, err, "Expected corruption to be detected for the uuid index")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "corrupted"), true)
+
+	corrupt(encodeBlockHashKey(blockHash))
+	_, err = fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertError(t, err, "Expected corruption to be detected for the block hash index")
+	cursor := newBlockHashCursor()
+	_, _, ok := cursor.Next()
+	testutil.AssertEquals(t, ok, false)
+	testutil.AssertError(t, cursor.Err(), "Expected corruption to be detected by the block hash cursor")
+	cursor.Close()
+
+	corrupt(encodeAddressBlockNumCompositeKey("address1", 0))
+	_, _, err = fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertError(t, err, "Expected corruption to be detected for the address index")
+}
+
+func TestIndexes_FetchRecentTransactions(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	txs, err := fetchRecentTransactions(3)
+	testutil.AssertNoError(t, err, "Error while fetching recent transactions on an empty chain")
+	testutil.AssertEquals(t, len(txs), 0)
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(nil, nil), []byte("stateHash2"))
+	tx3, uuid3 := buildTestTx(t)
+	tx4, uuid4 := buildTestTx(t)
+	tx5, uuid5 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx3, tx4, tx5}, nil), []byte("stateHash3"))
+
+	uuidsOf := func(txs []*protos.Transaction) []string {
+		var uuids []string
+		for _, tx := range txs {
+			uuids = append(uuids, tx.Uuid)
+		}
+		return uuids
+	}
+
+	txs, err = fetchRecentTransactions(2)
+	testutil.AssertNoError(t, err, "Error while fetching recent transactions")
+	testutil.AssertEquals(t, uuidsOf(txs), []string{uuid5, uuid4})
+
+	txs, err = fetchRecentTransactions(4)
+	testutil.AssertNoError(t, err, "Error while fetching recent transactions")
+	testutil.AssertEquals(t, uuidsOf(txs), []string{uuid5, uuid4, uuid3, uuid2})
+
+	// fewer transactions on the chain than requested
+	txs, err = fetchRecentTransactions(10)
+	testutil.AssertNoError(t, err, "Error while fetching recent transactions")
+	testutil.AssertEquals(t, uuidsOf(txs), []string{uuid5, uuid4, uuid3, uuid2, uuid1})
+}
+
+func TestIndexes_FetchRecentTransactionUUIDs(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	uuids, err := fetchRecentTransactionUUIDs(3)
+	testutil.AssertNoError(t, err, "Error while fetching recent transaction uuids on an empty chain")
+	testutil.AssertEquals(t, len(uuids), 0)
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(nil, nil), []byte("stateHash2"))
+	tx3, uuid3 := buildTestTx(t)
+	tx4, uuid4 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx3, tx4}, nil), []byte("stateHash3"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(nil, nil), []byte("stateHash4"))
+
+	uuids, err = fetchRecentTransactionUUIDs(3)
+	testutil.AssertNoError(t, err, "Error while fetching recent transaction uuids")
+	testutil.AssertEquals(t, uuids, []string{uuid4, uuid3, uuid2})
+
+	// fewer transactions on the chain than requested
+	uuids, err = fetchRecentTransactionUUIDs(10)
+	testutil.AssertNoError(t, err, "Error while fetching recent transaction uuids")
+	testutil.AssertEquals(t, uuids, []string{uuid4, uuid3, uuid2, uuid1})
+
+	uuids, err = fetchRecentTransactionUUIDs(0)
+	testutil.AssertNoError(t, err, "Error while fetching no recent transaction uuids")
+	testutil.AssertEquals(t, len(uuids), 0)
+
+	// a transaction without uuid is listed under the uuid derived for the index
+	tx5, _ := buildTestTx(t)
+	tx5.Uuid = ""
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx5}, nil), []byte("stateHash5"))
+	uuid5, err := getTxUUIDForIndex(tx5)
+	testutil.AssertNoError(t, err, "Error while deriving the uuid of the transaction")
+	uuids, err = fetchRecentTransactionUUIDs(2)
+	testutil.AssertNoError(t, err, "Error while fetching recent transaction uuids")
+	testutil.AssertEquals(t, uuids, []string{uuid5, uuid4})
+	_, err = fetchTransactionLocationByUUIDFromDB(uuid5)
+	testutil.AssertNoError(t, err, "Error while looking up the listed uuid")
+}
+
+func TestIndexes_FetchTransactionIndexesByAddressSorted(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 2, []uint64{5, 1}), "Error while appending tx indexes")
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 300, []uint64{0}), "Error while appending tx indexes")
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 2, []uint64{3}), "Error while appending tx indexes")
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 1, []uint64{4, 0}), "Error while appending tx indexes")
+	testutil.AssertNoError(t, appendAddressTxIndexes("address1", 200, []uint64{2}), "Error while appending tx indexes")
+
+	txs, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{1, 0}, {1, 4}, {2, 1}, {2, 3}, {2, 5}, {200, 2}, {300, 0}})
+}
+
+func TestIndexes_CountBlocksForAddress(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	for _, blockNumber := range []uint64{1, 2, 200, 300} {
+		testutil.AssertNoError(t, appendAddressTxIndexes("address1", blockNumber, []uint64{0, 1}), "Error while appending tx indexes")
+	}
+	testutil.AssertNoError(t, appendAddressTxIndexes("address10", 2, []uint64{0}), "Error while appending tx indexes")
+
+	count, err := countBlocksForAddress("address1")
+	testutil.AssertNoError(t, err, "Error while counting the blocks of the address")
+	testutil.AssertEquals(t, count, uint64(4))
+	count, err = countBlocksForAddress("address10")
+	testutil.AssertNoError(t, err, "Error while counting the blocks of the address")
+	testutil.AssertEquals(t, count, uint64(1))
+	count, err = countBlocksForAddress("unknown")
+	testutil.AssertNoError(t, err, "Error while counting the blocks of the address")
+	testutil.AssertEquals(t, count, uint64(0))
+}
+
+func TestIndexes_FetchExecutingAddresses(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+
+	addresses, err := fetchExecutingAddresses(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching executing addresses")
+	testutil.AssertEquals(t, addresses, []string{"address1"})
+	addresses, err = fetchExecutingAddresses(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching executing addresses")
+	testutil.AssertEquals(t, addresses, []string{"address1"})
+
+	_, err = fetchExecutingAddresses("unknown-uuid")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	decodedAddresses, err := decodeAddressList(encodeAddressList([]string{"address1", "", "address2"}))
+	testutil.AssertNoError(t, err, "Error while decoding list of addresses")
+	testutil.AssertEquals(t, decodedAddresses, []string{"address1", "", "address2"})
+}
+
+func TestIndexes_LongAddressesHashedInKeys(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultMaxAddressLength := indexMaxAddressLength
+	indexMaxAddressLength = 4
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexMaxAddressLength = defaultMaxAddressLength
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash1"))
+
+	// the executing address "address1" is over-length and the key uses its digest
+	digest := string(indexHasher.Hash([]byte("address1")))
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	prefix := newIndexKey(prefixAddressBlockNumCompositeKey)
+	itr.Seek(prefix)
+	testutil.AssertEquals(t, itr.ValidForPrefix(prefix), true)
+	keyAddress, blockNumber, err := decodeAddressBlockNumCompositeKey(statemgmt.Copy(itr.Key().Data()))
+	testutil.AssertNoError(t, err, "Error while decoding address key")
+	testutil.AssertEquals(t, keyAddress, digest)
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+
+	fullAddress, err := resolveKeyAddress(keyAddress)
+	testutil.AssertNoError(t, err, "Error while resolving address")
+	testutil.AssertEquals(t, fullAddress, "address1")
+
+	txLocations, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}})
+
+	// an address within the limit is used as is and resolves to itself
+	testutil.AssertEquals(t, addressKeyForm("addr"), "addr")
+	fullAddress, err = resolveKeyAddress("addr")
+	testutil.AssertNoError(t, err, "Error while resolving address")
+	testutil.AssertEquals(t, fullAddress, "addr")
+
+	// the mapping is not stored if disabled
+	defaultStoreSetting := indexStoreFullAddresses
+	indexStoreFullAddresses = false
+	defer func() { indexStoreFullAddresses = defaultStoreSetting }()
+	certificate := strings.Repeat("certificate", 100)
+	err = appendAddressTxIndexes(certificate, 0, []uint64{0})
+	testutil.AssertNoError(t, err, "Error while appending tx indexes")
+	txLocations, _, err = fetchTransactionIndexesByAddress(certificate, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}})
+	fullAddress, err = resolveKeyAddress(addressKeyForm(certificate))
+	testutil.AssertNoError(t, err, "Error while resolving address")
+	testutil.AssertEquals(t, fullAddress, addressKeyForm(certificate))
+}
+
+func TestIndexes_FetchExecutingAddressesMultiAddress(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getTxExecutingAddresses
+	executingAddresses := make(map[string][]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return executingAddresses[tx.Uuid]
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	executingAddresses[uuid1] = []string{"addressA", "addressB"}
+	executingAddresses[uuid2] = []string{"addressB"}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+
+	addresses, err := fetchExecutingAddresses(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching executing addresses")
+	testutil.AssertEquals(t, addresses, []string{"addressA", "addressB"})
+
+	// the transaction is indexed under each of its executing addresses
+	txLocations, _, err := fetchTransactionIndexesByAddress("addressA", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}})
+	txLocations, _, err = fetchTransactionIndexesByAddress("addressB", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}, {0, 1}})
+	blockAddresses, _, err := fetchAddressesInBlock(0, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+	testutil.AssertEquals(t, blockAddresses, []string{"addressA", "addressB"})
+
+	// the entries of all the addresses are removed with the block
+	_, err = pruneIndexesBelow(1, 1, 0)
+	testutil.AssertNoError(t, err, "Error while pruning the indexes")
+	txLocations, _, err = fetchTransactionIndexesByAddress("addressA", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txLocations), 0)
+}
+
+func TestIndexes_FetchAddressesInBlock(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getTxExecutingAddresses
+	executingAddresses := make(map[string]string)
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		return []string{executingAddresses[tx.Uuid]}
+	}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var txs []*protos.Transaction
+	for _, address := range []string{"addressC", "addressA", "addressB", "addressA"} {
+		tx, uuid := buildTestTx(t)
+		executingAddresses[uuid] = address
+		txs = append(txs, tx)
+	}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(txs, nil), []byte("stateHash1"))
+	tx, uuid := buildTestTx(t)
+	executingAddresses[uuid] = "addressD"
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash2"))
+
+	addresses, _, err := fetchAddressesInBlock(0, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+	testutil.AssertEquals(t, addresses, []string{"addressA", "addressB", "addressC"})
+	addresses, _, err = fetchAddressesInBlock(1, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+	testutil.AssertEquals(t, addresses, []string{"addressD"})
+	addresses, _, err = fetchAddressesInBlock(2, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching addresses in block")
+	testutil.AssertEquals(t, len(addresses), 0)
+}
+
+func TestIndexes_AddressLatestBlockOnly(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultModeSetting := indexAddressLatestBlockOnly
+	indexAddressLatestBlockOnly = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexAddressLatestBlockOnly = defaultModeSetting
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	for i := 0; i < 3; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	blockNumber, err := fetchLatestActivityBlock("address1")
+	testutil.AssertNoError(t, err, "Error while fetching latest activity block")
+	testutil.AssertEquals(t, blockNumber, uint64(2))
+	_, err = fetchLatestActivityBlock("unknownAddress")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	// the history of the address is not retained
+	txs, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, len(txs), 0)
+}
+
+func TestIndexes_VerifyUniqueTxUUIDs(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultVerifySetting := indexVerifyUniqueTxUUIDs
+	indexVerifyUniqueTxUUIDs = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexVerifyUniqueTxUUIDs = defaultVerifySetting
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	tx1, uuid1 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+
+	// re-indexing a transaction at the same location is not a collision
+	block, err := testBlockchainWrapper.blockchain.getBlock(0)
+	testutil.AssertNoError(t, err, "Error while fetching block")
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	testutil.AssertNoError(t, addIndexDataForPersistence(block, 0, []byte("blockHash"), writeBatch), "Error while re-indexing block")
+
+	// same uuid in a different block
+	tx2, _ := buildTestTx(t)
+	tx2.Uuid = uuid1
+	_, err = testBlockchainWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx2}, nil), []byte("stateHash2"), writeBatch)
+	testutil.AssertError(t, err, "Expected an error for a duplicate transaction uuid across blocks")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "Already indexed at block [0] index [0]"), true)
+
+	// same uuid twice in a block
+	tx3, uuid3 := buildTestTx(t)
+	tx4, _ := buildTestTx(t)
+	tx4.Uuid = uuid3
+	err = addIndexDataForPersistence(protos.NewBlock([]*protos.Transaction{tx3, tx4}, nil), 1, []byte("blockHash1"), writeBatch)
+	testutil.AssertError(t, err, "Expected an error for a duplicate transaction uuid within a block")
+}
+
+func TestIndexes_FetchBlockByGlobalTxOrdinal(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	_, err := fetchBlockByGlobalTxOrdinal(0)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	// blocks with 2, 0, 3 and 1 transactions
+	for i, numTxs := range []int{2, 0, 3, 1} {
+		var txs []*protos.Transaction
+		for j := 0; j < numTxs; j++ {
+			tx, _ := buildTestTx(t)
+			txs = append(txs, tx)
+		}
+		testBlockchainWrapper.addNewBlock(protos.NewBlock(txs, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	for ordinal, expectedBlockNumber := range []uint64{0, 0, 2, 2, 2, 3} {
+		blockNumber, err := fetchBlockByGlobalTxOrdinal(uint64(ordinal))
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error while fetching block for ordinal [%d]", ordinal))
+		testutil.AssertEquals(t, blockNumber, expectedBlockNumber)
+	}
+	_, err = fetchBlockByGlobalTxOrdinal(6)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+	_, err = fetchBlockByGlobalTxOrdinal(math.MaxUint64)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+}
+
+func TestIndexes_TxCountsBackfilledOnStart(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultChunkBlocks := indexRebuildChunkBlocks
+	indexBlockDataSynchronously = true
+	indexRebuildChunkBlocks = 2
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexRebuildChunkBlocks = defaultChunkBlocks
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	addBlocks := func(numTxsPerBlock []int) {
+		for _, numTxs := range numTxsPerBlock {
+			var txs []*protos.Transaction
+			for j := 0; j < numTxs; j++ {
+				tx, _ := buildTestTx(t)
+				txs = append(txs, tx)
+			}
+			testBlockchainWrapper.addNewBlock(protos.NewBlock(txs, nil), []byte("stateHash"))
+		}
+	}
+	addBlocks([]int{2, 0, 3})
+
+	// a db indexed before the cumulative counts were introduced has none, and the blocks added later get none either
+	testutil.AssertNoError(t, deleteIndexEntries(prefixTxCountBlockNumCompositeKey), "Error while deleting the cumulative counts")
+	addBlocks([]int{1})
+	_, err := fetchBlockByGlobalTxOrdinal(0)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	// the counts are backfilled once the ledger is restarted
+	testBlockchainWrapper.blockchain.indexer.stop()
+	testDBWrapper.CloseDB(t)
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	addBlocks([]int{2})
+	for ordinal, expectedBlockNumber := range []uint64{0, 0, 2, 2, 2, 3, 4, 4} {
+		blockNumber, err := fetchBlockByGlobalTxOrdinal(uint64(ordinal))
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error while fetching block for ordinal [%d]", ordinal))
+		testutil.AssertEquals(t, blockNumber, expectedBlockNumber)
+	}
+	_, err = fetchBlockByGlobalTxOrdinal(8)
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+}
+
+func TestIndexes_BlockNumberOverwriteGuard(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultOverwriteSetting := indexAllowBlockNumberOverwrite
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexAllowBlockNumberOverwrite = defaultOverwriteSetting
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	chain := testBlockchainWrapper.blockchain
+
+	tx1, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1}, nil), []byte("stateHash1"))
+
+	// rewind the chain, so that a different block is added at the same height
+	chain.size = 0
+	tx2, _ := buildTestTx(t)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	_, err := chain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx2}, nil), []byte("stateHash2"), writeBatch)
+	testutil.AssertError(t, err, "Expected an error for indexing a different block at an indexed block number")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "Block number [0] is already indexed with block hash"), true)
+
+	indexAllowBlockNumberOverwrite = true
+	_, err = chain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx2}, nil), []byte("stateHash2"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while indexing a different block at an indexed block number with overwrite allowed")
+	chain.blockPersistenceStatus(false)
+}
+
+func TestIndexes_FetchTransactionsByMetadata(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultExtractor := getTxMetadataEntries
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		getTxMetadataEntries = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// for the test, the metadata of a transaction carries entries in the form "key1=value1;key2=value2"
+	getTxMetadataEntries = func(tx *protos.Transaction) map[string]string {
+		entries := make(map[string]string)
+		for _, entry := range strings.Split(string(tx.Metadata), ";") {
+			if keyValue := strings.SplitN(entry, "=", 2); len(keyValue) == 2 {
+				entries[keyValue[0]] = keyValue[1]
+			}
+		}
+		return entries
+	}
+
+	buildTxWithMetadata := func(metadata string) *protos.Transaction {
+		tx, _ := buildTestTx(t)
+		tx.Metadata = []byte(metadata)
+		return tx
+	}
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{
+		buildTxWithMetadata("invoiceId=123;customer=c1"),
+		buildTxWithMetadata(""),
+		buildTxWithMetadata("invoiceId=456")}, nil), []byte("stateHash1"))
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{
+		buildTxWithMetadata("customer=c1"),
+		buildTxWithMetadata("invoiceId=123")}, nil), []byte("stateHash2"))
+
+	txs, _, err := fetchTransactionsByMetadata("invoiceId", "123", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by metadata")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 0}, {1, 1}})
+
+	txs, _, err = fetchTransactionsByMetadata("customer", "c1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by metadata")
+	testutil.AssertEquals(t, txs, []*TransactionLocation{{0, 0}, {1, 0}})
+
+	txs, _, err = fetchTransactionsByMetadata("invoiceId", "12", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by metadata")
+	testutil.AssertEquals(t, len(txs), 0)
+}
+
+func TestIndexes_ComputePrefixUpperBound(t *testing.T) {
+	testutil.AssertEquals(t, computePrefixUpperBound([]byte{0x01}), []byte{0x02})
+	testutil.AssertEquals(t, computePrefixUpperBound([]byte{0x01, 0x02, 0x03}), []byte{0x01, 0x02, 0x04})
+	testutil.AssertEquals(t, computePrefixUpperBound([]byte{0x01, 0xFF}), []byte{0x02})
+	testutil.AssertEquals(t, computePrefixUpperBound([]byte{0x01, 0xFE, 0xFF, 0xFF}), []byte{0x01, 0xFF})
+	testutil.AssertNil(t, computePrefixUpperBound([]byte{0xFF}))
+	testutil.AssertNil(t, computePrefixUpperBound([]byte{0xFF, 0xFF}))
+	testutil.AssertNil(t, computePrefixUpperBound([]byte{}))
+
+	prefix := []byte{0x01, 0xFF}
+	computePrefixUpperBound(prefix)
+	testutil.AssertEquals(t, prefix, []byte{0x01, 0xFF})
+}
+
+func TestIndexes_FetchPreviousBlockHash(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	for _, synchronous := range []bool{true, false} {
+		indexBlockDataSynchronously = synchronous
+		testDBWrapper.CleanDB(t)
+		testBlockchainWrapper := newTestBlockchainWrapper(t)
+		blocks, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+		testutil.AssertNoError(t, err, "Error populating block chain with sample data")
+		if !synchronous {
+			err = testBlockchainWrapper.blockchain.indexer.(*blockchainIndexerAsync).indexerState.waitForLastCommittedBlock()
+			testutil.AssertNoError(t, err, "Error while waiting for the blocks to be indexed")
+		}
+
+		previousBlockHash, err := fetchPreviousBlockHash(0)
+		testutil.AssertNoError(t, err, "Error while fetching the previous block hash of the genesis block")
+		testutil.AssertNil(t, previousBlockHash)
+		for blockNumber := 1; blockNumber < len(blocks); blockNumber++ {
+			parentHash, err := testBlockchainWrapper.getBlock(uint64(blockNumber - 1)).GetHash()
+			testutil.AssertNoError(t, err, "Error while computing the block hash")
+			previousBlockHash, err = fetchPreviousBlockHash(uint64(blockNumber))
+			testutil.AssertNoError(t, err, "Error while fetching the previous block hash")
+			testutil.AssertEquals(t, previousBlockHash, parentHash)
+		}
+		_, err = fetchPreviousBlockHash(uint64(len(blocks)))
+		testutil.AssertError(t, err, "Expected an error for a block that is not indexed")
+		testBlockchainWrapper.blockchain.indexer.stop()
+	}
+}
+
+func TestIndexes_GetTransactionByUUIDFailureModes(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	tx, uuid := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash1"))
+	assertErrorType := func(txUUID string, errType ErrorType) {
+		_, err := testBlockchainWrapper.blockchain.getTransactionByUUID(txUUID)
+		testutil.AssertError(t, err, fmt.Sprintf("Expected an error for transaction [%s]", txUUID))
+		ledgerError, ok := err.(*Error)
+		testutil.AssertEquals(t, ok, true)
+		testutil.AssertEquals(t, ledgerError.Type(), errType)
+	}
+
+	// the uuid is not indexed
+	_, err := testBlockchainWrapper.blockchain.getTransactionByUUID("unknownUUID")
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	// the uuid is indexed in a block that is not present
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeTxUUIDKey("missingBlockUUID"),
+		encodeIndexValue(encodeBlockNumTxIndex(10, 0))), "Error while seeding the index")
+	assertErrorType("missingBlockUUID", ErrorTypeBlockLoadFailed)
+
+	// the indexed block cannot be decoded
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeTxUUIDKey("corruptBlockUUID"),
+		encodeIndexValue(encodeBlockNumTxIndex(11, 0))), "Error while seeding the index")
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.BlockchainCF, encodeBlockNumberDBKey(11), []byte{0xff, 0xff}),
+		"Error while seeding a corrupted block")
+	assertErrorType("corruptBlockUUID", ErrorTypeBlockLoadFailed)
+
+	// the uuid is indexed at a position beyond the transactions of the block
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeTxUUIDKey("outOfRangeUUID"),
+		encodeIndexValue(encodeBlockNumTxIndex(0, 1))), "Error while seeding the index")
+	assertErrorType("outOfRangeUUID", ErrorTypeOutOfBounds)
+
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid), tx)
+}
+
+func TestIndexes_VerifyFetchedTransactions(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultVerify := indexVerifyFetchedTransactions
+	indexBlockDataSynchronously = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexVerifyFetchedTransactions = defaultVerify
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+
+	// corrupt the index so that the uuid of the second transaction points to the first one
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeTxUUIDKey(uuid2),
+		encodeIndexValue(encodeBlockNumTxIndex(0, 0))), "Error while corrupting the index")
+
+	// without the check, the drift goes unnoticed
+	indexVerifyFetchedTransactions = false
+	fetchedTx, err := testBlockchainWrapper.blockchain.getTransactionByUUID(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching transaction by uuid")
+	testutil.AssertEquals(t, fetchedTx, tx1)
+
+	indexVerifyFetchedTransactions = true
+	_, err = testBlockchainWrapper.blockchain.getTransactionByUUID(uuid2)
+	testutil.AssertError(t, err, "Expected an error for a transaction indexed at the wrong position")
+	ledgerError, ok := err.(*Error)
+	testutil.AssertEquals(t, ok, true)
+	testutil.AssertEquals(t, ledgerError.Type(), ErrorTypeIndexMismatch)
+
+	fetchedTx, err = testBlockchainWrapper.blockchain.getTransactionByUUID(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching transaction by uuid")
+	testutil.AssertEquals(t, fetchedTx, tx1)
+}
+
+func TestIndexes_ValidateBlockTxIndexing(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	tx1, _ := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	tx3, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2, tx3}, nil), []byte("stateHash1"))
+
+	testutil.AssertNoError(t, validateBlockTxIndexing(0), "Error while validating a correctly indexed block")
+	err := validateBlockTxIndexing(1)
+	testutil.AssertError(t, err, "Expected an error for a missing block")
+
+	// the second transaction is indexed at the index of the first one
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, encodeTxUUIDKey(uuid2),
+		encodeIndexValue(encodeBlockNumTxIndex(0, 0))), "Error while corrupting the index")
+	err = validateBlockTxIndexing(0)
+	testutil.AssertError(t, err, "Expected an error for a duplicated index")
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "index [0] is covered by uuids"), true)
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "index [1] is not covered by any uuid"), true)
+	testutil.AssertEquals(t, strings.Contains(err.Error(), "index [2]"), false)
+}
+
+func TestIndexes_ConcurrentPointReads(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var blockHashes [][]byte
+	var uuids []string
+	for i := 0; i < 20; i++ {
+		var transactions []*protos.Transaction
+		for j := 0; j < 5; j++ {
+			tx, uuid := buildTestTx(t)
+			transactions = append(transactions, tx)
+			uuids = append(uuids, uuid)
+		}
+		block := protos.NewBlock(transactions, nil)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+		blockHash, _ := testBlockchainWrapper.getBlock(uint64(i)).GetHash()
+		blockHashes = append(blockHashes, blockHash)
+	}
+
+	// the returned values are copies that the caller owns, so changing one does not change the next read
+	value, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockHashKey(blockHashes[1]))
+	testutil.AssertNoError(t, err, "Error while reading the block hash entry")
+	for i := range value {
+		value[i] = 0xff
+	}
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHashes[1])
+	testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+
+	// many concurrent reads, each checked against the expected value
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				n := (g*31 + i) % len(uuids)
+				blockNumber, txIndex, err := fetchTransactionIndexByUUIDFromDB(uuids[n])
+				if err == nil && (blockNumber != uint64(n/5) || txIndex != uint64(n%5)) {
+					err = fmt.Errorf("Transaction [%s] fetched at [%d,%d] instead of [%d,%d]", uuids[n], blockNumber, txIndex, n/5, n%5)
+				}
+				if err == nil {
+					blockNumber, err = fetchBlockNumberByBlockHashFromDB(blockHashes[n/5])
+					if err == nil && blockNumber != uint64(n/5) {
+						err = fmt.Errorf("Block hash [%x] fetched at [%d] instead of [%d]", blockHashes[n/5], blockNumber, n/5)
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexes_FetchTransactionLocationsByUUIDs(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var uuids [][]string
+	for i := 0; i < 2; i++ {
+		tx1, uuid1 := buildTestTx(t)
+		tx2, uuid2 := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil),
+			[]byte(fmt.Sprintf("stateHash%d", i)))
+		uuids = append(uuids, []string{uuid1, uuid2})
+	}
+
+	// the uuids are requested out of order, with a repeated uuid and an unknown one
+	result, err := fetchTransactionLocationsByUUIDs([]string{uuids[1][1], "unknown", uuids[0][0], uuids[1][0],
+		uuids[0][1], uuids[0][0]})
+	testutil.AssertNoError(t, err, "Error while fetching transaction locations")
+	testutil.AssertEquals(t, result.BlockNumbers, []uint64{0, 1})
+	testutil.AssertEquals(t, result.TxUUIDsByBlock[0], uuids[0])
+	testutil.AssertEquals(t, result.TxUUIDsByBlock[1], uuids[1])
+	testutil.AssertEquals(t, result.NotFound, []string{"unknown"})
+	testutil.AssertEquals(t, len(result.Locations), 4)
+	for blockNumber, blockUUIDs := range uuids {
+		for txIndex, uuid := range blockUUIDs {
+			testutil.AssertEquals(t, result.Locations[uuid], &TransactionLocation{uint64(blockNumber), uint64(txIndex)})
+		}
+	}
+	_, found := result.Locations["unknown"]
+	testutil.AssertEquals(t, found, false)
+
+	result, err = fetchTransactionLocationsByUUIDs(nil)
+	testutil.AssertNoError(t, err, "Error while fetching transaction locations")
+	testutil.AssertEquals(t, len(result.BlockNumbers), 0)
+	testutil.AssertEquals(t, len(result.NotFound), 0)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	google_protobuf "google/protobuf"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// indexBlockTimestamps, when true, indexes the timestamp of each block as blockNumber -> timestamp and
+// (timestampSeconds,blockNumber), so that the time of a block and the blocks of a time range can be found
+// without loading the blocks. The blocks without a timestamp and the blocks indexed while it is off have no entries
+var indexBlockTimestamps = false
+
+// putBlockTimestampIndexes adds the timestamp entries of the block, if it has a timestamp
+func putBlockTimestampIndexes(block *protos.Block, blockNumber uint64, putIndex func(key []byte, value []byte)) error {
+	timestamp := block.GetTimestamp()
+	if !indexBlockTimestamps || timestamp == nil {
+		return nil
+	}
+	timestampBytes, err := proto.Marshal(timestamp)
+	if err != nil {
+		return err
+	}
+	putIndex(encodeBlockTimestampKey(blockNumber), timestampBytes)
+	putIndex(encodeTimestampBlockNumCompositeKey(timestamp.Seconds, blockNumber), []byte{})
+	return nil
+}
+
+// fetchBlockTimestamp returns the indexed timestamp of the given block, or nil if no timestamp is indexed for the block
+func fetchBlockTimestamp(blockNumber uint64) (*google_protobuf.Timestamp, error) {
+	timestampBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockTimestampKey(blockNumber))
+	if err != nil || timestampBytes == nil {
+		return nil, err
+	}
+	timestamp := &google_protobuf.Timestamp{}
+	if err := proto.Unmarshal(timestampBytes, timestamp); err != nil {
+		return nil, err
+	}
+	return timestamp, nil
+}
+
+// fetchBlocksByTimeRange returns the numbers of the blocks with a timestamp (in seconds) within [start, end),
+// ordered by timestamp and then by block number
+func fetchBlocksByTimeRange(start int64, end int64, limits scanLimits) ([]uint64, bool, error) {
+	if err := limits.validate(); err != nil {
+		return nil, false, err
+	}
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+
+	var result []uint64
+	prefix := newIndexKey(prefixTimestampBlockNumCompositeKey)
+	endKey := encodeTimestampKeyPrefix(end)
+	for itr.Seek(encodeTimestampKeyPrefix(start)); itr.ValidForPrefix(prefix); itr.Next() {
+		key := itr.Key().Data()
+		if bytes.Compare(key, endKey) >= 0 {
+			break
+		}
+		if limits.reached(len(result)) {
+			return result, true, nil
+		}
+		blockNumber, err := decodeUint64At(key, len(endKey))
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, blockNumber)
+	}
+	return result, false, nil
+}
+
+// the block number is big-endian encoded so that the keys are ordered by block number
+func encodeBlockTimestampKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockTimestampKey, encodeIndexUint64(blockNumber))
+}
+
+func encodeTimestampBlockNumCompositeKey(seconds int64, blockNumber uint64) []byte {
+	return append(encodeTimestampKeyPrefix(seconds), encodeIndexUint64(blockNumber)...)
+}
+
+// the seconds are encoded with the sign bit flipped, so that the keys of negative timestamps sort before the others
+func encodeTimestampKeyPrefix(seconds int64) []byte {
+	return prependKeyPrefix(prefixTimestampBlockNumCompositeKey, encodeIndexUint64(uint64(seconds)^(1<<63)))
+}
+
+func decodeTimestampSeconds(bytes []byte) int64 {
+	return int64(decodeIndexUint64(bytes) ^ (1 << 63))
+}
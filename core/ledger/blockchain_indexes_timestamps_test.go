@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	google_protobuf "google/protobuf"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func setupBlockTimestampsTest(t *testing.T, seconds []int64) *blockchainTestWrapper {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	for i, s := range seconds {
+		block, _ := buildTestBlock(t)
+		// a zero means a block without a timestamp
+		if s != 0 {
+			block.Timestamp = &google_protobuf.Timestamp{Seconds: s, Nanos: int32(i)}
+		}
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	return testBlockchainWrapper
+}
+
+func TestIndexes_FetchBlockTimestamp(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultTimestampSetting := indexBlockTimestamps
+	indexBlockDataSynchronously = true
+	indexBlockTimestamps = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexBlockTimestamps = defaultTimestampSetting
+	}()
+	testBlockchainWrapper := setupBlockTimestampsTest(t, []int64{100, 0, 300})
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	timestamp, err := fetchBlockTimestamp(0)
+	testutil.AssertNoError(t, err, "Error while fetching the block timestamp")
+	testutil.AssertEquals(t, timestamp, &google_protobuf.Timestamp{Seconds: 100, Nanos: 0})
+	timestamp, err = fetchBlockTimestamp(2)
+	testutil.AssertNoError(t, err, "Error while fetching the block timestamp")
+	testutil.AssertEquals(t, timestamp, &google_protobuf.Timestamp{Seconds: 300, Nanos: 2})
+
+	// a block without a timestamp and a block that is not indexed
+	for _, blockNumber := range []uint64{1, 3} {
+		timestamp, err = fetchBlockTimestamp(blockNumber)
+		testutil.AssertNoError(t, err, "Error while fetching the block timestamp")
+		testutil.AssertNil(t, timestamp)
+	}
+}
+
+func TestIndexes_FetchBlocksByTimeRange(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultTimestampSetting := indexBlockTimestamps
+	indexBlockDataSynchronously = true
+	indexBlockTimestamps = true
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexBlockTimestamps = defaultTimestampSetting
+	}()
+	testBlockchainWrapper := setupBlockTimestampsTest(t, []int64{300, 100, 0, 200, 100, -50})
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	blockNumbers, truncated, err := fetchBlocksByTimeRange(100, 300, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching blocks by time range")
+	testutil.AssertEquals(t, truncated, false)
+	testutil.AssertEquals(t, blockNumbers, []uint64{1, 4, 3})
+
+	blockNumbers, _, err = fetchBlocksByTimeRange(-100, 1000, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching blocks by time range")
+	testutil.AssertEquals(t, blockNumbers, []uint64{5, 1, 4, 3, 0})
+
+	blockNumbers, truncated, err = fetchBlocksByTimeRange(-100, 1000, newScanLimits(2))
+	testutil.AssertNoError(t, err, "Error while fetching blocks by time range")
+	testutil.AssertEquals(t, truncated, true)
+	testutil.AssertEquals(t, blockNumbers, []uint64{5, 1})
+
+	blockNumbers, _, err = fetchBlocksByTimeRange(101, 200, testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching blocks by time range")
+	testutil.AssertNil(t, blockNumbers)
+}
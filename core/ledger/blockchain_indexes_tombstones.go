@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexSoftDeletes, when true, makes the removal of the index entries of a block (see addIndexDeletionsForBlock)
+// write a tombstone for each removed entry. The entry itself is still deleted, so every read treats it as not found
+// without checking for tombstones, and the tombstone (tombstone prefix + original key -> deletion time) records the deletion.
+// Indexing the block again restores the entries and clears their tombstones. Old tombstones are removed by purgeIndexTombstones
+var indexSoftDeletes = false
+
+// indexTombstoneClock returns the time recorded in the tombstones. Tests replace it to age the tombstones
+var indexTombstoneClock = time.Now
+
+// deleteIndexEntry adds to the writeBatch the deletion of the key and, if indexSoftDeletes is set, its tombstone.
+// The tombstones are always kept in the indexes column family, whichever column family holds the key
+func deleteIndexEntry(writeBatch *gorocksdb.WriteBatch, key []byte) {
+	writeBatch.DeleteCF(indexCFForKey(key), key)
+	if indexSoftDeletes {
+		writeBatch.PutCF(db.GetDBHandle().IndexesCF, encodeIndexTombstoneKey(key), encodeIndexTombstone(indexTombstoneClock()))
+	}
+}
+
+// fetchIndexTombstones returns the deletion time of each tombstoned key
+func fetchIndexTombstones() (map[string]time.Time, error) {
+	itr := db.GetDBHandle().GetIndexesCFIterator()
+	defer itr.Close()
+	tombstones := make(map[string]time.Time)
+	prefix := newIndexKey(prefixIndexTombstoneKey)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		deletedAt, err := decodeIndexTombstone(itr.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		tombstones[string(decodeIndexTombstoneKey(statemgmt.Copy(itr.Key().Data())))] = deletedAt
+	}
+	return tombstones, nil
+}
+
+// purgeIndexTombstones removes the tombstones that are at least maxAge old and returns the number of tombstones removed.
+// An entry whose tombstone is purged can still be restored by indexing its block again
+func purgeIndexTombstones(maxAge time.Duration) (uint64, error) {
+	indexMaintenanceLock.Lock()
+	defer indexMaintenanceLock.Unlock()
+	openchainDB := db.GetDBHandle()
+	itr := openchainDB.GetIndexesCFIterator()
+	defer itr.Close()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+
+	var purged uint64
+	now := indexTombstoneClock()
+	prefix := newIndexKey(prefixIndexTombstoneKey)
+	for itr.Seek(prefix); itr.ValidForPrefix(prefix); itr.Next() {
+		deletedAt, err := decodeIndexTombstone(itr.Value().Data())
+		if err != nil {
+			return 0, err
+		}
+		if now.Sub(deletedAt) >= maxAge {
+			writeBatch.DeleteCF(openchainDB.IndexesCF, statemgmt.Copy(itr.Key().Data()))
+			purged++
+		}
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+		return 0, err
+	}
+	indexLogger.Debugf("Purged [%d] index tombstones older than [%s]", purged, maxAge)
+	return purged, nil
+}
+
+func encodeIndexTombstoneKey(key []byte) []byte {
+	return prependKeyPrefix(prefixIndexTombstoneKey, key)
+}
+
+func decodeIndexTombstoneKey(tombstoneKey []byte) []byte {
+	return tombstoneKey[indexKeyHeaderLength():]
+}
+
+func encodeIndexTombstone(deletedAt time.Time) []byte {
+	b := make([]byte, 8)
+	indexByteOrder.PutUint64(b, uint64(deletedAt.UnixNano()))
+	return b
+}
+
+func decodeIndexTombstone(b []byte) (time.Time, error) {
+	if len(b) != 8 {
+		return time.Time{}, fmt.Errorf("Invalid index tombstone [%x]", b)
+	}
+	return time.Unix(0, int64(indexByteOrder.Uint64(b))), nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+)
+
+func TestIndexes_SoftDeleteAndReindex(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defaultSoftDeletes := indexSoftDeletes
+	indexSoftDeletes = true
+	defaultClock := indexTombstoneClock
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexSoftDeletes = defaultSoftDeletes
+		indexTombstoneClock = defaultClock
+	}()
+	deletionTime := time.Unix(1000, 0)
+	indexTombstoneClock = func() time.Time { return deletionTime }
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	var blocks []*protos.Block
+	var uuids []string
+	for i := 0; i < 3; i++ {
+		tx, uuid := buildTestTx(t)
+		block := protos.NewBlock([]*protos.Transaction{tx}, nil)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+		blocks = append(blocks, block)
+		uuids = append(uuids, uuid)
+	}
+	blockHash1, _ := blocks[1].GetHash()
+
+	done, err := pruneIndexesBelow(2, 2, 0)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	testutil.AssertEquals(t, done, true)
+	for i := 0; i < 2; i++ {
+		_, err = fetchTransactionLocationByUUIDFromDB(uuids[i])
+		testutil.AssertSame(t, err, ErrResourceNotFound)
+	}
+	_, err = fetchBlockNumberByBlockHashFromDB(blockHash1)
+	testutil.AssertError(t, err, "Deleted block should not be found by hash")
+	tombstones, err := fetchIndexTombstones()
+	testutil.AssertNoError(t, err, "Error while fetching tombstones")
+	testutil.AssertEquals(t, tombstones[string(encodeBlockHashKey(blockHash1))], deletionTime)
+	testutil.AssertEquals(t, tombstones[string(encodeTxUUIDKey(uuids[1]))], deletionTime)
+	numTombstones := len(tombstones)
+
+	// index block 1 again
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	testutil.AssertNoError(t, addIndexDataForPersistence(blocks[1], 1, blockHash1, writeBatch), "Error while indexing block")
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	testutil.AssertNoError(t, db.GetDBHandle().DB.Write(opt, writeBatch), "Error while writing index batch")
+
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash1)
+	testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(uuids[1])
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, *txLocation, TransactionLocation{1, 0})
+	_, err = fetchTransactionLocationByUUIDFromDB(uuids[0])
+	testutil.AssertSame(t, err, ErrResourceNotFound)
+
+	// the entries of block 1 are no longer tombstoned and the ones of block 0 still are
+	tombstones, err = fetchIndexTombstones()
+	testutil.AssertNoError(t, err, "Error while fetching tombstones")
+	for key := range tombstones {
+		value, err := db.GetDBHandle().GetFromIndexesCF([]byte(key))
+		testutil.AssertNoError(t, err, "Error while reading tombstoned key")
+		testutil.AssertNil(t, value)
+	}
+	_, ok := tombstones[string(encodeBlockHashKey(blockHash1))]
+	testutil.AssertEquals(t, ok, false)
+	_, ok = tombstones[string(encodeTxUUIDKey(uuids[0]))]
+	testutil.AssertEquals(t, ok, true)
+	if len(tombstones) == 0 || len(tombstones) >= numTombstones {
+		t.Fatalf("Expected the tombstones of block 1 to be cleared. Tombstones before = [%d], after = [%d]",
+			numTombstones, len(tombstones))
+	}
+
+	// purge the old tombstones
+	indexTombstoneClock = func() time.Time { return deletionTime.Add(30 * time.Minute) }
+	purged, err := purgeIndexTombstones(time.Hour)
+	testutil.AssertNoError(t, err, "Error while purging tombstones")
+	testutil.AssertEquals(t, purged, uint64(0))
+	indexTombstoneClock = func() time.Time { return deletionTime.Add(2 * time.Hour) }
+	purged, err = purgeIndexTombstones(time.Hour)
+	testutil.AssertNoError(t, err, "Error while purging tombstones")
+	testutil.AssertEquals(t, purged, uint64(len(tombstones)))
+	tombstones, err = fetchIndexTombstones()
+	testutil.AssertNoError(t, err, "Error while fetching tombstones")
+	testutil.AssertEquals(t, len(tombstones), 0)
+}
+
+func TestIndexes_HardDeleteWritesNoTombstones(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	tx, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash0"))
+
+	_, err := pruneIndexesBelow(1, 1, 0)
+	testutil.AssertNoError(t, err, "Error while pruning indexes")
+	tombstones, err := fetchIndexTombstones()
+	testutil.AssertNoError(t, err, "Error while fetching tombstones")
+	testutil.AssertEquals(t, len(tombstones), 0)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// valueCodec encodes the list-valued index entries: the tx indexes of an address in a block and the
+// executing addresses of a transaction. An alternative format (e.g., compressed or delta encoded) can be
+// installed as indexValueCodec without changing the call sites, which use the encode*List and decode*List
+// functions. The encoded value is still wrapped by encodeIndexValue, so checksums apply to any codec.
+// A codec should not be changed for an existing db
+type valueCodec interface {
+	encodeTxIndexes(listTx []uint64) []byte
+	decodeTxIndexes(value []byte) ([]uint64, error)
+	encodeAddresses(addresses []string) []byte
+	decodeAddresses(value []byte) ([]string, error)
+}
+
+// defaultValueCodec encodes a list of tx indexes as consecutive varints and a list of addresses
+// as consecutive length-prefixed byte strings
+type defaultValueCodec struct {
+}
+
+var indexValueCodec valueCodec = defaultValueCodec{}
+
+// the tx indexes are encoded in ascending order, irrespective of the order of listTx,
+// so that the decoded lists are always ascending
+func (defaultValueCodec) encodeTxIndexes(listTx []uint64) []byte {
+	sortedListTx := make([]uint64, len(listTx))
+	copy(sortedListTx, listTx)
+	sort.Sort(ascendingTxIndexes(sortedListTx))
+	b := proto.NewBuffer([]byte{})
+	for i := range sortedListTx {
+		b.EncodeVarint(sortedListTx[i])
+	}
+	return b.Bytes()
+}
+
+func (defaultValueCodec) decodeTxIndexes(value []byte) ([]uint64, error) {
+	var listTx []uint64
+	for len(value) > 0 {
+		txIndex, n := binary.Uvarint(value)
+		if n <= 0 {
+			return nil, fmt.Errorf("Invalid encoding of list of tx indexes")
+		}
+		listTx = append(listTx, txIndex)
+		value = value[n:]
+	}
+	return listTx, nil
+}
+
+func (defaultValueCodec) encodeAddresses(addresses []string) []byte {
+	b := proto.NewBuffer([]byte{})
+	for _, address := range addresses {
+		b.EncodeRawBytes([]byte(address))
+	}
+	return b.Bytes()
+}
+
+func (defaultValueCodec) decodeAddresses(value []byte) ([]string, error) {
+	var addresses []string
+	for len(value) > 0 {
+		length, n := binary.Uvarint(value)
+		if n <= 0 || uint64(len(value)-n) < length {
+			return nil, fmt.Errorf("Invalid encoding of list of addresses")
+		}
+		addresses = append(addresses, string(value[n:n+int(length)]))
+		value = value[n+int(length):]
+	}
+	return addresses, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_DefaultValueCodec(t *testing.T) {
+	codec := defaultValueCodec{}
+	// the byte output of the encoders used before the codec was introduced
+	testutil.AssertEquals(t, codec.encodeTxIndexes([]uint64{300, 1, 2}), []byte{1, 2, 0xac, 0x02})
+	testutil.AssertEquals(t, codec.encodeTxIndexes(nil), []byte{})
+	testutil.AssertEquals(t, codec.encodeAddresses([]string{"ab", "", "c"}), []byte{2, 'a', 'b', 0, 1, 'c'})
+
+	txIndexes, err := codec.decodeTxIndexes([]byte{1, 2, 0xac, 0x02})
+	testutil.AssertNoError(t, err, "Error while decoding tx indexes")
+	testutil.AssertEquals(t, txIndexes, []uint64{1, 2, 300})
+	addresses, err := codec.decodeAddresses([]byte{2, 'a', 'b', 0, 1, 'c'})
+	testutil.AssertNoError(t, err, "Error while decoding addresses")
+	testutil.AssertEquals(t, addresses, []string{"ab", "", "c"})
+	_, err = codec.decodeTxIndexes([]byte{0x80})
+	testutil.AssertError(t, err, "Expected an error for a truncated varint")
+	_, err = codec.decodeAddresses([]byte{3, 'a'})
+	testutil.AssertError(t, err, "Expected an error for a truncated address")
+}
+
+// taggedValueCodec prepends a tag byte to the output of the default codec
+type taggedValueCodec struct {
+	defaultValueCodec
+}
+
+func (codec taggedValueCodec) encodeTxIndexes(listTx []uint64) []byte {
+	return append([]byte{0xff}, codec.defaultValueCodec.encodeTxIndexes(listTx)...)
+}
+
+func (codec taggedValueCodec) decodeTxIndexes(value []byte) ([]uint64, error) {
+	if len(value) == 0 || value[0] != 0xff {
+		return nil, fmt.Errorf("Value [%x] is not tagged", value)
+	}
+	return codec.defaultValueCodec.decodeTxIndexes(value[1:])
+}
+
+func (codec taggedValueCodec) encodeAddresses(addresses []string) []byte {
+	return append([]byte{0xff}, codec.defaultValueCodec.encodeAddresses(addresses)...)
+}
+
+func (codec taggedValueCodec) decodeAddresses(value []byte) ([]string, error) {
+	if len(value) == 0 || value[0] != 0xff {
+		return nil, fmt.Errorf("Value [%x] is not tagged", value)
+	}
+	return codec.defaultValueCodec.decodeAddresses(value[1:])
+}
+
+func TestIndexes_CustomValueCodec(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultCodec := indexValueCodec
+	indexBlockDataSynchronously = true
+	indexValueCodec = taggedValueCodec{}
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexValueCodec = defaultCodec
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	tx1, uuid1 := buildTestTx(t)
+	tx2, _ := buildTestTx(t)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+
+	value, err := db.GetDBHandle().GetFromIndexesCF(encodeAddressBlockNumCompositeKey("address1", 0))
+	testutil.AssertNoError(t, err, "Error while reading the address entry")
+	testutil.AssertEquals(t, value, []byte{0xff, 0, 1})
+	txLocations, _, err := fetchTransactionIndexesByAddress("address1", testScanLimits)
+	testutil.AssertNoError(t, err, "Error while fetching transactions by address")
+	testutil.AssertEquals(t, txLocations, []*TransactionLocation{{0, 0}, {0, 1}})
+	addresses, err := fetchExecutingAddresses(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching executing addresses")
+	testutil.AssertEquals(t, addresses, []string{"address1"})
+}
@@ -0,0 +1,244 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/db"
+	"golang.org/x/net/context"
+)
+
+// indexVerifyCheckpointBlocks is the number of blocks verified by verifyIndexes between two saves of its cursor.
+// The cursor is also saved when a verification is cancelled
+var indexVerifyCheckpointBlocks = uint64(100)
+
+// indexMismatch is an index entry of a block that does not match the block
+type indexMismatch struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	Key         []byte `json:"key"`
+	Reason      string `json:"reason"`
+}
+
+// indexVerificationReport is the outcome of a verifyIndexes run. The blocks [StartBlock, NextBlock) were verified.
+// Complete is false if the run was cancelled, in which case the next run resumes at NextBlock. Mismatches only
+// lists the mismatches found by this run
+type indexVerificationReport struct {
+	StartBlock    uint64           `json:"startBlock"`
+	NextBlock     uint64           `json:"nextBlock"`
+	BlocksChecked uint64           `json:"blocksChecked"`
+	Complete      bool             `json:"complete"`
+	Mismatches    []*indexMismatch `json:"mismatches"`
+}
+
+// verifyIndexes checks the point lookup entries of the indexed blocks against the blocks: the block hash and
+// block number entries, the transaction count, the txUUID entries and the (address,blockNumber) entries.
+// A verification of a large chain can be cancelled through ctx, in which case the mismatches found so far are
+// returned along with ctx.Err(), and the position is saved so that the next call resumes from there. A run that
+// completes removes the saved position, so the next call verifies from the prune point again.
+// The blocks indexed after the call starts are not verified. The index is not modified, except for the saved
+// position, and the other maintenance operations wait for the verification to finish or be cancelled
+func verifyIndexes(ctx context.Context) (*indexVerificationReport, error) {
+	if indexVerifyCheckpointBlocks == 0 {
+		return nil, fmt.Errorf("Verification checkpoint interval should be greater than zero")
+	}
+	indexMaintenanceLock.Lock()
+	defer indexMaintenanceLock.Unlock()
+	startBlock, found, err := fetchIndexVerifyCursor()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if startBlock, _, err = pruneStatus(); err != nil {
+			return nil, err
+		}
+	}
+	report := &indexVerificationReport{StartBlock: startBlock, NextBlock: startBlock}
+	highestBlockNumber, found, err := fetchHighestIndexedBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	cursors := make(indexVerifyCursors)
+	defer func() { cursors.close() }()
+	for found && report.NextBlock <= highestBlockNumber {
+		select {
+		case <-ctx.Done():
+			indexLogger.Infof("Index verification cancelled at block [%d] with [%d] mismatches", report.NextBlock,
+				len(report.Mismatches))
+			if err := saveIndexVerifyCursor(report.NextBlock); err != nil {
+				return report, err
+			}
+			return report, ctx.Err()
+		default:
+		}
+		mismatches, err := verifyBlockIndexes(report.NextBlock, cursors)
+		if err != nil {
+			return report, err
+		}
+		report.Mismatches = append(report.Mismatches, mismatches...)
+		report.NextBlock++
+		report.BlocksChecked++
+		if report.BlocksChecked%indexVerifyCheckpointBlocks == 0 {
+			if err := saveIndexVerifyCursor(report.NextBlock); err != nil {
+				return report, err
+			}
+			// the iterators of the cursors are renewed, so that they do not pin the db files for the whole run
+			cursors.close()
+			cursors = make(indexVerifyCursors)
+		}
+	}
+	report.Complete = true
+	if err := db.GetDBHandle().Delete(db.GetDBHandle().IndexesCF, encodeIndexVerifyCursorKey()); err != nil {
+		return report, err
+	}
+	indexLogger.Infof("Verified the indexes of [%d] blocks from block [%d], found [%d] mismatches", report.BlocksChecked,
+		report.StartBlock, len(report.Mismatches))
+	return report, nil
+}
+
+// verifyBlockIndexes returns the mismatches between the given block and its index entries, read through the
+// cursors. A missing block, e.g. below the prune point of the blockchain, has no mismatches
+func verifyBlockIndexes(blockNumber uint64, cursors indexVerifyCursors) ([]*indexMismatch, error) {
+	block, err := fetchBlockFromDB(blockNumber)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	var mismatches []*indexMismatch
+	mismatch := func(key []byte, format string, args ...interface{}) {
+		mismatches = append(mismatches, &indexMismatch{blockNumber, key, fmt.Sprintf(format, args...)})
+	}
+
+	// the block is indexed under the hash computed by the indexer, which may differ from block.GetHash()
+	blockHash, err := computeBlockHash(block)
+	if err != nil {
+		return nil, err
+	}
+	blockHashKey := encodeBlockHashKey(blockHash)
+	value, err := cursors.value(blockHashKey)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		mismatch(blockHashKey, "Block hash is not indexed")
+	} else if value, err = decodeIndexValue(value); err != nil {
+		mismatch(blockHashKey, "Block hash entry is corrupted: %s", err)
+	} else if indexedBlockNumber, err := decodeBlockNumber(value); err != nil {
+		mismatch(blockHashKey, "Block hash entry is corrupted: %s", err)
+	} else if indexedBlockNumber != blockNumber {
+		mismatch(blockHashKey, "Block hash is indexed at block number [%d]", indexedBlockNumber)
+	}
+	blockNumberKey := encodeBlockNumberKey(blockNumber)
+	indexedBlockHash, err := cursors.value(blockNumberKey)
+	if err != nil {
+		return nil, err
+	}
+	if indexedBlockHash, err = decodeIndexValue(indexedBlockHash); err != nil {
+		mismatch(blockNumberKey, "Block number entry is corrupted: %s", err)
+	} else if !bytes.Equal(indexedBlockHash, blockHash) {
+		mismatch(blockNumberKey, "Block number is indexed with block hash [%x]", indexedBlockHash)
+	}
+	transactions := block.GetTransactions()
+	txCountKey := encodeBlockTxCountKey(blockNumber)
+	if value, err := cursors.value(txCountKey); err != nil {
+		return nil, err
+	} else if txCount, err := decodeBlockNumber(value); value == nil || err != nil || txCount != uint64(len(transactions)) {
+		mismatch(txCountKey, "Transaction count is not indexed as [%d]", len(transactions))
+	}
+
+	addresses := make(map[string]bool)
+	for txIndex, tx := range transactions {
+		txUUID, err := getTxUUIDForIndex(tx)
+		if err != nil {
+			return nil, err
+		}
+		txUUIDKey := encodeTxUUIDKey(txUUID)
+		value, err := cursors.value(txUUIDKey)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			mismatch(txUUIDKey, "Transaction [%s] is not indexed", txUUID)
+		} else if value, err = decodeIndexValue(value); err != nil {
+			mismatch(txUUIDKey, "Transaction [%s] entry is corrupted: %s", txUUID, err)
+		} else if indexedBlockNumber, indexedTxIndex, err := decodeBlockNumTxIndex(value); err != nil {
+			mismatch(txUUIDKey, "Transaction [%s] entry is corrupted: %s", txUUID, err)
+		} else if indexedBlockNumber < blockNumber || indexedBlockNumber == blockNumber && indexedTxIndex != uint64(txIndex) {
+			// a uuid indexed again by a later block points to that block
+			mismatch(txUUIDKey, "Transaction [%s] at index [%d] is indexed at [%d,%d]", txUUID, txIndex,
+				indexedBlockNumber, indexedTxIndex)
+		}
+		for _, address := range getTxExecutingAddresses(tx) {
+			addresses[address] = true
+		}
+	}
+	if !indexAddressLatestBlockOnly {
+		for address := range addresses {
+			key := encodeAddressBlockNumCompositeKey(address, blockNumber)
+			if value, err := cursors.value(key); err != nil {
+				return nil, err
+			} else if value == nil {
+				mismatch(key, "Address [%s] is not indexed for the block", address)
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// indexVerifyCursors holds the cursors through which verifyBlockIndexes reads the index entries, one per key type,
+// as the keys of a type that are keyed by the block number are then read in ascending order. The entries keyed by
+// a hash (block hashes, uuids) are read in no particular order, for which the cursors fall back to seeks
+type indexVerifyCursors map[byte]*indexKeyCursor
+
+// value returns the value of the key, or nil if the key is not present
+func (cursors indexVerifyCursors) value(key []byte) ([]byte, error) {
+	prefix := key[indexKeyHeaderLength()-1]
+	cursor, ok := cursors[prefix]
+	if !ok {
+		cursor = newIndexKeyCursorCF(indexCFForPrefix(prefix))
+		cursors[prefix] = cursor
+	}
+	value := cursor.value(key)
+	if value == nil {
+		return nil, cursor.err()
+	}
+	return value, nil
+}
+
+func (cursors indexVerifyCursors) close() {
+	for _, cursor := range cursors {
+		cursor.close()
+	}
+}
+
+// fetchIndexVerifyCursor returns the block at which an interrupted verifyIndexes resumes
+func fetchIndexVerifyCursor() (uint64, bool, error) {
+	cursorBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeIndexVerifyCursorKey())
+	if err != nil || cursorBytes == nil {
+		return 0, false, err
+	}
+	nextBlock, err := decodeBlockNumber(cursorBytes)
+	return nextBlock, err == nil, err
+}
+
+func saveIndexVerifyCursor(nextBlock uint64) error {
+	return db.GetDBHandle().Put(db.GetDBHandle().IndexesCF, encodeIndexVerifyCursorKey(), encodeBlockNumber(nextBlock))
+}
+
+func encodeIndexVerifyCursorKey() []byte {
+	return newIndexKey(prefixIndexVerifyCursorKey)
+}
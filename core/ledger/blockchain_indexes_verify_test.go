@@ -0,0 +1,128 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/core/util"
+	"github.com/hyperledger/fabric/protos"
+	"golang.org/x/net/context"
+)
+
+func TestIndexes_VerifyIndexesCancelAndResume(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultCheckpointBlocks := indexVerifyCheckpointBlocks
+	indexBlockDataSynchronously = true
+	indexVerifyCheckpointBlocks = 3
+	defaultExtractor := getTxExecutingAddresses
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexVerifyCheckpointBlocks = defaultCheckpointBlocks
+		getTxExecutingAddresses = defaultExtractor
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	var uuids []string
+	for i := 0; i < 10; i++ {
+		tx, uuid := buildTestTx(t)
+		uuids = append(uuids, uuid)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, encodeTxUUIDKey(uuids[2])), "Error while deleting an entry")
+	blockHash, _ := testBlockchainWrapper.getBlock(7).GetHash()
+	testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, encodeBlockHashKey(blockHash)), "Error while deleting an entry")
+
+	// the verification is cancelled while checking block 4
+	ctx, cancel := context.WithCancel(context.Background())
+	getTxExecutingAddresses = func(tx *protos.Transaction) []string {
+		if tx.Uuid == uuids[4] {
+			cancel()
+		}
+		return defaultExtractor(tx)
+	}
+	report, err := verifyIndexes(ctx)
+	testutil.AssertSame(t, err, context.Canceled)
+	testutil.AssertEquals(t, report.StartBlock, uint64(0))
+	testutil.AssertEquals(t, report.NextBlock, uint64(5))
+	testutil.AssertEquals(t, report.BlocksChecked, uint64(5))
+	testutil.AssertEquals(t, report.Complete, false)
+	testutil.AssertEquals(t, len(report.Mismatches), 1)
+	testutil.AssertEquals(t, report.Mismatches[0].BlockNumber, uint64(2))
+	testutil.AssertEquals(t, report.Mismatches[0].Key, encodeTxUUIDKey(uuids[2]))
+
+	// the next run resumes after the last verified block and checks the remaining blocks
+	report, err = verifyIndexes(context.Background())
+	testutil.AssertNoError(t, err, "Error while verifying the indexes")
+	testutil.AssertEquals(t, report.StartBlock, uint64(5))
+	testutil.AssertEquals(t, report.NextBlock, uint64(10))
+	testutil.AssertEquals(t, report.BlocksChecked, uint64(5))
+	testutil.AssertEquals(t, report.Complete, true)
+	testutil.AssertEquals(t, len(report.Mismatches), 1)
+	testutil.AssertEquals(t, report.Mismatches[0].BlockNumber, uint64(7))
+	testutil.AssertEquals(t, report.Mismatches[0].Key, encodeBlockHashKey(blockHash))
+
+	// a completed run starts over
+	report, err = verifyIndexes(context.Background())
+	testutil.AssertNoError(t, err, "Error while verifying the indexes")
+	testutil.AssertEquals(t, report.StartBlock, uint64(0))
+	testutil.AssertEquals(t, report.BlocksChecked, uint64(10))
+	testutil.AssertEquals(t, len(report.Mismatches), 2)
+}
+
+// prefixHasher hashes like the default hasher, with a prefix so that the hashes differ from block.GetHash()
+type prefixHasher struct{}
+
+func (prefixHasher) Hash(data []byte) []byte {
+	return append([]byte("prefix-"), util.ComputeCryptoHash(data)...)
+}
+
+func TestIndexes_VerifyIndexesInjectedHasher(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultHasher := indexHasher
+	indexBlockDataSynchronously = false
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexHasher = defaultHasher
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	chain := testBlockchainWrapper.blockchain
+	chain.indexer.stop()
+	chain.indexer = &NoopIndexer{}
+	for i := 0; i < 3; i++ {
+		block, _ := buildTestBlock(t)
+		testBlockchainWrapper.addNewBlock(block, []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+
+	// the pending blocks are indexed by the async indexer under the hashes of the injected hasher
+	indexHasher = prefixHasher{}
+	testDBWrapper.CloseDB(t)
+	testBlockchainWrapper = newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	report, err := verifyIndexes(context.Background())
+	testutil.AssertNoError(t, err, "Error while verifying the indexes")
+	testutil.AssertEquals(t, report.BlocksChecked, uint64(3))
+	testutil.AssertEquals(t, len(report.Mismatches), 0)
+}
@@ -0,0 +1,297 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/tecbot/gorocksdb"
+)
+
+// indexWALPath, when non-empty, is the path of a write-ahead log to which the index entries of a block are
+// appended (and synced) before the WriteBatch that carries them is committed. The log can be replayed with
+// replayIndexWAL to restore the index entries independently of the rocksdb WAL. The log is truncated once the
+// batch of the highest block appended to it has been committed (see indexWALCommitted), and the entries of a block
+// whose batch is not committed are marked as discarded (see indexWALDiscarded). Empty disables the log
+var indexWALPath = ""
+
+// indexWALLock serializes the appends, the replays and the truncations of the write-ahead log and guards
+// indexWALHighestBlock, indexWALHasEntries and indexWALPendingBlocks
+var indexWALLock sync.Mutex
+
+// indexWALHighestBlock is the highest block number whose entries were appended to the log since it was last truncated
+var indexWALHighestBlock uint64
+var indexWALHasEntries bool
+
+// indexWALPendingBlocks are the block numbers whose entries were appended to the log and whose batch has been
+// neither committed nor discarded yet
+var indexWALPendingBlocks = make(map[uint64]bool)
+
+// types of the records of the write-ahead log
+const (
+	indexWALRecordPut    = byte(0)
+	indexWALRecordDelete = byte(1)
+	// indexWALRecordBlock starts the records of a block
+	indexWALRecordBlock = byte(2)
+	// indexWALRecordDiscard discards the records of the latest block with the same block number before it
+	indexWALRecordDiscard = byte(3)
+)
+
+// indexWALEntry is an index key-value recorded in the write-ahead log, or the key of an entry deleted by the
+// batch of the block (e.g., the tombstone of an entry indexed again) if deleted is set
+type indexWALEntry struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+// indexWALBlockRecords are the entries recorded in the write-ahead log for a block
+type indexWALBlockRecords struct {
+	blockNumber uint64
+	entries     []indexWALEntry
+	discarded   bool
+}
+
+// appendToIndexWAL appends the entries of the given block to the write-ahead log and syncs the log to disk.
+// The entries are preceded by a block record holding the block number. Each record is a type byte followed by one
+// frame for the key (or the block number) and, for a put, one frame for the value (same framing as exportIndexes)
+func appendToIndexWAL(blockNumber uint64, entries []indexWALEntry) error {
+	if indexWALPath == "" || len(entries) == 0 {
+		return nil
+	}
+	indexWALLock.Lock()
+	defer indexWALLock.Unlock()
+	file, err := os.OpenFile(indexWALPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	bufWriter := bufio.NewWriter(file)
+	if err := bufWriter.WriteByte(indexWALRecordBlock); err != nil {
+		return err
+	}
+	if err := writeFrame(bufWriter, encodeBlockNumber(blockNumber)); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		recordType := indexWALRecordPut
+		if entry.deleted {
+			recordType = indexWALRecordDelete
+		}
+		if err := bufWriter.WriteByte(recordType); err != nil {
+			return err
+		}
+		if err := writeFrame(bufWriter, entry.key); err != nil {
+			return err
+		}
+		if entry.deleted {
+			continue
+		}
+		if err := writeFrame(bufWriter, entry.value); err != nil {
+			return err
+		}
+	}
+	if err := bufWriter.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if !indexWALHasEntries || blockNumber > indexWALHighestBlock {
+		indexWALHighestBlock = blockNumber
+	}
+	indexWALHasEntries = true
+	indexWALPendingBlocks[blockNumber] = true
+	return nil
+}
+
+// indexWALCommitted is called once the batch carrying the index entries of the given block has been committed.
+// The log is truncated if no higher block has been appended to it since, as the entries of the lower blocks are
+// committed before. A failure to truncate is only logged, as replaying committed entries is harmless
+func indexWALCommitted(blockNumber uint64) {
+	if indexWALPath == "" {
+		return
+	}
+	indexWALLock.Lock()
+	defer indexWALLock.Unlock()
+	delete(indexWALPendingBlocks, blockNumber)
+	if !indexWALHasEntries || blockNumber < indexWALHighestBlock {
+		return
+	}
+	if err := os.Truncate(indexWALPath, 0); err != nil {
+		indexLogger.Warningf("Could not truncate the index WAL [%s]: %s", indexWALPath, err)
+		return
+	}
+	indexWALHasEntries = false
+	indexWALPendingBlocks = make(map[uint64]bool)
+}
+
+// indexWALDiscarded is called when the batch carrying the index entries of the given block is not committed. A
+// discard record is appended to the log, so that a replay skips the entries of the block. Nothing is appended if
+// the entries of the block are not pending in the log (e.g., the batch failed before they were appended)
+func indexWALDiscarded(blockNumber uint64) {
+	if indexWALPath == "" {
+		return
+	}
+	indexWALLock.Lock()
+	defer indexWALLock.Unlock()
+	if !indexWALPendingBlocks[blockNumber] {
+		return
+	}
+	if err := appendIndexWALDiscard(blockNumber); err != nil {
+		indexLogger.Errorf("Could not discard the entries of block number [%d] in the index WAL [%s], "+
+			"a replay of the WAL restores them: %s", blockNumber, indexWALPath, err)
+		return
+	}
+	delete(indexWALPendingBlocks, blockNumber)
+}
+
+func appendIndexWALDiscard(blockNumber uint64) error {
+	file, err := os.OpenFile(indexWALPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	bufWriter := bufio.NewWriter(file)
+	if err := bufWriter.WriteByte(indexWALRecordDiscard); err != nil {
+		return err
+	}
+	if err := writeFrame(bufWriter, encodeBlockNumber(blockNumber)); err != nil {
+		return err
+	}
+	if err := bufWriter.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// replayIndexWAL writes the entries of the write-ahead log at the given path to the index column families (and
+// deletes the keys recorded as deleted) and returns the number of records replayed. Replaying is idempotent.
+// The entries of the blocks discarded by a later discard record are skipped, so the log is read in full before
+// any entry is written. A record torn by a crash during an append ends the log: the complete records before it
+// are replayed
+func replayIndexWAL(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	indexWALLock.Lock()
+	defer indexWALLock.Unlock()
+	blocks, readErr := readIndexWAL(bufio.NewReader(file))
+	if readErr != nil && readErr != io.ErrUnexpectedEOF {
+		return 0, readErr
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer func() { writeBatch.Destroy() }()
+	numEntries := 0
+	for _, block := range blocks {
+		if block.discarded {
+			continue
+		}
+		for _, entry := range block.entries {
+			if entry.deleted {
+				writeBatch.DeleteCF(indexCFForKey(entry.key), entry.key)
+			} else {
+				writeBatch.PutCF(indexCFForKey(entry.key), entry.key, entry.value)
+			}
+			numEntries++
+			if numEntries%indexImportBatchSize == 0 {
+				if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+					return numEntries, err
+				}
+				writeBatch.Destroy()
+				writeBatch = gorocksdb.NewWriteBatch()
+			}
+		}
+	}
+	if err := openchainDB.DB.Write(opt, writeBatch); err != nil {
+		return numEntries, err
+	}
+	if readErr != nil {
+		indexLogger.Warningf("Ignoring the torn record at the end of the index WAL [%s] after [%d] records", path, numEntries)
+	}
+	indexLogger.Debugf("Replayed [%d] index entries from the WAL [%s]", numEntries, path)
+	return numEntries, nil
+}
+
+// readIndexWAL reads the records of the write-ahead log, grouped by block. The records that precede the first block
+// record are returned as the first group and are never discarded. io.ErrUnexpectedEOF is returned, along with the
+// groups read, if the log ends with a torn record
+func readIndexWAL(bufReader *bufio.Reader) ([]*indexWALBlockRecords, error) {
+	current := &indexWALBlockRecords{}
+	blocks := []*indexWALBlockRecords{current}
+	numRecords := 0
+	for {
+		recordType, err := bufReader.ReadByte()
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return blocks, err
+		}
+		if recordType > indexWALRecordDiscard {
+			return blocks, fmt.Errorf("Invalid index WAL record type [%d] after [%d] records", recordType, numRecords)
+		}
+		frame, err := readFrame(bufReader)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return blocks, err
+		}
+		switch recordType {
+		case indexWALRecordBlock, indexWALRecordDiscard:
+			blockNumber, err := decodeBlockNumber(frame)
+			if err != nil {
+				return blocks, err
+			}
+			if recordType == indexWALRecordBlock {
+				current = &indexWALBlockRecords{blockNumber: blockNumber}
+				blocks = append(blocks, current)
+				break
+			}
+			for i := len(blocks) - 1; i > 0; i-- {
+				if blocks[i].blockNumber == blockNumber {
+					blocks[i].discarded = true
+					break
+				}
+			}
+		case indexWALRecordDelete:
+			current.entries = append(current.entries, indexWALEntry{frame, nil, true})
+		default:
+			value, err := readFrame(bufReader)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return blocks, err
+			}
+			current.entries = append(current.entries, indexWALEntry{frame, value, false})
+		}
+		numRecords++
+	}
+}
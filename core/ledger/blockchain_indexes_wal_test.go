@@ -0,0 +1,219 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/tecbot/gorocksdb"
+	"golang.org/x/net/context"
+)
+
+func TestIndexes_ReplayWAL(t *testing.T) {
+	walDir, err := ioutil.TempDir("", "indexwal")
+	testutil.AssertNoError(t, err, "Error while creating temp dir")
+	defer os.RemoveAll(walDir)
+	defaultWALPath := indexWALPath
+	indexWALPath = filepath.Join(walDir, "index.wal")
+	defer func() { indexWALPath = defaultWALPath }()
+
+	testDBWrapper.CleanDB(t)
+	tx1, uuid1 := buildTestTx(t)
+	tx2, uuid2 := buildTestTx(t)
+	block := protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil)
+	blockHash := []byte("blockHash0")
+
+	// the index entries reach the WAL but the write batch is never committed
+	writeBatch := gorocksdb.NewWriteBatch()
+	err = addIndexDataForPersistence(block, 0, blockHash, writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding index data")
+	writeBatch.Destroy()
+	_, err = fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertError(t, err, "Expected block hash not to be indexed before the replay")
+
+	numEntries, err := replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying the WAL")
+	testutil.AssertEquals(t, numEntries > 0, true)
+
+	blockNumber, err := fetchBlockNumberByBlockHashFromDB(blockHash)
+	testutil.AssertNoError(t, err, "Error while fetching block number by hash")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid1)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{0, 0})
+	txLocation, err = fetchTransactionLocationByUUIDFromDB(uuid2)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{0, 1})
+
+	// replaying again is idempotent
+	numReplayed, err := replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying the WAL")
+	testutil.AssertEquals(t, numReplayed, numEntries)
+}
+
+func TestIndexes_ReplayTruncatedWAL(t *testing.T) {
+	walDir, err := ioutil.TempDir("", "indexwal")
+	testutil.AssertNoError(t, err, "Error while creating temp dir")
+	defer os.RemoveAll(walDir)
+	defaultWALPath := indexWALPath
+	defaultSplit := indexSplitAddressCF
+	indexWALPath = filepath.Join(walDir, "index.wal")
+	indexSplitAddressCF = true
+	defer func() {
+		indexWALPath = defaultWALPath
+		indexSplitAddressCF = defaultSplit
+	}()
+
+	testDBWrapper.CleanDB(t)
+	blockHashKey := encodeBlockHashKey([]byte("blockHash0"))
+	addressKey := encodeAddressBlockNumCompositeKey("address1", 0)
+	tombstoneKey := encodeIndexTombstoneKey(blockHashKey)
+	testutil.AssertNoError(t, db.GetDBHandle().Put(db.GetDBHandle().IndexesCF, tombstoneKey, []byte{}), "Error while writing a tombstone")
+	testutil.AssertNoError(t, appendToIndexWAL(0, []indexWALEntry{
+		{blockHashKey, []byte("value1"), false},
+		{addressKey, []byte("value2"), false},
+		{tombstoneKey, nil, true},
+	}), "Error while appending to the WAL")
+	// a record torn by a crash during an append
+	walFile, err := os.OpenFile(indexWALPath, os.O_APPEND|os.O_WRONLY, 0644)
+	testutil.AssertNoError(t, err, "Error while opening the WAL")
+	walFile.Write([]byte{indexWALRecordPut, 3, 'k', 'e', 'y', 5, 'v'})
+	walFile.Close()
+
+	numEntries, err := replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying a WAL with a torn record")
+	testutil.AssertEquals(t, numEntries, 3)
+	value, err := getIndexValue(blockHashKey)
+	testutil.AssertNoError(t, err, "Error while reading a replayed entry")
+	testutil.AssertEquals(t, value, []byte("value1"))
+	// the address entry is replayed to the address column family
+	value, err = db.GetDBHandle().Get(db.GetDBHandle().AddressIndexesCF, addressKey)
+	testutil.AssertNoError(t, err, "Error while reading a replayed address entry")
+	testutil.AssertEquals(t, value, []byte("value2"))
+	value, err = getIndexValue(tombstoneKey)
+	testutil.AssertNoError(t, err, "Error while reading a deleted entry")
+	testutil.AssertNil(t, value)
+
+	// a record of an unknown type is not a torn record
+	walFile, err = os.OpenFile(indexWALPath, os.O_TRUNC|os.O_WRONLY, 0644)
+	testutil.AssertNoError(t, err, "Error while opening the WAL")
+	walFile.Write([]byte{9, 3, 'k', 'e', 'y'})
+	walFile.Close()
+	_, err = replayIndexWAL(indexWALPath)
+	testutil.AssertError(t, err, "Expected error replaying a corrupt WAL")
+}
+
+func TestIndexes_WALTruncatedOnCommit(t *testing.T) {
+	walDir, err := ioutil.TempDir("", "indexwal")
+	testutil.AssertNoError(t, err, "Error while creating temp dir")
+	defer os.RemoveAll(walDir)
+	defaultSetting := indexBlockDataSynchronously
+	defaultWALPath := indexWALPath
+	indexBlockDataSynchronously = true
+	indexWALPath = filepath.Join(walDir, "index.wal")
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexWALPath = defaultWALPath
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	walSize := func() int64 {
+		info, err := os.Stat(indexWALPath)
+		testutil.AssertNoError(t, err, "Error while reading the size of the WAL")
+		return info.Size()
+	}
+
+	// the entries of the block are in the WAL until its batch is committed
+	tx, _ := buildTestTx(t)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	_, err = testBlockchainWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash0"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding a block")
+	testutil.AssertEquals(t, walSize() > 0, true)
+	testDBWrapper.WriteToDB(t, writeBatch)
+	testBlockchainWrapper.blockchain.blockPersistenceStatus(true)
+	testutil.AssertEquals(t, walSize(), int64(0))
+
+	// a block appended after the committed one keeps the WAL
+	testutil.AssertNoError(t, appendToIndexWAL(2, []indexWALEntry{{[]byte("key"), []byte("value"), false}}), "Error while appending to the WAL")
+	indexWALCommitted(1)
+	testutil.AssertEquals(t, walSize() > 0, true)
+	indexWALCommitted(2)
+	testutil.AssertEquals(t, walSize(), int64(0))
+}
+
+func TestIndexes_WALDiscardedOnFailedCommit(t *testing.T) {
+	walDir, err := ioutil.TempDir("", "indexwal")
+	testutil.AssertNoError(t, err, "Error while creating temp dir")
+	defer os.RemoveAll(walDir)
+	defaultSetting := indexBlockDataSynchronously
+	defaultWALPath := indexWALPath
+	indexBlockDataSynchronously = true
+	indexWALPath = filepath.Join(walDir, "index.wal")
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexWALPath = defaultWALPath
+	}()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	// the batch of the block is not committed, so its entries are not replayed
+	tx, uuid := buildTestTx(t)
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	_, err = testBlockchainWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(),
+		protos.NewBlock([]*protos.Transaction{tx}, nil), []byte("stateHash0"), writeBatch)
+	testutil.AssertNoError(t, err, "Error while adding a block")
+	testBlockchainWrapper.blockchain.blockPersistenceStatus(false)
+	numEntries, err := replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying the WAL")
+	testutil.AssertEquals(t, numEntries, 0)
+	_, err = fetchTransactionLocationByUUIDFromDB(uuid)
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+
+	// the entries appended again for the same block number are replayed, unless discarded again
+	entries := []indexWALEntry{{encodeTxUUIDKey(uuid), encodeIndexValue(encodeBlockNumTxIndex(0, 0)), false}}
+	testutil.AssertNoError(t, appendToIndexWAL(0, entries), "Error while appending to the WAL")
+	numEntries, err = replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying the WAL")
+	testutil.AssertEquals(t, numEntries, 1)
+	txLocation, err := fetchTransactionLocationByUUIDFromDB(uuid)
+	testutil.AssertNoError(t, err, "Error while fetching transaction location")
+	testutil.AssertEquals(t, txLocation, &TransactionLocation{0, 0})
+	indexWALDiscarded(0)
+	numEntries, err = replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying the WAL")
+	testutil.AssertEquals(t, numEntries, 0)
+
+	// a block whose entries are not pending in the WAL is not discarded
+	testutil.AssertNoError(t, appendToIndexWAL(1, entries), "Error while appending to the WAL")
+	indexWALDiscarded(2)
+	numEntries, err = replayIndexWAL(indexWALPath)
+	testutil.AssertNoError(t, err, "Error while replaying the WAL")
+	testutil.AssertEquals(t, numEntries, 1)
+}
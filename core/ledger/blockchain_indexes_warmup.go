@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"math"
+
+	"github.com/hyperledger/fabric/core/db"
+)
+
+// indexWarmupBlocks is the number of the most recent indexed blocks whose index entries are read when the indexer starts,
+// so that they are in the db block cache (and the OS page cache) by the time the first queries arrive.
+// Zero disables the warmup. A failure during the warmup is logged and does not fail the start
+var indexWarmupBlocks = uint64(0)
+
+// warmUpIndexes reads the blockNumber -> blockHash, blockHash -> blockNumber, blockNumber -> txCount and
+// (blockNumber, address) entries of the most recent numBlocks indexed blocks and returns the number of entries read
+func warmUpIndexes(numBlocks uint64) (int, error) {
+	if numBlocks == 0 {
+		return 0, nil
+	}
+	highestBlockNumber, found, err := fetchHighestIndexedBlockNumber()
+	if err != nil || !found {
+		return 0, err
+	}
+	firstBlockNumber := uint64(0)
+	if highestBlockNumber >= numBlocks {
+		firstBlockNumber = highestBlockNumber - numBlocks + 1
+	}
+
+	openchainDB := db.GetDBHandle()
+	itr := openchainDB.GetIndexesCFIterator()
+	defer itr.Close()
+	numEntries := 0
+	prefix := newIndexKey(prefixBlockNumberKey)
+	for itr.Seek(encodeBlockNumberKey(firstBlockNumber)); itr.ValidForPrefix(prefix); itr.Next() {
+		blockNumber, err := decodeBlockNumberKey(itr.Key().Data())
+		if err != nil {
+			return numEntries, err
+		}
+		blockHash, err := decodeIndexValue(itr.Value().Data())
+		if err != nil {
+			return numEntries, err
+		}
+		numEntries++
+		for _, key := range [][]byte{encodeBlockHashKey(blockHash), encodeBlockTxCountKey(blockNumber)} {
+			value, err := openchainDB.GetFromIndexesCF(key)
+			if err != nil {
+				return numEntries, err
+			}
+			if value != nil {
+				numEntries++
+			}
+		}
+		addresses, _, err := fetchAddressesInBlock(blockNumber, newScanLimits(math.MaxInt32))
+		if err != nil {
+			return numEntries, err
+		}
+		numEntries += len(addresses)
+	}
+	return numEntries, nil
+}
+
+// warmUpIndexesFromConfig runs the warmup as per indexWarmupBlocks. Errors are logged and not returned
+func warmUpIndexesFromConfig() {
+	if indexWarmupBlocks == 0 {
+		return
+	}
+	numEntries, err := warmUpIndexes(indexWarmupBlocks)
+	if err != nil {
+		indexLogger.Warningf("Warmup of the indexes of the last [%d] blocks failed after reading [%d] entries: %s",
+			indexWarmupBlocks, numEntries, err)
+		return
+	}
+	indexLogger.Debugf("Warmed up [%d] index entries of the last [%d] blocks", numEntries, indexWarmupBlocks)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestIndexes_WarmUpIndexes(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	numEntries, err := warmUpIndexes(2)
+	testutil.AssertNoError(t, err, "Error while warming up an empty index")
+	testutil.AssertEquals(t, numEntries, 0)
+
+	for i := 0; i < 3; i++ {
+		tx, _ := buildTestTx(t)
+		testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx}, nil), []byte(fmt.Sprintf("stateHash%d", i)))
+	}
+	// per block: blockNumber -> blockHash, blockHash -> blockNumber, blockNumber -> txCount and one (blockNumber, address)
+	numEntries, err = warmUpIndexes(2)
+	testutil.AssertNoError(t, err, "Error while warming up the indexes")
+	testutil.AssertEquals(t, numEntries, 8)
+	numEntries, err = warmUpIndexes(10)
+	testutil.AssertNoError(t, err, "Error while warming up the indexes")
+	testutil.AssertEquals(t, numEntries, 12)
+	numEntries, err = warmUpIndexes(0)
+	testutil.AssertNoError(t, err, "Error while warming up the indexes")
+	testutil.AssertEquals(t, numEntries, 0)
+}
+
+func TestIndexes_StartWithWarmup(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	defaultWarmupBlocks := indexWarmupBlocks
+	defer func() {
+		indexBlockDataSynchronously = defaultSetting
+		indexWarmupBlocks = defaultWarmupBlocks
+	}()
+	indexWarmupBlocks = 2
+
+	for _, synchronous := range []bool{true, false} {
+		indexBlockDataSynchronously = synchronous
+		testDBWrapper.CleanDB(t)
+		testBlockchainWrapper := newTestBlockchainWrapper(t)
+		blocks, _, err := testBlockchainWrapper.populateBlockChainWithSampleData()
+		testutil.AssertNoError(t, err, "Error populating block chain with sample data")
+		testBlockchainWrapper.blockchain.indexer.stop()
+
+		// a corrupted block number key makes the warmup fail, which should not fail the start
+		openchainDB := db.GetDBHandle()
+		testutil.AssertNoError(t, openchainDB.Put(openchainDB.IndexesCF, append(encodeBlockNumberKey(100), 0), []byte{}),
+			"Error while corrupting the index")
+		for _, corrupted := range []bool{true, false} {
+			if !corrupted {
+				testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, append(encodeBlockNumberKey(100), 0)),
+					"Error while repairing the index")
+			}
+			testDBWrapper.CloseDB(t)
+			testBlockchainWrapper = newTestBlockchainWrapper(t)
+			for i, block := range blocks {
+				blockHash, _ := block.GetHash()
+				testutil.AssertEquals(t, testBlockchainWrapper.getBlockByHash(blockHash), blocks[i])
+			}
+			testBlockchainWrapper.blockchain.indexer.stop()
+			openchainDB = db.GetDBHandle()
+		}
+	}
+}
@@ -48,6 +48,10 @@ const (
 	ErrorTypeResourceNotFound = ErrorType("ResourceNotFound")
 	//ErrorTypeBlockNotFound used to indicate if a block is not found when looked up by it's hash
 	ErrorTypeBlockNotFound = ErrorType("ErrorTypeBlockNotFound")
+	//ErrorTypeBlockLoadFailed used to indicate that a block referred to by the index could not be loaded
+	ErrorTypeBlockLoadFailed = ErrorType("BlockLoadFailed")
+	//ErrorTypeIndexMismatch used to indicate that the index refers to a transaction other than the one looked up
+	ErrorTypeIndexMismatch = ErrorType("IndexMismatch")
 )
 
 //Error can be used for throwing an error from ledger code.